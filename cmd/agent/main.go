@@ -4,14 +4,61 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/services"
 )
 
 // main — точка входа приложения-агента.
 // Получает конфигурацию, создает сервис метрик и запускает процесс сбора и отправки метрик.
+// По SIGHUP агент перечитывает конфигурацию, по SIGINT или SIGTERM выполняет финальную отправку и завершается.
 func main() {
-	cfg := config.GetAgentConfig()               // Получение конфигурации агента
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.GetAgentConfig(os.Args[1:], config.Environ()) // Получение конфигурации агента
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 	agent := services.NewAgentMetricService(cfg) // Создание сервиса метрик агента
-	agent.Run()                                  // Запуск процесса сбора и отправки метрик
+
+	go reloadOnHangup(ctx, agent)
+
+	if err := agent.Run(ctx); err != nil { // Запуск процесса сбора и отправки метрик
+		log.Fatal(err)
+	}
+}
+
+// reloadOnHangup перечитывает конфигурацию по SIGHUP и передает ее агенту.
+// Если новая конфигурация некорректна, агент продолжает работать с прежней.
+func reloadOnHangup(ctx context.Context, agent *services.Agent) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-hangup:
+			cfg, err := config.LoadAgentConfig(os.Args[1:], config.Environ())
+			if err != nil {
+				log.Println("config reload rejected:", err)
+				continue
+			}
+			if err := agent.Reload(ctx, cfg); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
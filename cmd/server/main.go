@@ -1,11 +1,17 @@
 // Package main содержит точку входа для запуска HTTP-сервера метрик.
-// Здесь инициализируются логгер, хранилище, обработчики, конфиг и сервер.
+// Здесь загружаются конфиг и логгер, а хранилище, обработчики и подсистемы собирает server.NewApp.
 
 package main
 
 import (
-	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
-	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"go.uber.org/zap"
 
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
@@ -13,25 +19,70 @@ import (
 )
 
 // main — точка входа приложения. Инициализирует все зависимости и запускает сервер.
+// По SIGINT или SIGTERM сервер дожидается завершения запросов и сбрасывает хранилище.
+// Если заданы цели опроса, сервер также забирает метрики у агентов в режиме pull,
+// если задан файл правил — вычисляет правила оповещений, если заданы получатели
+// webhook — отправляет им уведомления об изменении метрик, а если задан адрес Graphite —
+// принимает метрики по протоколу Graphite plaintext. Метрики OpenTelemetry принимаются
+// по OTLP/HTTP на /v1/metrics, а если задан адрес remote write — сервер пересылает метрики
+// во внешнее хранилище. Значения метрик за последний период хранятся в памяти
+// и доступны для запросов по /query.
+// С флагом -print-config выводит итоговую конфигурацию и завершается.
+// Если HTTP-сервер завершился с ошибкой, процесс останавливает фоновые задачи,
+// закрывает хранилище и выходит с ненулевым кодом.
 func main() {
-	logger, err := zap.NewDevelopment() // Инициализация логгера
+	cfg, err := config.LoadServerConfig(os.Args[1:], config.Environ()) // Получение и проверка конфигурации сервера
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.PrintConfig {
+		if err = cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	zapCfg := zap.NewDevelopmentConfig()
+	zapCfg.Level, err = zap.ParseAtomicLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err := zapCfg.Build() // Инициализация логгера
 	if err != nil {
 		panic(err)
 	}
 
 	defer func() {
-		err := logger.Sync() // Синхронизация логгера перед завершением
-		if err != nil {
-			panic(err)
-		}
+		_ = logger.Sync() // Синхронизация логгера перед завершением
 	}()
 
 	sugarLogger := logger.Sugar() // Упрощённый логгер
+	sugarLogger.Infow("starting server",
+		"address", cfg.Address,
+		"storage", cfg.Storage.Backend,
+		"tls", cfg.TLS.Enabled(),
+		"config_file", cfg.ConfigFile,
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := server.NewApp(&cfg, sugarLogger) // Хранилище, обработчики и включенные подсистемы
+	if err != nil {
+		sugarLogger.Fatalln("failed to create server", err)
+	}
 
-	memStorage := storage.NewMemStorage()            // Создание хранилища метрик в памяти
-	handler := handler.NewHandler(memStorage)        // Создание обработчиков с хранилищем
-	cfg := config.GetServerConfig()                  // Получение конфигурации сервера
-	server := server.New(&cfg, handler, sugarLogger) // Создание сервера
+	runErr := app.Run(ctx) // Запуск до получения сигнала остановки или ошибки сервера
+	if runErr != nil {
+		sugarLogger.Errorln("server stopped with error", runErr)
+	}
+	sugarLogger.Infoln("server stopped")
 
-	server.Run() // Запуск HTTP-сервера
+	if runErr != nil {
+		_ = logger.Sync()
+		os.Exit(1)
+	}
 }
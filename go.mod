@@ -3,8 +3,17 @@ module github.com/alexkozopolianski/go-metrics-tpl
 go 1.22.0
 
 require (
-	github.com/go-chi/chi/v5 v5.2.3 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
+	github.com/go-chi/chi/v5 v5.2.3
+	github.com/golang/snappy v1.0.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/stretchr/testify v1.11.1
+	go.uber.org/zap v1.27.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
 )
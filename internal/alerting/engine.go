@@ -0,0 +1,193 @@
+// Package alerting реализует правила оповещений сервера метрик.
+//
+// Engine периодически вычисляет правила по метрикам из хранилища. Для каждой пары
+// «правило — метрика» хранится оповещение с состоянием:
+//
+//   - pending — условие выполняется, но еще меньше, чем For;
+//   - firing — условие выполняется не меньше For, получатели уведомлены;
+//   - resolved — условие перестало выполняться после firing; получатели уведомляются,
+//     и оповещение удаляется.
+//
+// Если условие перестало выполняться в состоянии pending, оповещение удаляется без уведомлений.
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"go.uber.org/zap"
+)
+
+// Состояния оповещения.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert — оповещение по одной метрике, подходящей под правило.
+type Alert struct {
+	Rule        string     `json:"rule"`                  // Имя правила
+	Metric      string     `json:"metric"`                // ID метрики
+	Severity    string     `json:"severity"`              // Важность правила
+	Description string     `json:"description,omitempty"` // Описание правила
+	State       string     `json:"state"`                 // pending, firing или resolved
+	Value       float64    `json:"value"`                 // Последнее значение метрики
+	Op          string     `json:"op"`                    // Сравнение из правила
+	Threshold   float64    `json:"threshold"`             // Порог из правила
+	ActiveAt    time.Time  `json:"active_at"`             // Когда условие начало выполняться
+	FiredAt     *time.Time `json:"fired_at,omitempty"`    // Когда оповещение перешло в firing
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"` // Когда оповещение перешло в resolved
+}
+
+// Engine вычисляет правила и уведомляет получателей об изменениях состояния оповещений.
+type Engine struct {
+	rules     []Rule
+	storage   handler.Storager
+	notifiers []Notifier
+	logger    *zap.SugaredLogger
+
+	mu     sync.Mutex        // Защищает active
+	active map[string]*Alert // Оповещения в состояниях pending и firing по ключу «правило — метрика»
+}
+
+// NewEngine создает Engine для правил rules, вычисляемых по метрикам из storage.
+func NewEngine(rules []Rule, storage handler.Storager, notifiers []Notifier, logger *zap.SugaredLogger) *Engine {
+	return &Engine{
+		rules:     rules,
+		storage:   storage,
+		notifiers: notifiers,
+		logger:    logger,
+		active:    make(map[string]*Alert),
+	}
+}
+
+// Run вычисляет правила с интервалом interval до отмены ctx.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate один раз вычисляет все правила на момент now, обновляет состояния оповещений
+// и отправляет получателям оповещения, перешедшие в firing или resolved.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	metrics := e.storage.GetAll()
+
+	e.mu.Lock()
+	var changed []Alert
+	seen := make(map[string]bool, len(e.active))
+	for _, rule := range e.rules {
+		for _, m := range metrics {
+			value, ok := rule.match(m)
+			if !ok || !rule.holds(value) {
+				continue
+			}
+
+			key := rule.Name + "\x00" + m.ID
+			seen[key] = true
+			a, ok := e.active[key]
+			if !ok {
+				a = &Alert{
+					Rule:        rule.Name,
+					Metric:      m.ID,
+					Severity:    rule.Severity,
+					Description: rule.Description,
+					State:       StatePending,
+					Op:          rule.Op,
+					Threshold:   rule.Threshold,
+					ActiveAt:    now,
+				}
+				e.active[key] = a
+			}
+			a.Value = value
+
+			if a.State == StatePending && now.Sub(a.ActiveAt) >= rule.For.Std() {
+				a.State = StateFiring
+				firedAt := now
+				a.FiredAt = &firedAt
+				changed = append(changed, *a)
+			}
+		}
+	}
+
+	for key, a := range e.active {
+		if seen[key] {
+			continue
+		}
+		delete(e.active, key)
+		if a.State == StateFiring {
+			a.State = StateResolved
+			resolvedAt := now
+			a.ResolvedAt = &resolvedAt
+			changed = append(changed, *a)
+		}
+	}
+	e.mu.Unlock()
+
+	if len(changed) > 0 {
+		e.notify(ctx, changed)
+	}
+}
+
+// notify отправляет оповещения всем получателям. Ошибки доставки записываются в лог.
+func (e *Engine) notify(ctx context.Context, alerts []Alert) {
+	for _, n := range e.notifiers {
+		if err := n.Notify(ctx, alerts); err != nil {
+			e.logger.Errorln("alert notification failed", err)
+		}
+	}
+}
+
+// Alerts возвращает активные оповещения (pending и firing), отсортированные по правилу и метрике.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		alerts = append(alerts, *a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Metric < alerts[j].Metric
+	})
+	return alerts
+}
+
+// ServeHTTP отдает активные оповещения в формате JSON.
+// Параметр запроса state=pending или state=firing оставляет только оповещения в этом состоянии.
+func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	alerts := e.Alerts()
+	if state := r.URL.Query().Get("state"); state != "" {
+		filtered := alerts[:0]
+		for _, a := range alerts {
+			if a.State == state {
+				filtered = append(filtered, a)
+			}
+		}
+		alerts = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false) // Операции сравнения (>, <) выводятся как есть
+	if err := enc.Encode(alerts); err != nil {
+		e.logger.Errorln("failed to write alerts", err)
+	}
+}
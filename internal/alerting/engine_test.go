@@ -0,0 +1,111 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recordingNotifier запоминает полученные уведомления.
+type recordingNotifier struct {
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alerts []Alert) error {
+	n.alerts = append(n.alerts, alerts...)
+	return nil
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	rule := Rule{Name: "HighHeap", Metric: "Heap*", Type: models.Gauge, Op: ">", Threshold: 100, For: config.Duration(time.Minute), Severity: SeverityCritical}
+	s := storage.NewMemStorage()
+	n := &recordingNotifier{}
+	e := NewEngine([]Rule{rule}, s, []Notifier{n}, zap.NewNop().Sugar())
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name       string
+		value      float64
+		after      time.Duration
+		wantState  string // Состояние оповещения HeapAlloc после вычисления, пусто — оповещения нет
+		wantNotify []string
+	}{
+		{name: "below threshold", value: 50, after: 0},
+		{name: "pending", value: 150, after: 10 * time.Second, wantState: StatePending},
+		{name: "still pending", value: 150, after: 40 * time.Second, wantState: StatePending},
+		{name: "firing after for", value: 200, after: 70 * time.Second, wantState: StateFiring, wantNotify: []string{StateFiring}},
+		{name: "stays firing without new notifications", value: 300, after: 80 * time.Second, wantState: StateFiring},
+		{name: "resolved", value: 10, after: 90 * time.Second, wantNotify: []string{StateResolved}},
+		{name: "pending again", value: 150, after: 100 * time.Second, wantState: StatePending},
+		{name: "pending dropped silently", value: 10, after: 110 * time.Second},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			value := step.value
+			require.NoError(t, s.Save(models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &value}))
+			n.alerts = nil
+
+			e.Evaluate(context.Background(), start.Add(step.after))
+
+			alerts := e.Alerts()
+			if step.wantState == "" {
+				assert.Empty(t, alerts)
+			} else {
+				require.Len(t, alerts, 1)
+				assert.Equal(t, step.wantState, alerts[0].State)
+				assert.Equal(t, step.value, alerts[0].Value)
+			}
+
+			var notified []string
+			for _, a := range n.alerts {
+				notified = append(notified, a.State)
+			}
+			assert.Equal(t, step.wantNotify, notified)
+		})
+	}
+}
+
+func TestFile_Validate(t *testing.T) {
+	f := File{
+		Rules: []Rule{
+			{Name: "ok", Metric: "PollCount", Op: ">=", Threshold: 1},
+			{Name: "ok", Metric: "Alloc", Op: ">", Threshold: 1},
+			{Name: "bad", Metric: "[", Op: "=>", Type: "histogram", For: -1},
+		},
+		Notifiers: []NotifierConfig{{Type: NotifierWebhook, URL: "localhost"}, {Type: "email"}},
+	}
+
+	err := f.Validate()
+	require.Error(t, err)
+	for _, want := range []string{`duplicate rule name "ok"`, "invalid selector", "unknown comparison", "unknown metric type", "for:", "invalid url", `unknown notifier type "email"`} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.Equal(t, SeverityWarning, f.Rules[0].Severity)
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(NotifierConfig{Type: NotifierWebhook, URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	alerts := []Alert{{Rule: "HighHeap", Metric: "HeapAlloc", State: StateFiring, Value: 200}}
+	require.NoError(t, n.Notify(context.Background(), alerts))
+	require.Len(t, got.Alerts, 1)
+	assert.Equal(t, "HighHeap", got.Alerts[0].Rule)
+}
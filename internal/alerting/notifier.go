@@ -0,0 +1,140 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"go.uber.org/zap"
+)
+
+// Типы получателей уведомлений.
+const (
+	NotifierLog     = "log"     // Запись в лог сервера
+	NotifierWebhook = "webhook" // POST JSON на заданный URL
+)
+
+// defaultNotifyTimeout — таймаут доставки уведомления, если он не задан в настройках.
+const defaultNotifyTimeout = 5 * time.Second
+
+// Notifier доставляет уведомления об изменении состояния оповещений.
+// Notify получает оповещения, которые в этом цикле перешли в firing или resolved.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// NotifierConfig — настройки получателя уведомлений в файле правил.
+type NotifierConfig struct {
+	Type    string            `json:"type" yaml:"type"`                           // log или webhook
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`         // Адрес для webhook
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Дополнительные заголовки для webhook
+	Timeout config.Duration   `json:"timeout,omitempty" yaml:"timeout,omitempty"` // Таймаут доставки, по умолчанию 5s
+}
+
+// Validate проверяет настройки получателя.
+func (c NotifierConfig) Validate() error {
+	switch c.Type {
+	case NotifierLog:
+	case NotifierWebhook:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook: invalid url %q", c.URL)
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout: must not be negative")
+	}
+	return nil
+}
+
+// NewNotifier создает получателя по настройкам.
+func NewNotifier(cfg NotifierConfig, logger *zap.SugaredLogger) (Notifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout.Std()
+	if timeout == 0 {
+		timeout = defaultNotifyTimeout
+	}
+
+	switch cfg.Type {
+	case NotifierWebhook:
+		return &WebhookNotifier{
+			URL:     cfg.URL,
+			Headers: cfg.Headers,
+			Client:  &http.Client{Timeout: timeout},
+		}, nil
+	default:
+		return &LogNotifier{Logger: logger}, nil
+	}
+}
+
+// LogNotifier записывает уведомления в лог.
+type LogNotifier struct {
+	Logger *zap.SugaredLogger
+}
+
+// Notify записывает каждое оповещение отдельной строкой лога.
+func (n *LogNotifier) Notify(_ context.Context, alerts []Alert) error {
+	for _, a := range alerts {
+		n.Logger.Warnw("alert "+a.State,
+			"rule", a.Rule,
+			"metric", a.Metric,
+			"severity", a.Severity,
+			"value", a.Value,
+			"threshold", a.Threshold,
+		)
+	}
+	return nil
+}
+
+// WebhookNotifier отправляет уведомления POST-запросом с телом {"alerts": [...]}.
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// webhookPayload — тело запроса WebhookNotifier.
+type webhookPayload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Notify отправляет уведомления. Ответ со статусом, отличным от 2xx, считается ошибкой.
+func (n *WebhookNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(webhookPayload{Alerts: alerts})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", n.URL, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Уровни важности правил.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// comparisons — поддерживаемые операции сравнения значения метрики с порогом.
+var comparisons = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// ValidOp сообщает, поддерживается ли операция сравнения op.
+func ValidOp(op string) bool {
+	_, ok := comparisons[op]
+	return ok
+}
+
+// Compare сравнивает value с threshold операцией op. Для неизвестной операции возвращает false.
+func Compare(op string, value, threshold float64) bool {
+	cmp, ok := comparisons[op]
+	return ok && cmp(value, threshold)
+}
+
+// File — содержимое файла правил.
+type File struct {
+	Rules     []Rule           `json:"rules" yaml:"rules"`         // Правила оповещений
+	Notifiers []NotifierConfig `json:"notifiers" yaml:"notifiers"` // Получатели уведомлений
+}
+
+// Rule — правило оповещения: условие срабатывает, когда значение метрики,
+// подходящей под селектор, удовлетворяет сравнению с порогом. Оповещение переходит
+// в состояние firing, если условие выполняется непрерывно не меньше For.
+type Rule struct {
+	Name        string          `json:"name" yaml:"name"`                                   // Уникальное имя правила
+	Metric      string          `json:"metric" yaml:"metric"`                               // Селектор метрик: ID или шаблон с *, ? и [...]
+	Type        string          `json:"type,omitempty" yaml:"type,omitempty"`               // Тип метрики: gauge или counter, пусто — любой
+	Op          string          `json:"op" yaml:"op"`                                       // Сравнение: >, >=, <, <=, ==, !=
+	Threshold   float64         `json:"threshold" yaml:"threshold"`                         // Порог
+	For         config.Duration `json:"for" yaml:"for"`                                     // Сколько условие должно выполняться до срабатывания
+	Severity    string          `json:"severity" yaml:"severity"`                           // Важность: info, warning или critical
+	Description string          `json:"description,omitempty" yaml:"description,omitempty"` // Описание для уведомлений
+}
+
+// LoadFile читает и проверяет файл правил (JSON или YAML).
+func LoadFile(path string) (File, error) {
+	var f File
+	if err := config.LoadFile(path, &f); err != nil {
+		return File{}, err
+	}
+	if err := f.Validate(); err != nil {
+		return File{}, fmt.Errorf("rules file %s:\n%w", path, err)
+	}
+	return f, nil
+}
+
+// Validate проверяет правила и настройки получателей и возвращает все найденные ошибки.
+// Пустая важность правила заменяется на warning.
+func (f *File) Validate() error {
+	var errs []error
+	names := make(map[string]bool, len(f.Rules))
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if r.Severity == "" {
+			r.Severity = SeverityWarning
+		}
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+			continue
+		}
+		if names[r.Name] {
+			errs = append(errs, fmt.Errorf("rules[%d]: duplicate rule name %q", i, r.Name))
+		}
+		names[r.Name] = true
+	}
+	for i, n := range f.Notifiers {
+		if err := n.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("notifiers[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate проверяет правило.
+func (r Rule) Validate() error {
+	var errs []error
+	if r.Name == "" {
+		errs = append(errs, errors.New("name must not be empty"))
+	}
+	if r.Metric == "" {
+		errs = append(errs, errors.New("metric must not be empty"))
+	} else if _, err := path.Match(r.Metric, ""); err != nil {
+		errs = append(errs, fmt.Errorf("metric: invalid selector %q", r.Metric))
+	}
+	if r.Type != "" && r.Type != models.Gauge && r.Type != models.Counter {
+		errs = append(errs, fmt.Errorf("type: unknown metric type %q", r.Type))
+	}
+	if !ValidOp(r.Op) {
+		errs = append(errs, fmt.Errorf("op: unknown comparison %q", r.Op))
+	}
+	if r.For < 0 {
+		errs = append(errs, errors.New("for: must not be negative"))
+	}
+	switch r.Severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		errs = append(errs, fmt.Errorf("severity: unknown severity %q", r.Severity))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	return nil
+}
+
+// match сообщает, подходит ли метрика под селектор правила, и возвращает ее значение.
+func (r Rule) match(m models.Metrics) (float64, bool) {
+	if r.Type != "" && r.Type != m.MType {
+		return 0, false
+	}
+	if ok, _ := path.Match(r.Metric, m.ID); !ok {
+		return 0, false
+	}
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		return *m.Value, true
+	case m.MType == models.Counter && m.Delta != nil:
+		return float64(*m.Delta), true
+	}
+	return 0, false
+}
+
+// holds сообщает, выполняется ли условие правила для значения value.
+func (r Rule) holds(value float64) bool {
+	return Compare(r.Op, value, r.Threshold)
+}
@@ -0,0 +1,242 @@
+// Package apidoc содержит спецификацию OpenAPI 3 HTTP API сервера и отдает ее
+// по GET /openapi.json, а HTML-представление — по GET /docs.
+//
+// Спецификация встроена в бинарный файл из openapi.json. Контрактные тесты сервера
+// сверяют с ней маршруты роутера и ответы обработчиков, поэтому при изменении API
+// спецификацию нужно обновлять вместе с кодом.
+package apidoc
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// document — разобранная встроенная спецификация.
+var document = mustLoad()
+
+// Document — спецификация OpenAPI. Описаны только те поля, которые использует сервер.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info — общие сведения об API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// PathItem — операции пути по HTTP-методу в нижнем регистре.
+type PathItem map[string]*Operation
+
+// Operation — описание одной операции.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Deprecated  bool                 `json:"deprecated"` // Операция устарела и отвечает с заголовком Deprecation
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter — параметр операции или ссылка на параметр из components.
+type Parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody — тело запроса по типу содержимого.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response — ответ операции или ссылка на ответ из components.
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType — схема тела для одного типа содержимого.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema — схема значения. additionalProperties поддерживается только в виде true или false.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Enum                 []string           `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+}
+
+// Components — переиспользуемые части спецификации.
+type Components struct {
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+	Schemas    map[string]*Schema    `json:"schemas"`
+}
+
+// Load разбирает встроенную спецификацию и проверяет, что все ссылки $ref в ней разрешаются.
+func Load() (*Document, error) {
+	var d Document
+	if err := json.Unmarshal(spec, &d); err != nil {
+		return nil, fmt.Errorf("parse openapi.json: %w", err)
+	}
+	if err := d.checkRefs(); err != nil {
+		return nil, fmt.Errorf("openapi.json: %w", err)
+	}
+	return &d, nil
+}
+
+func mustLoad() *Document {
+	d, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Operation возвращает операцию для метода method и шаблона пути pattern
+// в синтаксисе chi, например /value/{type}/{id}.
+func (d *Document) Operation(method, pattern string) (*Operation, bool) {
+	op, ok := d.Paths[pattern][strings.ToLower(method)]
+	return op, ok && op != nil
+}
+
+// Operations возвращает все операции спецификации как пары "METHOD pattern", отсортированные по пути.
+func (d *Document) Operations() []string {
+	var ops []string
+	for pattern, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+pattern)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		pi, pj := ops[i][strings.IndexByte(ops[i], ' ')+1:], ops[j][strings.IndexByte(ops[j], ' ')+1:]
+		if pi != pj {
+			return pi < pj
+		}
+		return ops[i] < ops[j]
+	})
+	return ops
+}
+
+// parameter возвращает параметр, разрешая ссылку на components.
+func (d *Document) parameter(p *Parameter) *Parameter {
+	if p.Ref != "" {
+		return d.Components.Parameters[refName(p.Ref)]
+	}
+	return p
+}
+
+// response возвращает ответ, разрешая ссылку на components.
+func (d *Document) response(r *Response) *Response {
+	if r.Ref != "" {
+		return d.Components.Responses[refName(r.Ref)]
+	}
+	return r
+}
+
+// schema возвращает схему, разрешая ссылку на components.
+func (d *Document) schema(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[refName(s.Ref)]
+	}
+	return s
+}
+
+// refName возвращает имя компонента из ссылки вида #/components/schemas/Metric.
+func refName(ref string) string {
+	return ref[strings.LastIndexByte(ref, '/')+1:]
+}
+
+// checkRefs проверяет, что все ссылки спецификации указывают на существующие компоненты.
+func (d *Document) checkRefs() error {
+	var errs []string
+	check := func(ref, kind string, exists bool) {
+		if ref != "" && (!strings.HasPrefix(ref, "#/components/"+kind+"/") || !exists) {
+			errs = append(errs, "unresolved reference "+ref)
+		}
+	}
+	var checkSchema func(s *Schema)
+	checkSchema = func(s *Schema) {
+		if s == nil {
+			return
+		}
+		_, ok := d.Components.Schemas[refName(s.Ref)]
+		check(s.Ref, "schemas", ok)
+		for _, p := range s.Properties {
+			checkSchema(p)
+		}
+		checkSchema(s.Items)
+	}
+	checkContent := func(content map[string]*MediaType) {
+		for _, mt := range content {
+			checkSchema(mt.Schema)
+		}
+	}
+
+	for _, s := range d.Components.Schemas {
+		checkSchema(s)
+	}
+	for _, p := range d.Components.Parameters {
+		checkSchema(p.Schema)
+	}
+	for _, r := range d.Components.Responses {
+		checkContent(r.Content)
+	}
+	for _, item := range d.Paths {
+		for _, op := range item {
+			for _, p := range op.Parameters {
+				_, ok := d.Components.Parameters[refName(p.Ref)]
+				check(p.Ref, "parameters", ok)
+				checkSchema(p.Schema)
+			}
+			if op.RequestBody != nil {
+				checkContent(op.RequestBody.Content)
+			}
+			for _, r := range op.Responses {
+				_, ok := d.Components.Responses[refName(r.Ref)]
+				check(r.Ref, "responses", ok)
+				checkContent(r.Content)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Spec отдает спецификацию в формате JSON.
+func Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(spec)
+}
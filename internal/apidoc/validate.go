@@ -0,0 +1,144 @@
+package apidoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CheckResponse проверяет, что ответ со статусом status, типом содержимого contentType
+// и телом body описан в спецификации для операции method pattern. Тела JSON
+// (application/json и типы с суффиксом +json) проверяются по схеме целиком,
+// тела остальных типов — как строки. Ответ без описанного содержимого должен быть пустым.
+func (d *Document) CheckResponse(method, pattern string, status int, contentType string, body []byte) error {
+	op, ok := d.Operation(method, pattern)
+	if !ok {
+		return fmt.Errorf("operation %s %s is not documented", method, pattern)
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not documented", method, pattern, status)
+	}
+	resp = d.response(resp)
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s %d: expected empty body", method, pattern, status)
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: invalid Content-Type %q", method, pattern, status, contentType)
+	}
+	mt, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s %d: Content-Type %s is not documented", method, pattern, status, mediaType)
+	}
+	if mt.Schema == nil {
+		return nil
+	}
+
+	var value any = string(body)
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err = dec.Decode(&value); err != nil {
+			return fmt.Errorf("%s %s %d: invalid JSON body: %w", method, pattern, status, err)
+		}
+	}
+	if err = d.validate(mt.Schema, value, "body"); err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, pattern, status, err)
+	}
+	return nil
+}
+
+// validate проверяет значение v, разобранное из JSON с UseNumber, по схеме s.
+// path — путь к значению для сообщения об ошибке.
+func (d *Document) validate(s *Schema, v any, path string) error {
+	s = d.schema(s)
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", path, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: required property %q is missing", path, name)
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := d.validate(prop, obj[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", path, v)
+		}
+		for i, item := range arr {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", path, v)
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength || s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: string length %d is out of range", path, n)
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %v", path, str, s.Enum)
+		}
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %T", path, s.Type, v)
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return fmt.Errorf("%s: %s is not an integer", path, num)
+			}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", path, v)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
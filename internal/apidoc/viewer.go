@@ -0,0 +1,201 @@
+package apidoc
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// viewerTemplate — HTML-страница со спецификацией: операции по путям и схемы данных.
+var viewerTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Info.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 60em; }
+section { border: 1px solid #ddd; border-radius: 4px; margin: 1em 0; padding: 0.5em 1em; }
+h3 { margin: 0.3em 0; font-family: monospace; }
+.method { display: inline-block; min-width: 4em; padding: 2px 6px; border-radius: 3px; color: #fff; text-align: center; }
+.get { background: #1f7ab8; } .post { background: #2e9e4f; } .put { background: #c7881a; } .delete { background: #c0392b; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; vertical-align: top; }
+code { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<p>{{.Info.Description}}</p>
+<p>Machine-readable specification: <a href="/openapi.json">/openapi.json</a></p>
+<h2>Operations</h2>
+{{range .Operations}}<section id="{{.ID}}">
+<h3><span class="method {{.Class}}">{{.Method}}</span> {{if .Deprecated}}<s>{{.Path}}</s> <small>deprecated</small>{{else}}{{.Path}}{{end}}</h3>
+<p><b>{{.Summary}}</b>{{if .Description}}<br>{{.Description}}{{end}}</p>
+{{if .Params}}<table>
+<tr><th>Parameter</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{range .Params}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td><code>{{.Type}}</code></td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Body}}<p>Request body: {{range .Body}}<code>{{.}}</code> {{end}}</p>
+{{end}}<table>
+<tr><th>Status</th><th>Description</th><th>Content</th></tr>
+{{range .Responses}}<tr><td>{{.Status}}</td><td>{{.Description}}</td><td>{{range .Content}}<code>{{.}}</code><br>{{end}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}<h2>Schemas</h2>
+{{range .Schemas}}<section id="schema-{{.Name}}">
+<h3>{{.Name}}</h3>
+{{if .Type}}<p><code>{{.Type}}</code></p>
+{{end}}{{if .Props}}<table>
+<tr><th>Property</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{range .Props}}<tr><td><code>{{.Name}}</code></td><td><code>{{.Type}}</code></td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+// viewerData — данные HTML-страницы.
+type viewerData struct {
+	Info       Info
+	Operations []viewerOperation
+	Schemas    []viewerSchema
+}
+
+// viewerOperation — операция на HTML-странице.
+type viewerOperation struct {
+	ID, Method, Class, Path, Summary, Description string
+	Deprecated                                    bool
+	Params                                        []viewerField
+	Body                                          []string // Схемы тела запроса по типам содержимого
+	Responses                                     []viewerResponse
+}
+
+// viewerField — параметр операции или свойство схемы.
+type viewerField struct {
+	Name, In, Type, Description string
+	Required                    bool
+}
+
+// viewerResponse — ответ операции.
+type viewerResponse struct {
+	Status, Description string
+	Content             []string // Схемы тела ответа по типам содержимого
+}
+
+// viewerSchema — схема из components.
+type viewerSchema struct {
+	Name, Type string
+	Props      []viewerField
+}
+
+// Viewer отдает HTML-представление спецификации.
+func Viewer(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := viewerTemplate.Execute(&buf, document.viewerData()); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.Internal, "failed to render API docs: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+// viewerData собирает данные HTML-страницы: операции в порядке путей и схемы по имени.
+func (d *Document) viewerData() viewerData {
+	data := viewerData{Info: d.Info}
+	for _, name := range d.Operations() {
+		method, pattern, _ := strings.Cut(name, " ")
+		op, _ := d.Operation(method, pattern)
+
+		vo := viewerOperation{
+			ID:          op.OperationID,
+			Method:      method,
+			Class:       strings.ToLower(method),
+			Path:        pattern,
+			Summary:     op.Summary,
+			Description: op.Description,
+			Deprecated:  op.Deprecated,
+		}
+		for _, p := range op.Parameters {
+			p = d.parameter(p)
+			vo.Params = append(vo.Params, viewerField{
+				Name: p.Name, In: p.In, Type: schemaName(p.Schema), Description: p.Description, Required: p.Required,
+			})
+		}
+		if op.RequestBody != nil {
+			vo.Body = contentNames(op.RequestBody.Content)
+		}
+		statuses := make([]string, 0, len(op.Responses))
+		for status := range op.Responses {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		for _, status := range statuses {
+			resp := d.response(op.Responses[status])
+			vo.Responses = append(vo.Responses, viewerResponse{
+				Status: status, Description: resp.Description, Content: contentNames(resp.Content),
+			})
+		}
+		data.Operations = append(data.Operations, vo)
+	}
+
+	names := make([]string, 0, len(d.Components.Schemas))
+	for name := range d.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := d.Components.Schemas[name]
+		vs := viewerSchema{Name: name}
+		if len(s.Properties) == 0 {
+			vs.Type = schemaName(s)
+		}
+		props := make([]string, 0, len(s.Properties))
+		for p := range s.Properties {
+			props = append(props, p)
+		}
+		sort.Strings(props)
+		for _, p := range props {
+			vs.Props = append(vs.Props, viewerField{
+				Name: p, Type: schemaName(s.Properties[p]), Description: s.Properties[p].Description, Required: contains(s.Required, p),
+			})
+		}
+		data.Schemas = append(data.Schemas, vs)
+	}
+	return data
+}
+
+// contentNames описывает тело как "тип содержимого: схема" для каждого типа, по алфавиту.
+func contentNames(content map[string]*MediaType) []string {
+	names := make([]string, 0, len(content))
+	for mediaType, mt := range content {
+		names = append(names, mediaType+": "+schemaName(mt.Schema))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// schemaName возвращает краткое описание схемы: имя компонента, тип или перечисление значений.
+func schemaName(s *Schema) string {
+	switch {
+	case s == nil:
+		return "any"
+	case s.Ref != "":
+		return refName(s.Ref)
+	case s.Type == "array":
+		return schemaName(s.Items) + "[]"
+	case len(s.Enum) > 0:
+		return strings.Join(s.Enum, " | ")
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	case s.Type == "":
+		return "any"
+	default:
+		return s.Type
+	}
+}
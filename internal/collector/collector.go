@@ -0,0 +1,60 @@
+// Package collector содержит источники runtime-метрик для агента.
+// Поддерживаются три режима: сбор через runtime/metrics, устаревший сбор
+// через runtime.ReadMemStats и режим совместимости, в котором к метрикам
+// runtime/metrics добавляются старые имена из MemStats.
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Режимы сбора runtime-метрик.
+const (
+	ModeCompat   = "compat"   // runtime/metrics + устаревшие имена MemStats
+	ModeRuntime  = "runtime"  // только runtime/metrics
+	ModeMemStats = "memstats" // только runtime.ReadMemStats (останавливает мир)
+)
+
+// Collector — источник метрик, который опрашивается агентом на каждом цикле сбора.
+type Collector interface {
+	Collect() []models.Metrics
+}
+
+// CheckMode проверяет, что mode — известный режим сбора. Пустая строка означает режим совместимости.
+func CheckMode(mode string) error {
+	switch mode {
+	case ModeCompat, ModeRuntime, ModeMemStats, "":
+		return nil
+	default:
+		return fmt.Errorf("unknown runtime collector mode %q", mode)
+	}
+}
+
+// New создает сборщик runtime-метрик для указанного режима.
+func New(mode string) (Collector, error) {
+	if err := CheckMode(mode); err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case ModeRuntime:
+		return NewRuntime(false), nil
+	case ModeMemStats:
+		return NewMemStats(), nil
+	default:
+		return NewRuntime(true), nil
+	}
+}
+
+// gauge создает метрику типа gauge.
+func gauge(id string, value float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &value}
+}
+
+// counter создает метрику типа counter.
+func counter(id string, delta int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &delta}
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"runtime/metrics"
+	"testing"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(t *testing.T, mode string) map[string]models.Metrics {
+	c, err := New(mode)
+	require.NoError(t, err)
+
+	result := make(map[string]models.Metrics)
+	for _, m := range c.Collect() {
+		result[m.ID] = m
+	}
+	return result
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("unknown")
+	assert.Error(t, err)
+}
+
+func TestRuntime_Collect(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		present  []string
+		absent   []string
+		counters []string
+	}{
+		{
+			name:     "runtime mode",
+			mode:     ModeRuntime,
+			present:  []string{"go_gc_heap_allocs_bytes", "go_memory_classes_total_bytes", "go_sched_gomaxprocs_threads"},
+			absent:   []string{"Alloc", "HeapSys"},
+			counters: []string{"go_gc_heap_allocs_bytes", "go_gc_cycles_total_gc_cycles"},
+		},
+		{
+			name:    "compat mode",
+			mode:    ModeCompat,
+			present: append([]string{"go_gc_heap_allocs_bytes"}, legacyNames...),
+		},
+		{
+			name:    "memstats mode",
+			mode:    ModeMemStats,
+			present: legacyNames,
+			absent:  []string{"go_gc_heap_allocs_bytes"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collect(t, tt.mode)
+			for _, id := range tt.present {
+				assert.Contains(t, got, id)
+			}
+			for _, id := range tt.absent {
+				assert.NotContains(t, got, id)
+			}
+			for _, id := range tt.counters {
+				assert.Equal(t, models.Counter, got[id].MType, id)
+				assert.NotNil(t, got[id].Delta, id)
+			}
+		})
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 4, 1},
+		Buckets: []float64{0, 1, 2, 3},
+	}
+
+	p50, ok := quantile(h, 0.5)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, p50)
+
+	p90, _ := quantile(h, 0.9)
+	assert.Equal(t, 2.0, p90)
+
+	p99, _ := quantile(h, 0.99)
+	assert.Equal(t, 3.0, p99)
+
+	_, ok = quantile(&metrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1}}, 0.5)
+	assert.False(t, ok)
+}
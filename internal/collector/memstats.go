@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"runtime"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// MemStats собирает метрики через runtime.ReadMemStats.
+// Сохранен для обратной совместимости: ReadMemStats останавливает мир на время чтения.
+type MemStats struct{}
+
+// NewMemStats создает сборщик на основе runtime.ReadMemStats.
+func NewMemStats() *MemStats {
+	return &MemStats{}
+}
+
+// Collect читает runtime.MemStats и преобразует поля в gauge-метрики.
+func (c *MemStats) Collect() []models.Metrics {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	return []models.Metrics{
+		gauge("Alloc", float64(memStats.Alloc)),
+		gauge("BuckHashSys", float64(memStats.BuckHashSys)),
+		gauge("Frees", float64(memStats.Frees)),
+		gauge("GCCPUFraction", memStats.GCCPUFraction),
+		gauge("GCSys", float64(memStats.GCSys)),
+		gauge("HeapAlloc", float64(memStats.HeapAlloc)),
+		gauge("HeapIdle", float64(memStats.HeapIdle)),
+		gauge("HeapInuse", float64(memStats.HeapInuse)),
+		gauge("HeapObjects", float64(memStats.HeapObjects)),
+		gauge("HeapReleased", float64(memStats.HeapReleased)),
+		gauge("HeapSys", float64(memStats.HeapSys)),
+		gauge("LastGC", float64(memStats.LastGC)),
+		gauge("Lookups", float64(memStats.Lookups)),
+		gauge("MCacheInuse", float64(memStats.MCacheInuse)),
+		gauge("MCacheSys", float64(memStats.MCacheSys)),
+		gauge("MSpanInuse", float64(memStats.MSpanInuse)),
+		gauge("MSpanSys", float64(memStats.MSpanSys)),
+		gauge("Mallocs", float64(memStats.Mallocs)),
+		gauge("NextGC", float64(memStats.NextGC)),
+		gauge("NumForcedGC", float64(memStats.NumForcedGC)),
+		gauge("NumGC", float64(memStats.NumGC)),
+		gauge("OtherSys", float64(memStats.OtherSys)),
+		gauge("PauseTotalNs", float64(memStats.PauseTotalNs)),
+		gauge("StackInuse", float64(memStats.StackInuse)),
+		gauge("StackSys", float64(memStats.StackSys)),
+		gauge("Sys", float64(memStats.Sys)),
+		gauge("TotalAlloc", float64(memStats.TotalAlloc)),
+	}
+}
@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// quantiles — квантили, которые публикуются для каждой гистограммы runtime/metrics.
+var quantiles = []struct {
+	suffix string
+	q      float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// Runtime собирает все поддерживаемые метрики через пакет runtime/metrics,
+// который в отличие от ReadMemStats не останавливает мир.
+//
+// Правила преобразования:
+//   - накопительные uint64 — counter с накопленным значением в Delta;
+//   - остальные uint64 и все float64 — gauge;
+//   - Float64Histogram — набор gauge с квантилями p50, p90 и p99.
+type Runtime struct {
+	samples []metrics.Sample
+	kinds   []metrics.Description
+	legacy  bool // Добавлять ли метрики с именами полей runtime.MemStats
+}
+
+// NewRuntime создает сборщик runtime/metrics.
+// Если legacy равен true, дополнительно публикуются метрики с именами полей runtime.MemStats.
+func NewRuntime(legacy bool) *Runtime {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for i, d := range descs {
+		samples[i].Name = d.Name
+	}
+	return &Runtime{samples: samples, kinds: descs, legacy: legacy}
+}
+
+// Collect читает текущие значения runtime/metrics и преобразует их в формат models.Metrics.
+func (c *Runtime) Collect() []models.Metrics {
+	metrics.Read(c.samples)
+
+	result := make([]models.Metrics, 0, len(c.samples)+len(legacyNames))
+	for i, s := range c.samples {
+		id := metricID(s.Name)
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			if c.kinds[i].Cumulative {
+				result = append(result, counter(id, int64(s.Value.Uint64())))
+			} else {
+				result = append(result, gauge(id, float64(s.Value.Uint64())))
+			}
+		case metrics.KindFloat64:
+			result = append(result, gauge(id, s.Value.Float64()))
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			for _, q := range quantiles {
+				if v, ok := quantile(h, q.q); ok {
+					result = append(result, gauge(id+q.suffix, v))
+				}
+			}
+		}
+	}
+
+	if c.legacy {
+		result = append(result, c.legacyMetrics()...)
+	}
+	return result
+}
+
+// idReplacer заменяет разделители в именах runtime/metrics на подчеркивания.
+var idReplacer = strings.NewReplacer("/", "_", ":", "_", "-", "_")
+
+// metricID преобразует имя runtime/metrics вида /gc/heap/allocs:bytes
+// в идентификатор метрики go_gc_heap_allocs_bytes.
+func metricID(name string) string {
+	return "go" + idReplacer.Replace(name)
+}
+
+// quantile оценивает квантиль q по гистограмме как границу бакета,
+// в который попадает q-я доля наблюдений. Для пустой гистограммы возвращает false.
+func quantile(h *metrics.Float64Histogram, q float64) (float64, bool) {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		// Верхняя граница бакета, а для последнего бакета (+Inf) — нижняя.
+		upper := h.Buckets[i+1]
+		if math.IsInf(upper, 1) {
+			return h.Buckets[i], true
+		}
+		return upper, true
+	}
+	return h.Buckets[len(h.Buckets)-1], true
+}
+
+// legacyNames — имена полей runtime.MemStats, публикуемые в режиме совместимости.
+var legacyNames = []string{
+	"Alloc", "BuckHashSys", "Frees", "GCCPUFraction", "GCSys", "HeapAlloc", "HeapIdle", "HeapInuse",
+	"HeapObjects", "HeapReleased", "HeapSys", "LastGC", "Lookups", "MCacheInuse", "MCacheSys",
+	"MSpanInuse", "MSpanSys", "Mallocs", "NextGC", "NumForcedGC", "NumGC", "OtherSys", "PauseTotalNs",
+	"StackInuse", "StackSys", "Sys", "TotalAlloc",
+}
+
+// legacyMetrics вычисляет поля runtime.MemStats из уже прочитанных значений runtime/metrics
+// так же, как это делает сам runtime. LastGC и PauseTotalNs берутся из debug.ReadGCStats,
+// которому тоже не нужна остановка мира.
+func (c *Runtime) legacyMetrics() []models.Metrics {
+	v := make(map[string]float64, len(c.samples))
+	for _, s := range c.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v[s.Name] = float64(s.Value.Uint64())
+		case metrics.KindFloat64:
+			v[s.Name] = s.Value.Float64()
+		}
+	}
+
+	var gcStats debug.GCStats
+	debug.ReadGCStats(&gcStats)
+
+	heapAlloc := v["/memory/classes/heap/objects:bytes"]
+	heapIdle := v["/memory/classes/heap/released:bytes"] + v["/memory/classes/heap/free:bytes"]
+	heapInuse := heapAlloc + v["/memory/classes/heap/unused:bytes"]
+	stackInuse := v["/memory/classes/heap/stacks:bytes"]
+
+	var lastGC float64
+	if !gcStats.LastGC.IsZero() {
+		lastGC = float64(gcStats.LastGC.UnixNano())
+	}
+
+	var gcCPUFraction float64
+	if total := v["/cpu/classes/total:cpu-seconds"]; total > 0 {
+		gcCPUFraction = v["/cpu/classes/gc/total:cpu-seconds"] / total
+	}
+
+	values := map[string]float64{
+		"Alloc":         heapAlloc,
+		"BuckHashSys":   v["/memory/classes/profiling/buckets:bytes"],
+		"Frees":         v["/gc/heap/frees:objects"] + v["/gc/heap/tiny/allocs:objects"],
+		"GCCPUFraction": gcCPUFraction,
+		"GCSys":         v["/memory/classes/metadata/other:bytes"],
+		"HeapAlloc":     heapAlloc,
+		"HeapIdle":      heapIdle,
+		"HeapInuse":     heapInuse,
+		"HeapObjects":   v["/gc/heap/objects:objects"],
+		"HeapReleased":  v["/memory/classes/heap/released:bytes"],
+		"HeapSys":       heapIdle + heapInuse,
+		"LastGC":        lastGC,
+		"Lookups":       0, // Поле устарело и в современных версиях Go всегда равно нулю
+		"MCacheInuse":   v["/memory/classes/metadata/mcache/inuse:bytes"],
+		"MCacheSys":     v["/memory/classes/metadata/mcache/inuse:bytes"] + v["/memory/classes/metadata/mcache/free:bytes"],
+		"MSpanInuse":    v["/memory/classes/metadata/mspan/inuse:bytes"],
+		"MSpanSys":      v["/memory/classes/metadata/mspan/inuse:bytes"] + v["/memory/classes/metadata/mspan/free:bytes"],
+		"Mallocs":       v["/gc/heap/allocs:objects"] + v["/gc/heap/tiny/allocs:objects"],
+		"NextGC":        v["/gc/heap/goal:bytes"],
+		"NumForcedGC":   v["/gc/cycles/forced:gc-cycles"],
+		"NumGC":         v["/gc/cycles/total:gc-cycles"],
+		"OtherSys":      v["/memory/classes/other:bytes"],
+		"PauseTotalNs":  float64(gcStats.PauseTotal.Nanoseconds()),
+		"StackInuse":    stackInuse,
+		"StackSys":      stackInuse + v["/memory/classes/os-stacks:bytes"],
+		"Sys":           v["/memory/classes/total:bytes"],
+		"TotalAlloc":    v["/gc/heap/allocs:bytes"],
+	}
+
+	result := make([]models.Metrics, 0, len(legacyNames))
+	for _, name := range legacyNames {
+		result = append(result, gauge(name, values[name]))
+	}
+	return result
+}
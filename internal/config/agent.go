@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/collector"
+	"go.uber.org/zap/zapcore"
+)
+
+// Режимы работы агента.
+const (
+	ModePush = "push" // Агент сам отправляет метрики на сервер
+	ModePull = "pull" // Агент отдает метрики по HTTP, сервер забирает их сам
+)
+
+// AgentConfig содержит параметры конфигурации для агента.
+// Теги json и yaml задают ключи в файле конфигурации.
+type AgentConfig struct {
+	ConfigFile      string `json:"-" yaml:"-"`                               // Путь к файлу конфигурации
+	Mode            string `json:"mode" yaml:"mode"`                         // Режим работы: push или pull
+	ServerAddress   string `json:"address" yaml:"address"`                   // Адрес сервера для отправки метрик
+	PullAddress     string `json:"pull_address" yaml:"pull_address"`         // Адрес, на котором агент отдает метрики в режиме pull
+	PollInterval    int    `json:"poll_interval" yaml:"poll_interval"`       // Интервал сбора метрик (сек)
+	ReportInterval  int    `json:"report_interval" yaml:"report_interval"`   // Интервал отправки метрик на сервер (сек)
+	RuntimeMode     string `json:"runtime_mode" yaml:"runtime_mode"`         // Режим сбора runtime-метрик: compat, runtime или memstats
+	ShutdownTimeout int    `json:"shutdown_timeout" yaml:"shutdown_timeout"` // Время на финальную отправку метрик при остановке (сек)
+	IngestAddress   string `json:"ingest_address" yaml:"ingest_address"`     // Локальный адрес приема метрик приложений (host:port или unix:/path), пусто — выключено
+	StatsdAddress   string `json:"statsd_address" yaml:"statsd_address"`     // Адрес приема StatsD по UDP, пусто — выключено
+	StatsdTCP       bool   `json:"statsd_tcp" yaml:"statsd_tcp"`             // Принимать StatsD также по TCP на том же адресе
+	LogLevel        string `json:"log_level" yaml:"log_level"`               // Уровень логирования: debug, info, warn, error
+}
+
+// defaultAgentConfig возвращает значения конфигурации агента по умолчанию.
+func defaultAgentConfig() AgentConfig {
+	return AgentConfig{
+		Mode:            ModePush,
+		ServerAddress:   "localhost:8080",
+		PullAddress:     ":9100",
+		PollInterval:    3,
+		ReportInterval:  10,
+		RuntimeMode:     collector.ModeCompat,
+		ShutdownTimeout: 10,
+		LogLevel:        "info",
+	}
+}
+
+// agentFlagFields копирует значение явно заданного флага в конфигурацию.
+var agentFlagFields = map[string]func(dst, src *AgentConfig){
+	"c":          func(dst, src *AgentConfig) { dst.ConfigFile = src.ConfigFile },
+	"mode":       func(dst, src *AgentConfig) { dst.Mode = src.Mode },
+	"a":          func(dst, src *AgentConfig) { dst.ServerAddress = src.ServerAddress },
+	"pull":       func(dst, src *AgentConfig) { dst.PullAddress = src.PullAddress },
+	"p":          func(dst, src *AgentConfig) { dst.PollInterval = src.PollInterval },
+	"r":          func(dst, src *AgentConfig) { dst.ReportInterval = src.ReportInterval },
+	"m":          func(dst, src *AgentConfig) { dst.RuntimeMode = src.RuntimeMode },
+	"t":          func(dst, src *AgentConfig) { dst.ShutdownTimeout = src.ShutdownTimeout },
+	"i":          func(dst, src *AgentConfig) { dst.IngestAddress = src.IngestAddress },
+	"s":          func(dst, src *AgentConfig) { dst.StatsdAddress = src.StatsdAddress },
+	"statsd-tcp": func(dst, src *AgentConfig) { dst.StatsdTCP = src.StatsdTCP },
+	"l":          func(dst, src *AgentConfig) { dst.LogLevel = src.LogLevel },
+}
+
+// agentFlagSet создает набор флагов агента, записывающий значения в v.
+func agentFlagSet(v *AgentConfig) *flag.FlagSet {
+	def := defaultAgentConfig()
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+
+	fs.StringVar(&v.ConfigFile, "c", "", "config file (JSON or YAML)")
+	fs.StringVar(&v.Mode, "mode", def.Mode, "agent mode (push, pull)")
+	fs.StringVar(&v.ServerAddress, "a", def.ServerAddress, "server address")
+	fs.StringVar(&v.PullAddress, "pull", def.PullAddress, "address to expose metrics on in pull mode")
+	fs.IntVar(&v.PollInterval, "p", def.PollInterval, "pollInterval")
+	fs.IntVar(&v.ReportInterval, "r", def.ReportInterval, "reportInterval")
+	fs.StringVar(&v.RuntimeMode, "m", def.RuntimeMode, "runtime metrics mode (compat, runtime, memstats)")
+	fs.IntVar(&v.ShutdownTimeout, "t", def.ShutdownTimeout, "shutdown timeout")
+	fs.StringVar(&v.IngestAddress, "i", def.IngestAddress, "local ingestion address (host:port or unix:/path)")
+	fs.StringVar(&v.StatsdAddress, "s", def.StatsdAddress, "statsd UDP listen address")
+	fs.BoolVar(&v.StatsdTCP, "statsd-tcp", def.StatsdTCP, "also accept statsd over TCP")
+	fs.StringVar(&v.LogLevel, "l", def.LogLevel, "log level (debug, info, warn, error)")
+	return fs
+}
+
+// LoadAgentConfig собирает конфигурацию агента из аргументов командной строки args
+// (без имени программы) и переменных окружения env и проверяет ее.
+// Приоритет: флаги командной строки → переменные окружения → файл конфигурации → значения по умолчанию.
+// Путь к файлу задается флагом -c или переменной окружения CONFIG.
+// Функцию можно вызывать повторно, чтобы перечитать файл конфигурации.
+func LoadAgentConfig(args []string, env map[string]string) (AgentConfig, error) {
+	var flags AgentConfig
+	set, err := parseFlags(agentFlagSet(&flags), args)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+
+	cfg := defaultAgentConfig()
+	e := &envSource{vars: env}
+	e.String("CONFIG", &cfg.ConfigFile)
+	if set["c"] {
+		cfg.ConfigFile = flags.ConfigFile
+	}
+	if cfg.ConfigFile != "" {
+		if err = LoadFile(cfg.ConfigFile, &cfg); err != nil {
+			return AgentConfig{}, err
+		}
+	}
+
+	e.String("AGENT_MODE", &cfg.Mode)
+	e.String("ADDRESS", &cfg.ServerAddress)
+	e.String("PULL_ADDRESS", &cfg.PullAddress)
+	e.Int("POLL_INTERVAL", &cfg.PollInterval)
+	e.Int("REPORT_INTERVAL", &cfg.ReportInterval)
+	e.String("RUNTIME_MODE", &cfg.RuntimeMode)
+	e.Int("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	e.String("INGEST_ADDRESS", &cfg.IngestAddress)
+	e.String("STATSD_ADDRESS", &cfg.StatsdAddress)
+	e.Bool("STATSD_TCP", &cfg.StatsdTCP)
+	e.String("LOG_LEVEL", &cfg.LogLevel)
+	if err = e.Err(); err != nil {
+		return AgentConfig{}, err
+	}
+
+	for name := range set {
+		agentFlagFields[name](&cfg, &flags)
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return AgentConfig{}, err
+	}
+	return cfg, nil
+}
+
+// GetAgentConfig возвращает конфигурацию агента при запуске и выводит ее параметры.
+func GetAgentConfig(args []string, env map[string]string) (AgentConfig, error) {
+	cfg, err := LoadAgentConfig(args, env)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+
+	fmt.Println("Config File:", cfg.ConfigFile)
+	fmt.Println("Mode:", cfg.Mode)
+	fmt.Println("Server Address:", cfg.ServerAddress)
+	fmt.Println("Pull Address:", cfg.PullAddress)
+	fmt.Println("Report Interval:", cfg.ReportInterval)
+	fmt.Println("Poll Interval:", cfg.PollInterval)
+	fmt.Println("Runtime Mode:", cfg.RuntimeMode)
+	fmt.Println("Shutdown Timeout:", cfg.ShutdownTimeout)
+	fmt.Println("Ingest Address:", cfg.IngestAddress)
+	fmt.Println("StatsD Address:", cfg.StatsdAddress)
+	fmt.Println("Log Level:", cfg.LogLevel)
+
+	return cfg, nil
+}
+
+// Validate проверяет конфигурацию агента и возвращает все найденные ошибки.
+func (c AgentConfig) Validate() error {
+	var errs []error
+	switch c.Mode {
+	case ModePush:
+		if c.ServerAddress == "" {
+			errs = append(errs, errors.New("address must not be empty"))
+		}
+	case ModePull:
+		if _, _, err := net.SplitHostPort(c.PullAddress); err != nil {
+			errs = append(errs, fmt.Errorf("pull_address: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mode: unknown mode %q, expected %s or %s", c.Mode, ModePush, ModePull))
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("poll_interval must be positive, got %d", c.PollInterval))
+	}
+	if c.ReportInterval <= 0 {
+		errs = append(errs, fmt.Errorf("report_interval must be positive, got %d", c.ReportInterval))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout must not be negative, got %d", c.ShutdownTimeout))
+	}
+	if err := collector.CheckMode(c.RuntimeMode); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	return errors.Join(errs...)
+}
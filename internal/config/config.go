@@ -1,83 +1,194 @@
 // Package config содержит функции и структуры для конфигурирования агента и сервера.
-// Позволяет получать параметры из переменных окружения и флагов командной строки.
+// Позволяет получать параметры из файла конфигурации, переменных окружения и флагов командной строки.
 
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-// AgentConfig содержит параметры конфигурации для агента.
-type AgentConfig struct {
-	ServerAddress  string // Адрес сервера для отправки метрик
-	PollInterval   int    // Интервал сбора метрик (сек)
-	ReportInterval int    // Интервал отправки метрик на сервер (сек)
+// Environ возвращает переменные окружения процесса в виде map для функций загрузки конфигурации.
+func Environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// envSource читает значения из переменных окружения и накапливает ошибки разбора,
+// чтобы сообщить обо всех некорректных переменных сразу.
+// Отсутствующая переменная оставляет значение dst без изменений.
+type envSource struct {
+	vars map[string]string
+	errs []error
+}
+
+// lookup возвращает значение переменной name и признак того, что она задана.
+func (e *envSource) lookup(name string) (string, bool) {
+	value, ok := e.vars[name]
+	return value, ok
+}
+
+// addErr запоминает ошибку разбора переменной name.
+func (e *envSource) addErr(name, value string, err error) {
+	e.errs = append(e.errs, fmt.Errorf("env %s=%q: %w", name, value, err))
+}
+
+// String записывает в dst строковое значение переменной name.
+func (e *envSource) String(name string, dst *string) {
+	if value, ok := e.lookup(name); ok {
+		*dst = value
+	}
+}
+
+// Int записывает в dst значение переменной name как int.
+func (e *envSource) Int(name string, dst *int) {
+	if value, ok := e.lookup(name); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			e.addErr(name, value, errors.New("must be an integer"))
+			return
+		}
+		*dst = parsed
+	}
+}
+
+// Int64 записывает в dst значение переменной name как int64.
+func (e *envSource) Int64(name string, dst *int64) {
+	if value, ok := e.lookup(name); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.addErr(name, value, errors.New("must be an integer"))
+			return
+		}
+		*dst = parsed
+	}
 }
 
-// ServerConfig содержит параметры конфигурации для сервера.
-type ServerConfig struct {
-	Address string // Адрес, на котором запускается сервер
+// Bool записывает в dst значение переменной name как bool.
+func (e *envSource) Bool(name string, dst *bool) {
+	if value, ok := e.lookup(name); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.addErr(name, value, errors.New("must be a boolean"))
+			return
+		}
+		*dst = parsed
+	}
 }
 
-// getEnvOrDefaultString возвращает значение переменной окружения envVar,
-// либо defaultValue, если переменная не установлена.
-func getEnvOrDefaultString(envVar string, defaultValue string) string {
-	if value, ok := os.LookupEnv(envVar); ok {
-		return value
+// Duration записывает в dst значение переменной name как Duration.
+func (e *envSource) Duration(name string, dst *Duration) {
+	if value, ok := e.lookup(name); ok {
+		parsed, err := ParseDuration(value)
+		if err != nil {
+			e.addErr(name, value, err)
+			return
+		}
+		*dst = parsed
 	}
-	return defaultValue
 }
 
-// getEnvOrDefaultInt возвращает значение переменной окружения envVar как int,
-// либо defaultValue, если переменная не установлена или не может быть преобразована.
-func getEnvOrDefaultInt(envVar string, defaultValue int) int {
-	if value, ok := os.LookupEnv(envVar); ok {
-		if parsedValue, err := strconv.Atoi(value); err == nil {
-			return parsedValue
+// Durations записывает в dst значение переменной name как список длительностей через запятую.
+func (e *envSource) Durations(name string, dst *[]Duration) {
+	if value, ok := e.lookup(name); ok {
+		parsed, err := parseDurationList(value)
+		if err != nil {
+			e.addErr(name, value, err)
+			return
 		}
+		*dst = parsed
 	}
-	return defaultValue
 }
 
-// GetAgentConfig возвращает конфигурацию агента.
-// Приоритет: переменные окружения → флаги командной строки → значения по умолчанию.
-func GetAgentConfig() AgentConfig {
-	cfg := AgentConfig{
-		ServerAddress:  getEnvOrDefaultString("ADDRESS", "localhost:8080"),
-		PollInterval:   getEnvOrDefaultInt("POLL_INTERVAL", 3),
-		ReportInterval: getEnvOrDefaultInt("REPORT_INTERVAL", 10),
+// List записывает в dst значение переменной name, разделенное запятыми.
+func (e *envSource) List(name string, dst *[]string) {
+	if value, ok := e.lookup(name); ok {
+		*dst = splitList(value)
 	}
+}
+
+// Err возвращает все накопленные ошибки разбора.
+func (e *envSource) Err() error {
+	return errors.Join(e.errs...)
+}
 
-	pollInterval := flag.Int("p", cfg.PollInterval, "pollInterval")
-	reportInterval := flag.Int("r", cfg.ReportInterval, "reportInterval")
-	serverAddress := flag.String("a", cfg.ServerAddress, "server address")
-	flag.Parse()
+// listValue — флаг со списком значений через запятую.
+type listValue []string
 
-	cfg.PollInterval = *pollInterval
-	cfg.ReportInterval = *reportInterval
-	cfg.ServerAddress = *serverAddress
+// String реализует flag.Value.
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
 
-	fmt.Println("Server Address:", cfg.ServerAddress)
-	fmt.Println("Report Interval:", cfg.ReportInterval)
-	fmt.Println("Poll Interval:", cfg.PollInterval)
+// Set реализует flag.Value.
+func (l *listValue) Set(s string) error {
+	*l = splitList(s)
+	return nil
+}
 
-	return cfg
+// splitList разбивает строку по запятым, отбрасывая пробелы и пустые элементы.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
 
-// GetServerConfig возвращает конфигурацию сервера.
-// Приоритет: переменная окружения ADDRESS → флаг командной строки → значение по умолчанию.
-func GetServerConfig() ServerConfig {
-	cfg := ServerConfig{
-		Address: getEnvOrDefaultString("ADDRESS", "localhost:8080"),
+// parseFlags разбирает args набором флагов fs и возвращает имена флагов, заданных явно.
+// Значения незаданных флагов не переопределяют конфигурацию из других источников.
+func parseFlags(fs *flag.FlagSet, args []string) (map[string]bool, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
 	}
-	serverAddress := flag.String("a", cfg.Address, "server address")
-	flag.Parse()
 
-	cfg.Address = *serverAddress
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set, nil
+}
 
-	fmt.Println("Server Address:", cfg.Address)
-	return cfg
+// LoadFile читает файл конфигурации в dst. Формат определяется по расширению:
+// .yaml и .yml — YAML, остальные — JSON. Ключи, отсутствующие в файле, не изменяют
+// уже заполненные поля dst, а неизвестные ключи считаются ошибкой.
+func LoadFile(path string, dst any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(dst)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(dst)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
 }
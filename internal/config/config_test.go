@@ -0,0 +1,328 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func Test_loadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    AgentConfig
+		wantErr bool
+	}{
+		{
+			name:    "json keeps defaults for missing keys",
+			file:    "agent.json",
+			content: `{"address": "metrics:8080", "poll_interval": 5}`,
+			want:    AgentConfig{ServerAddress: "metrics:8080", PollInterval: 5, ReportInterval: 10},
+		},
+		{
+			name:    "yaml",
+			file:    "agent.yaml",
+			content: "report_interval: 30\nlog_level: debug\n",
+			want:    AgentConfig{PollInterval: 3, ReportInterval: 30, LogLevel: "debug"},
+		},
+		{
+			name:    "unknown json key",
+			file:    "agent.json",
+			content: `{"pol_interval": 5}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown yaml key",
+			file:    "agent.yml",
+			content: "pol_interval: 5\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AgentConfig{PollInterval: 3, ReportInterval: 10}
+			err := LoadFile(writeFile(t, tt.file, tt.content), &cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "10s", want: 10 * time.Second},
+		{in: "1m30s", want: 90 * time.Second},
+		{in: "500ms", want: 500 * time.Millisecond},
+		{in: "15", want: 15 * time.Second},
+		{in: "ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDuration(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d.Std())
+		})
+	}
+}
+
+func Test_loadFileServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "yaml",
+			file:    "server.yaml",
+			content: "address: :9090\nstorage:\n  backend: file\n  dsn: /tmp/metrics.json\n  store_interval: 1m\nlimits:\n  read_timeout: 5s\n",
+		},
+		{
+			name:    "json",
+			file:    "server.json",
+			content: `{"address": ":9090", "storage": {"backend": "file", "dsn": "/tmp/metrics.json", "store_interval": "1m"}, "limits": {"read_timeout": 5}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultServerConfig()
+			require.NoError(t, LoadFile(writeFile(t, tt.file, tt.content), &cfg))
+
+			assert.Equal(t, ":9090", cfg.Address)
+			assert.Equal(t, StorageFile, cfg.Storage.Backend)
+			assert.Equal(t, time.Minute, cfg.Storage.StoreInterval.Std())
+			assert.True(t, cfg.Storage.Restore)
+			assert.Equal(t, 5*time.Second, cfg.Limits.ReadTimeout.Std())
+			assert.Equal(t, 10*time.Second, cfg.Limits.WriteTimeout.Std())
+			assert.NoError(t, cfg.Validate())
+		})
+	}
+}
+
+func TestServerConfig_Validate(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.Address = "localhost"
+	cfg.LogLevel = "verbose"
+	cfg.Storage.Backend = StorageFile
+	cfg.TLS.CertFile = "cert.pem"
+	cfg.Limits.MaxBodyBytes = 0
+	cfg.History.RateWindows = []Duration{Duration(2 * time.Hour)}
+	cfg.Graphite.Rules = []GraphiteRule{{Glob: "collectd.*", Regex: "collectd"}, {Regex: "("}}
+	cfg.RemoteWrite.URL = "tsdb:9009/api/v1/push"
+	cfg.RemoteWrite.Shards = 0
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, field := range []string{"address", "log_level", "storage.dsn", "tls", "limits.max_body_bytes",
+		"history.rate_windows", "graphite.rules[0]", "graphite.rules[1].regex",
+		"remote_write.url", "remote_write.shards"} {
+		assert.Contains(t, err.Error(), field+":")
+	}
+}
+
+func TestServerConfig_Print(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.Key = "hmac-key"
+	cfg.Storage.DSN = "postgres://metrics:hunter2@db:5432/metrics"
+	cfg.Webhooks.Endpoints = []WebhookEndpoint{{URL: "http://hooks:8080", Secret: "webhook-secret"}}
+	cfg.RemoteWrite.BearerToken = "remote-token"
+
+	var buf bytes.Buffer
+	require.NoError(t, cfg.Print(&buf))
+
+	out := buf.String()
+	assert.NotContains(t, out, "hmac-key")
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "webhook-secret")
+	assert.NotContains(t, out, "remote-token")
+	assert.Contains(t, out, "key: REDACTED")
+	assert.Contains(t, out, "store_interval: 5m0s")
+	assert.Equal(t, "hmac-key", cfg.Key)
+	assert.Equal(t, "webhook-secret", cfg.Webhooks.Endpoints[0].Secret)
+}
+
+func TestLoadAgentConfig(t *testing.T) {
+	file := writeFile(t, "agent.yaml", "address: file:8080\npoll_interval: 5\nreport_interval: 20\n")
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    func(cfg *AgentConfig)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *AgentConfig) {},
+		},
+		{
+			name: "file overrides defaults",
+			args: []string{"-c", file},
+			want: func(cfg *AgentConfig) {
+				cfg.ConfigFile = file
+				cfg.ServerAddress = "file:8080"
+				cfg.PollInterval = 5
+				cfg.ReportInterval = 20
+			},
+		},
+		{
+			name: "env overrides file",
+			env:  map[string]string{"CONFIG": file, "ADDRESS": "env:8080", "POLL_INTERVAL": "7"},
+			want: func(cfg *AgentConfig) {
+				cfg.ConfigFile = file
+				cfg.ServerAddress = "env:8080"
+				cfg.PollInterval = 7
+				cfg.ReportInterval = 20
+			},
+		},
+		{
+			name: "flags override env",
+			args: []string{"-a", "flag:8080", "-p", "9"},
+			env:  map[string]string{"CONFIG": file, "ADDRESS": "env:8080", "POLL_INTERVAL": "7"},
+			want: func(cfg *AgentConfig) {
+				cfg.ConfigFile = file
+				cfg.ServerAddress = "flag:8080"
+				cfg.PollInterval = 9
+				cfg.ReportInterval = 20
+			},
+		},
+		{
+			name: "flag -c overrides CONFIG",
+			args: []string{"-c", file},
+			env:  map[string]string{"CONFIG": "missing.yaml"},
+			want: func(cfg *AgentConfig) {
+				cfg.ConfigFile = file
+				cfg.ServerAddress = "file:8080"
+				cfg.PollInterval = 5
+				cfg.ReportInterval = 20
+			},
+		},
+		{
+			name:    "malformed env integers",
+			env:     map[string]string{"POLL_INTERVAL": "3s", "REPORT_INTERVAL": "ten"},
+			wantErr: "POLL_INTERVAL",
+		},
+		{
+			name:    "malformed flag",
+			args:    []string{"-p", "3s"},
+			wantErr: "invalid value",
+		},
+		{
+			name:    "positional arguments",
+			args:    []string{"extra"},
+			wantErr: "unexpected arguments",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadAgentConfig(tt.args, tt.env)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			want := defaultAgentConfig()
+			tt.want(&want)
+			assert.Equal(t, want, cfg)
+		})
+	}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	file := writeFile(t, "server.json", `{"address": "file:8080", "storage": {"store_interval": "1m"}, "limits": {"max_body_bytes": 1024}}`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    func(cfg *ServerConfig)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *ServerConfig) {},
+		},
+		{
+			name: "file overrides defaults",
+			env:  map[string]string{"CONFIG": file},
+			want: func(cfg *ServerConfig) {
+				cfg.ConfigFile = file
+				cfg.Address = "file:8080"
+				cfg.Storage.StoreInterval = Duration(time.Minute)
+				cfg.Limits.MaxBodyBytes = 1024
+			},
+		},
+		{
+			name: "env overrides file",
+			env:  map[string]string{"CONFIG": file, "STORE_INTERVAL": "30s", "MAX_BODY_BYTES": "2048"},
+			want: func(cfg *ServerConfig) {
+				cfg.ConfigFile = file
+				cfg.Address = "file:8080"
+				cfg.Storage.StoreInterval = Duration(30 * time.Second)
+				cfg.Limits.MaxBodyBytes = 2048
+			},
+		},
+		{
+			name: "flags override env",
+			args: []string{"-i", "15", "-a", "flag:8080", "-print-config"},
+			env:  map[string]string{"CONFIG": file, "STORE_INTERVAL": "30s", "ADDRESS": "env:8080"},
+			want: func(cfg *ServerConfig) {
+				cfg.ConfigFile = file
+				cfg.PrintConfig = true
+				cfg.Address = "flag:8080"
+				cfg.Storage.StoreInterval = Duration(15 * time.Second)
+				cfg.Limits.MaxBodyBytes = 1024
+			},
+		},
+		{
+			name:    "malformed env values are reported together",
+			env:     map[string]string{"MAX_BODY_BYTES": "1MB", "RESTORE": "maybe"},
+			wantErr: "RESTORE",
+		},
+		{
+			name:    "invalid config",
+			args:    []string{"-storage", "disk"},
+			wantErr: "storage.backend",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadServerConfig(tt.args, tt.env)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			want := defaultServerConfig()
+			tt.want(&want)
+			assert.Equal(t, want, cfg)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration — длительность в конфигурации. Принимает значения с единицами измерения
+// (10s, 1m30s, 500ms) и, для обратной совместимости, целое число секунд.
+type Duration time.Duration
+
+// ParseDuration разбирает длительность с единицами измерения или целое число секунд.
+func ParseDuration(s string) (Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return Duration(time.Duration(n) * time.Second), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return Duration(d), nil
+}
+
+// Std возвращает значение как time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String реализует fmt.Stringer и flag.Value.
+func (d *Duration) String() string {
+	return time.Duration(*d).String()
+}
+
+// Set реализует flag.Value.
+func (d *Duration) Set(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// MarshalText записывает длительность с единицами измерения.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText разбирает длительность из строки.
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// UnmarshalJSON разбирает длительность из строки или числа секунд.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		return d.Set(n.String())
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return d.Set(s)
+}
+
+// UnmarshalYAML разбирает длительность из строки или числа секунд.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: duration must be a scalar", node.Line)
+	}
+	return d.Set(node.Value)
+}
+
+// durationList — флаг со списком длительностей через запятую.
+type durationList []Duration
+
+// String реализует flag.Value.
+func (l *durationList) String() string {
+	items := make([]string, len(*l))
+	for i, d := range *l {
+		items[i] = d.Std().String()
+	}
+	return strings.Join(items, ",")
+}
+
+// Set реализует flag.Value.
+func (l *durationList) Set(s string) error {
+	list, err := parseDurationList(s)
+	if err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// parseDurationList разбирает список длительностей через запятую.
+func parseDurationList(s string) ([]Duration, error) {
+	var list []Duration
+	for _, item := range splitList(s) {
+		d, err := ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
@@ -0,0 +1,605 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// Поддерживаемые бэкенды хранилища метрик.
+const (
+	StorageMemory = "memory" // Только в оперативной памяти
+	StorageFile   = "file"   // В памяти с периодическим сохранением в JSON-файл, DSN — путь к файлу
+)
+
+// redacted заменяет значения секретов при выводе конфигурации.
+const redacted = "REDACTED"
+
+// ServerConfig содержит параметры конфигурации для сервера.
+// Теги json и yaml задают ключи в файле конфигурации.
+type ServerConfig struct {
+	ConfigFile      string            `json:"-" yaml:"-"`                               // Путь к файлу конфигурации
+	PrintConfig     bool              `json:"-" yaml:"-"`                               // Вывести итоговую конфигурацию и завершиться
+	Address         string            `json:"address" yaml:"address"`                   // Адрес, на котором запускается сервер
+	ShutdownTimeout Duration          `json:"shutdown_timeout" yaml:"shutdown_timeout"` // Время на завершение обрабатываемых запросов при остановке
+	LogLevel        string            `json:"log_level" yaml:"log_level"`               // Уровень логирования: debug, info, warn, error
+	Key             string            `json:"key" yaml:"key"`                           // Ключ для подписи HMAC-SHA256: проверяет подписанные запросы и подписывает ответы, пусто — без подписи
+	Storage         StorageConfig     `json:"storage" yaml:"storage"`                   // Хранилище метрик
+	TLS             TLSConfig         `json:"tls" yaml:"tls"`                           // Параметры HTTPS
+	Limits          LimitsConfig      `json:"limits" yaml:"limits"`                     // Ограничения на запросы
+	Scrape          ScrapeConfig      `json:"scrape" yaml:"scrape"`                     // Сбор метрик с агентов в режиме pull
+	Alerting        AlertingConfig    `json:"alerting" yaml:"alerting"`                 // Правила оповещений
+	Webhooks        WebhooksConfig    `json:"webhooks" yaml:"webhooks"`                 // Исходящие уведомления об изменении метрик
+	History         HistoryConfig     `json:"history" yaml:"history"`                   // История значений для запросов /query
+	Influx          InfluxConfig      `json:"influx" yaml:"influx"`                     // Прием метрик в формате InfluxDB line protocol
+	Graphite        GraphiteConfig    `json:"graphite" yaml:"graphite"`                 // Прием метрик по протоколу Graphite plaintext
+	OTLP            OTLPConfig        `json:"otlp" yaml:"otlp"`                         // Прием метрик OpenTelemetry через POST /v1/metrics
+	RemoteWrite     RemoteWriteConfig `json:"remote_write" yaml:"remote_write"`         // Отправка метрик во внешнее хранилище по протоколу Prometheus remote write
+}
+
+// StorageConfig содержит параметры хранилища метрик.
+type StorageConfig struct {
+	Backend       string   `json:"backend" yaml:"backend"`               // Бэкенд хранилища: memory или file
+	DSN           string   `json:"dsn" yaml:"dsn"`                       // Строка подключения, для бэкенда file — путь к файлу
+	StoreInterval Duration `json:"store_interval" yaml:"store_interval"` // Интервал сохранения, 0 — сохранять при каждом изменении
+	Restore       bool     `json:"restore" yaml:"restore"`               // Загружать ли сохраненные метрики при запуске
+}
+
+// TLSConfig содержит пути к сертификату и ключу. Если оба пусты, сервер работает по HTTP.
+type TLSConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"` // Путь к сертификату в формате PEM
+	KeyFile  string `json:"key_file" yaml:"key_file"`   // Путь к закрытому ключу в формате PEM
+}
+
+// Enabled сообщает, что сервер должен работать по HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// LimitsConfig содержит ограничения на размер и длительность запросов.
+type LimitsConfig struct {
+	MaxBodyBytes int64    `json:"max_body_bytes" yaml:"max_body_bytes"` // Максимальный размер тела запроса
+	ReadTimeout  Duration `json:"read_timeout" yaml:"read_timeout"`     // Таймаут чтения запроса
+	WriteTimeout Duration `json:"write_timeout" yaml:"write_timeout"`   // Таймаут записи ответа
+	IdleTimeout  Duration `json:"idle_timeout" yaml:"idle_timeout"`     // Таймаут простоя keep-alive соединения
+}
+
+// ScrapeConfig содержит параметры сбора метрик с агентов, работающих в режиме pull.
+// Сбор включен, если задан хотя бы один статический адрес или файл со списком адресов.
+type ScrapeConfig struct {
+	Targets     []string `json:"targets" yaml:"targets"`           // Статический список агентов: host:port или URL
+	TargetsFile string   `json:"targets_file" yaml:"targets_file"` // Файл со списком агентов (JSON или YAML), перечитывается при изменении
+	Interval    Duration `json:"interval" yaml:"interval"`         // Интервал опроса агентов
+	Timeout     Duration `json:"timeout" yaml:"timeout"`           // Таймаут одного опроса
+}
+
+// Enabled сообщает, что сервер должен опрашивать агентов.
+func (c ScrapeConfig) Enabled() bool {
+	return len(c.Targets) > 0 || c.TargetsFile != ""
+}
+
+// AlertingConfig содержит параметры вычисления правил оповещений.
+// Правила и получатели уведомлений описываются в отдельном файле RulesFile.
+type AlertingConfig struct {
+	RulesFile string   `json:"rules_file" yaml:"rules_file"` // Файл правил (JSON или YAML), пусто — оповещения выключены
+	Interval  Duration `json:"interval" yaml:"interval"`     // Интервал вычисления правил
+}
+
+// Enabled сообщает, что сервер должен вычислять правила оповещений.
+func (c AlertingConfig) Enabled() bool {
+	return c.RulesFile != ""
+}
+
+// HistoryConfig содержит параметры хранения истории значений метрик.
+// История хранится только в памяти и нужна функциям над интервалами в запросах /query,
+// а также для расчета скорости изменения счетчиков.
+type HistoryConfig struct {
+	Retention   Duration   `json:"retention" yaml:"retention"`       // Сколько хранить значения
+	MaxSamples  int        `json:"max_samples" yaml:"max_samples"`   // Максимальное число значений одной метрики
+	RateWindows []Duration `json:"rate_windows" yaml:"rate_windows"` // Интервалы, за которые считаются скорость и прирост счетчиков
+}
+
+// InfluxConfig содержит параметры приема метрик в формате InfluxDB line protocol через POST /write.
+// Каждое поле строки становится отдельной метрикой, ID которой строится по шаблону Template.
+//
+// В шаблоне доступны подстановки {measurement}, {field}, {tags} — теги, не использованные
+// в шаблоне явно, в формате ;key=value — и {имя_тега} — значение конкретного тега.
+type InfluxConfig struct {
+	Template string   `json:"template" yaml:"template"` // Шаблон ID метрики
+	Counters []string `json:"counters" yaml:"counters"` // Шаблоны measurement.field с * для полей-счетчиков с накопленным значением
+}
+
+// GraphiteConfig содержит параметры приема метрик по протоколу Graphite plaintext.
+// Прием включен, если задан адрес; на нем открываются и TCP-, и UDP-сокет.
+type GraphiteConfig struct {
+	Address string         `json:"address" yaml:"address"` // Адрес приема, пусто — прием выключен
+	Rules   []GraphiteRule `json:"rules" yaml:"rules"`     // Правила переименования метрик, применяется первое подходящее
+}
+
+// Enabled сообщает, что сервер должен принимать метрики Graphite.
+func (c GraphiteConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// GraphiteRule — правило переименования метрики Graphite. Задается либо Glob, либо Regex.
+// В Replace доступны группы $1, $2, ... (или ${1}, если за номером следует буква или _):
+// для Glob — части пути, совпавшие с *, для Regex — группы регулярного выражения.
+// Пустой результат отбрасывает метрику.
+type GraphiteRule struct {
+	Glob    string `json:"glob,omitempty" yaml:"glob,omitempty"`   // Шаблон ID, * соответствует части пути между точками
+	Regex   string `json:"regex,omitempty" yaml:"regex,omitempty"` // Регулярное выражение для всего ID
+	Replace string `json:"replace" yaml:"replace"`                 // Новый ID
+}
+
+// OTLPConfig содержит параметры приема метрик OpenTelemetry (OTLP/HTTP).
+// ID метрики строится по шаблону Template из атрибутов точки данных и выбранных
+// атрибутов ресурса и scope. В шаблоне доступны подстановки {name} — имя метрики,
+// {scope} — имя scope, {tags} — атрибуты, не использованные в шаблоне явно,
+// и {имя_атрибута} — значение конкретного атрибута.
+type OTLPConfig struct {
+	Template           string   `json:"template" yaml:"template"`                       // Шаблон ID метрики
+	ResourceAttributes []string `json:"resource_attributes" yaml:"resource_attributes"` // Атрибуты ресурса, добавляемые к тегам, * — все
+	ScopeAttributes    []string `json:"scope_attributes" yaml:"scope_attributes"`       // Атрибуты scope, добавляемые к тегам, * — все
+}
+
+// Режимы отправки метрик по remote write.
+const (
+	RemoteWriteValues  = "values"  // Раз в интервал отправляются текущие значения всех метрик
+	RemoteWriteSamples = "samples" // Отправляется каждое сохранение метрики
+)
+
+// RemoteWriteConfig содержит параметры отправки метрик во внешнее хранилище
+// по протоколу Prometheus remote write. Отправка включена, если задан URL.
+// Метрики распределяются по очередям (шардам) по ID, так что значения одной метрики
+// отправляются по порядку; при переполнении очереди новые значения отбрасываются.
+type RemoteWriteConfig struct {
+	URL         string   `json:"url" yaml:"url"`                   // Адрес приема remote write, пусто — отправка выключена
+	BearerToken string   `json:"bearer_token" yaml:"bearer_token"` // Токен для заголовка Authorization, пусто — без авторизации
+	Mode        string   `json:"mode" yaml:"mode"`                 // Что отправлять: values или samples
+	Interval    Duration `json:"interval" yaml:"interval"`         // Интервал отправки текущих значений в режиме values
+	Shards      int      `json:"shards" yaml:"shards"`             // Число очередей, отправляющих запросы параллельно
+	QueueSize   int      `json:"queue_size" yaml:"queue_size"`     // Размер очереди одного шарда
+	BatchSize   int      `json:"batch_size" yaml:"batch_size"`     // Максимальное число значений в одном запросе
+	MaxAttempts int      `json:"max_attempts" yaml:"max_attempts"` // Число попыток отправки запроса
+	Timeout     Duration `json:"timeout" yaml:"timeout"`           // Таймаут одной попытки
+}
+
+// Enabled сообщает, что сервер должен отправлять метрики по remote write.
+func (c RemoteWriteConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// WebhooksConfig содержит список получателей исходящих уведомлений об изменении метрик.
+// Получатели задаются только в файле конфигурации.
+type WebhooksConfig struct {
+	Endpoints      []WebhookEndpoint `json:"endpoints" yaml:"endpoints"`               // Получатели уведомлений
+	DeadLetterFile string            `json:"dead_letter_file" yaml:"dead_letter_file"` // Файл для недоставленных уведомлений (JSON Lines), пусто — только лог
+}
+
+// WebhookEndpoint — получатель уведомлений. Если задан Threshold, уведомление отправляется,
+// когда значение метрики пересекает порог; иначе — при каждом обновлении метрики.
+type WebhookEndpoint struct {
+	URL         string            `json:"url" yaml:"url"`                                 // Адрес получателя
+	Secret      string            `json:"secret" yaml:"secret"`                           // Ключ подписи HMAC-SHA256 тела запроса, пусто — без подписи
+	Metrics     []string          `json:"metrics" yaml:"metrics"`                         // Селекторы метрик: ID или шаблон с *, пусто — все метрики
+	Threshold   *WebhookThreshold `json:"threshold,omitempty" yaml:"threshold,omitempty"` // Порог, пересечение которого вызывает уведомление
+	QueueSize   int               `json:"queue_size" yaml:"queue_size"`                   // Размер очереди уведомлений получателя
+	MaxAttempts int               `json:"max_attempts" yaml:"max_attempts"`               // Число попыток доставки
+	Timeout     Duration          `json:"timeout" yaml:"timeout"`                         // Таймаут одной попытки
+}
+
+// WebhookThreshold — порог для уведомлений о пересечении.
+type WebhookThreshold struct {
+	Op    string  `json:"op" yaml:"op"`       // Сравнение: >, >=, <, <=, ==, !=
+	Value float64 `json:"value" yaml:"value"` // Порог
+}
+
+// defaultServerConfig возвращает значения конфигурации сервера по умолчанию.
+func defaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Address:         "localhost:8080",
+		ShutdownTimeout: Duration(10 * time.Second),
+		LogLevel:        "info",
+		Storage: StorageConfig{
+			Backend:       StorageMemory,
+			StoreInterval: Duration(300 * time.Second),
+			Restore:       true,
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes: 1 << 20,
+			ReadTimeout:  Duration(10 * time.Second),
+			WriteTimeout: Duration(10 * time.Second),
+			IdleTimeout:  Duration(60 * time.Second),
+		},
+		Scrape: ScrapeConfig{
+			Interval: Duration(10 * time.Second),
+			Timeout:  Duration(5 * time.Second),
+		},
+		Alerting: AlertingConfig{
+			Interval: Duration(15 * time.Second),
+		},
+		History: HistoryConfig{
+			Retention:   Duration(time.Hour),
+			MaxSamples:  1000,
+			RateWindows: []Duration{Duration(time.Minute), Duration(5 * time.Minute)},
+		},
+		Influx: InfluxConfig{
+			Template: "{measurement}_{field}{tags}",
+		},
+		OTLP: OTLPConfig{
+			Template:           "{name}{tags}",
+			ResourceAttributes: []string{"service.name"},
+		},
+		RemoteWrite: RemoteWriteConfig{
+			Mode:        RemoteWriteValues,
+			Interval:    Duration(15 * time.Second),
+			Shards:      4,
+			QueueSize:   10000,
+			BatchSize:   500,
+			MaxAttempts: 5,
+			Timeout:     Duration(10 * time.Second),
+		},
+	}
+}
+
+// serverFlagFields копирует значение явно заданного флага в конфигурацию.
+var serverFlagFields = map[string]func(dst, src *ServerConfig){
+	"c":             func(dst, src *ServerConfig) { dst.ConfigFile = src.ConfigFile },
+	"print-config":  func(dst, src *ServerConfig) { dst.PrintConfig = src.PrintConfig },
+	"a":             func(dst, src *ServerConfig) { dst.Address = src.Address },
+	"t":             func(dst, src *ServerConfig) { dst.ShutdownTimeout = src.ShutdownTimeout },
+	"l":             func(dst, src *ServerConfig) { dst.LogLevel = src.LogLevel },
+	"k":             func(dst, src *ServerConfig) { dst.Key = src.Key },
+	"storage":       func(dst, src *ServerConfig) { dst.Storage.Backend = src.Storage.Backend },
+	"d":             func(dst, src *ServerConfig) { dst.Storage.DSN = src.Storage.DSN },
+	"i":             func(dst, src *ServerConfig) { dst.Storage.StoreInterval = src.Storage.StoreInterval },
+	"r":             func(dst, src *ServerConfig) { dst.Storage.Restore = src.Storage.Restore },
+	"tls-cert":      func(dst, src *ServerConfig) { dst.TLS.CertFile = src.TLS.CertFile },
+	"tls-key":       func(dst, src *ServerConfig) { dst.TLS.KeyFile = src.TLS.KeyFile },
+	"max-body":      func(dst, src *ServerConfig) { dst.Limits.MaxBodyBytes = src.Limits.MaxBodyBytes },
+	"read-timeout":  func(dst, src *ServerConfig) { dst.Limits.ReadTimeout = src.Limits.ReadTimeout },
+	"write-timeout": func(dst, src *ServerConfig) { dst.Limits.WriteTimeout = src.Limits.WriteTimeout },
+	"idle-timeout":  func(dst, src *ServerConfig) { dst.Limits.IdleTimeout = src.Limits.IdleTimeout },
+
+	"scrape-targets":  func(dst, src *ServerConfig) { dst.Scrape.Targets = src.Scrape.Targets },
+	"scrape-file":     func(dst, src *ServerConfig) { dst.Scrape.TargetsFile = src.Scrape.TargetsFile },
+	"scrape-interval": func(dst, src *ServerConfig) { dst.Scrape.Interval = src.Scrape.Interval },
+	"scrape-timeout":  func(dst, src *ServerConfig) { dst.Scrape.Timeout = src.Scrape.Timeout },
+
+	"rules":          func(dst, src *ServerConfig) { dst.Alerting.RulesFile = src.Alerting.RulesFile },
+	"alert-interval": func(dst, src *ServerConfig) { dst.Alerting.Interval = src.Alerting.Interval },
+
+	"history-retention": func(dst, src *ServerConfig) { dst.History.Retention = src.History.Retention },
+	"history-samples":   func(dst, src *ServerConfig) { dst.History.MaxSamples = src.History.MaxSamples },
+	"rate-windows":      func(dst, src *ServerConfig) { dst.History.RateWindows = src.History.RateWindows },
+
+	"influx-template": func(dst, src *ServerConfig) { dst.Influx.Template = src.Influx.Template },
+	"influx-counters": func(dst, src *ServerConfig) { dst.Influx.Counters = src.Influx.Counters },
+	"graphite":        func(dst, src *ServerConfig) { dst.Graphite.Address = src.Graphite.Address },
+
+	"otlp-template":       func(dst, src *ServerConfig) { dst.OTLP.Template = src.OTLP.Template },
+	"otlp-resource-attrs": func(dst, src *ServerConfig) { dst.OTLP.ResourceAttributes = src.OTLP.ResourceAttributes },
+	"otlp-scope-attrs":    func(dst, src *ServerConfig) { dst.OTLP.ScopeAttributes = src.OTLP.ScopeAttributes },
+
+	"remote-write":          func(dst, src *ServerConfig) { dst.RemoteWrite.URL = src.RemoteWrite.URL },
+	"remote-write-mode":     func(dst, src *ServerConfig) { dst.RemoteWrite.Mode = src.RemoteWrite.Mode },
+	"remote-write-interval": func(dst, src *ServerConfig) { dst.RemoteWrite.Interval = src.RemoteWrite.Interval },
+	"remote-write-shards":   func(dst, src *ServerConfig) { dst.RemoteWrite.Shards = src.RemoteWrite.Shards },
+}
+
+// serverFlagSet создает набор флагов сервера, записывающий значения в v.
+func serverFlagSet(v *ServerConfig) *flag.FlagSet {
+	*v = defaultServerConfig()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+
+	fs.StringVar(&v.ConfigFile, "c", "", "config file (JSON or YAML)")
+	fs.BoolVar(&v.PrintConfig, "print-config", false, "print effective config with secrets redacted and exit")
+	fs.StringVar(&v.Address, "a", v.Address, "server address")
+	fs.Var(&v.ShutdownTimeout, "t", "shutdown timeout")
+	fs.StringVar(&v.LogLevel, "l", v.LogLevel, "log level (debug, info, warn, error)")
+	fs.StringVar(&v.Key, "k", v.Key, "HMAC-SHA256 signing key")
+	fs.StringVar(&v.Storage.Backend, "storage", v.Storage.Backend, "storage backend (memory, file)")
+	fs.StringVar(&v.Storage.DSN, "d", v.Storage.DSN, "storage DSN (file path for the file backend)")
+	fs.Var(&v.Storage.StoreInterval, "i", "store interval, 0 to store on every update")
+	fs.BoolVar(&v.Storage.Restore, "r", v.Storage.Restore, "restore stored metrics on startup")
+	fs.StringVar(&v.TLS.CertFile, "tls-cert", v.TLS.CertFile, "TLS certificate file")
+	fs.StringVar(&v.TLS.KeyFile, "tls-key", v.TLS.KeyFile, "TLS private key file")
+	fs.Int64Var(&v.Limits.MaxBodyBytes, "max-body", v.Limits.MaxBodyBytes, "max request body size in bytes")
+	fs.Var(&v.Limits.ReadTimeout, "read-timeout", "request read timeout")
+	fs.Var(&v.Limits.WriteTimeout, "write-timeout", "response write timeout")
+	fs.Var(&v.Limits.IdleTimeout, "idle-timeout", "keep-alive idle timeout")
+	fs.Var((*listValue)(&v.Scrape.Targets), "scrape-targets", "comma-separated agents to scrape (host:port or URL)")
+	fs.StringVar(&v.Scrape.TargetsFile, "scrape-file", v.Scrape.TargetsFile, "file with agents to scrape (JSON or YAML list)")
+	fs.Var(&v.Scrape.Interval, "scrape-interval", "scrape interval")
+	fs.Var(&v.Scrape.Timeout, "scrape-timeout", "scrape timeout")
+	fs.StringVar(&v.Alerting.RulesFile, "rules", v.Alerting.RulesFile, "alerting rules file (JSON or YAML)")
+	fs.Var(&v.Alerting.Interval, "alert-interval", "alerting rules evaluation interval")
+	fs.Var(&v.History.Retention, "history-retention", "how long to keep metric history for queries")
+	fs.IntVar(&v.History.MaxSamples, "history-samples", v.History.MaxSamples, "max history samples per metric")
+	fs.Var((*durationList)(&v.History.RateWindows), "rate-windows", "comma-separated windows for counter rates, e.g. 1m,5m")
+	fs.StringVar(&v.Influx.Template, "influx-template", v.Influx.Template, "metric ID template for line protocol fields")
+	fs.Var((*listValue)(&v.Influx.Counters), "influx-counters", "comma-separated measurement.field patterns of cumulative counters")
+	fs.StringVar(&v.Graphite.Address, "graphite", v.Graphite.Address, "Graphite plaintext listen address (TCP and UDP)")
+	fs.StringVar(&v.OTLP.Template, "otlp-template", v.OTLP.Template, "metric ID template for OTLP data points")
+	fs.Var((*listValue)(&v.OTLP.ResourceAttributes), "otlp-resource-attrs", "comma-separated OTLP resource attributes folded into metric IDs, * for all")
+	fs.Var((*listValue)(&v.OTLP.ScopeAttributes), "otlp-scope-attrs", "comma-separated OTLP scope attributes folded into metric IDs, * for all")
+	fs.StringVar(&v.RemoteWrite.URL, "remote-write", v.RemoteWrite.URL, "Prometheus remote write URL to forward metrics to")
+	fs.StringVar(&v.RemoteWrite.Mode, "remote-write-mode", v.RemoteWrite.Mode, "what to forward: values (periodic snapshot) or samples (every update)")
+	fs.Var(&v.RemoteWrite.Interval, "remote-write-interval", "remote write snapshot interval")
+	fs.IntVar(&v.RemoteWrite.Shards, "remote-write-shards", v.RemoteWrite.Shards, "number of parallel remote write queues")
+	return fs
+}
+
+// LoadServerConfig собирает конфигурацию сервера из аргументов командной строки args
+// (без имени программы) и переменных окружения env и проверяет ее.
+// Приоритет: флаги командной строки → переменные окружения → файл конфигурации → значения по умолчанию.
+// Путь к файлу задается флагом -c или переменной окружения CONFIG.
+func LoadServerConfig(args []string, env map[string]string) (ServerConfig, error) {
+	var flags ServerConfig
+	set, err := parseFlags(serverFlagSet(&flags), args)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	cfg := defaultServerConfig()
+	e := &envSource{vars: env}
+	e.String("CONFIG", &cfg.ConfigFile)
+	if set["c"] {
+		cfg.ConfigFile = flags.ConfigFile
+	}
+	if cfg.ConfigFile != "" {
+		if err = LoadFile(cfg.ConfigFile, &cfg); err != nil {
+			return ServerConfig{}, err
+		}
+	}
+
+	e.String("ADDRESS", &cfg.Address)
+	e.Duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	e.String("LOG_LEVEL", &cfg.LogLevel)
+	e.String("KEY", &cfg.Key)
+	e.String("STORAGE_BACKEND", &cfg.Storage.Backend)
+	e.String("STORAGE_DSN", &cfg.Storage.DSN)
+	e.Duration("STORE_INTERVAL", &cfg.Storage.StoreInterval)
+	e.Bool("RESTORE", &cfg.Storage.Restore)
+	e.String("TLS_CERT_FILE", &cfg.TLS.CertFile)
+	e.String("TLS_KEY_FILE", &cfg.TLS.KeyFile)
+	e.Int64("MAX_BODY_BYTES", &cfg.Limits.MaxBodyBytes)
+	e.Duration("READ_TIMEOUT", &cfg.Limits.ReadTimeout)
+	e.Duration("WRITE_TIMEOUT", &cfg.Limits.WriteTimeout)
+	e.Duration("IDLE_TIMEOUT", &cfg.Limits.IdleTimeout)
+	e.List("SCRAPE_TARGETS", &cfg.Scrape.Targets)
+	e.String("SCRAPE_FILE", &cfg.Scrape.TargetsFile)
+	e.Duration("SCRAPE_INTERVAL", &cfg.Scrape.Interval)
+	e.Duration("SCRAPE_TIMEOUT", &cfg.Scrape.Timeout)
+	e.String("RULES_FILE", &cfg.Alerting.RulesFile)
+	e.Duration("ALERT_INTERVAL", &cfg.Alerting.Interval)
+	e.Duration("HISTORY_RETENTION", &cfg.History.Retention)
+	e.Int("HISTORY_SAMPLES", &cfg.History.MaxSamples)
+	e.Durations("RATE_WINDOWS", &cfg.History.RateWindows)
+	e.String("INFLUX_TEMPLATE", &cfg.Influx.Template)
+	e.List("INFLUX_COUNTERS", &cfg.Influx.Counters)
+	e.String("GRAPHITE_ADDRESS", &cfg.Graphite.Address)
+	e.String("OTLP_TEMPLATE", &cfg.OTLP.Template)
+	e.List("OTLP_RESOURCE_ATTRIBUTES", &cfg.OTLP.ResourceAttributes)
+	e.List("OTLP_SCOPE_ATTRIBUTES", &cfg.OTLP.ScopeAttributes)
+	e.String("REMOTE_WRITE_URL", &cfg.RemoteWrite.URL)
+	e.String("REMOTE_WRITE_BEARER_TOKEN", &cfg.RemoteWrite.BearerToken)
+	e.String("REMOTE_WRITE_MODE", &cfg.RemoteWrite.Mode)
+	e.Duration("REMOTE_WRITE_INTERVAL", &cfg.RemoteWrite.Interval)
+	e.Int("REMOTE_WRITE_SHARDS", &cfg.RemoteWrite.Shards)
+	if err = e.Err(); err != nil {
+		return ServerConfig{}, err
+	}
+
+	for name := range set {
+		serverFlagFields[name](&cfg, &flags)
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return ServerConfig{}, fmt.Errorf("invalid server config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// Validate проверяет конфигурацию сервера и возвращает все найденные ошибки.
+func (c ServerConfig) Validate() error {
+	var errs []error
+	addErr := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		addErr("address", "%v", err)
+	}
+	if c.ShutdownTimeout < 0 {
+		addErr("shutdown_timeout", "must not be negative")
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		addErr("log_level", "%v", err)
+	}
+
+	switch c.Storage.Backend {
+	case StorageMemory:
+		if c.Storage.DSN != "" {
+			addErr("storage.dsn", "is not used by the %s backend", StorageMemory)
+		}
+	case StorageFile:
+		if c.Storage.DSN == "" {
+			addErr("storage.dsn", "file path is required for the %s backend", StorageFile)
+		}
+	default:
+		addErr("storage.backend", "unknown backend %q, expected %s or %s", c.Storage.Backend, StorageMemory, StorageFile)
+	}
+	if c.Storage.StoreInterval < 0 {
+		addErr("storage.store_interval", "must not be negative")
+	}
+
+	if c.TLS.Enabled() {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			addErr("tls", "both cert_file and key_file must be set")
+		}
+		for field, path := range map[string]string{"tls.cert_file": c.TLS.CertFile, "tls.key_file": c.TLS.KeyFile} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				addErr(field, "%v", err)
+			}
+		}
+	}
+
+	if c.Limits.MaxBodyBytes <= 0 {
+		addErr("limits.max_body_bytes", "must be positive")
+	}
+	for field, d := range map[string]Duration{
+		"limits.read_timeout":  c.Limits.ReadTimeout,
+		"limits.write_timeout": c.Limits.WriteTimeout,
+		"limits.idle_timeout":  c.Limits.IdleTimeout,
+	} {
+		if d < 0 {
+			addErr(field, "must not be negative")
+		}
+	}
+
+	if c.Scrape.Interval <= 0 {
+		addErr("scrape.interval", "must be positive")
+	}
+	if c.Scrape.Timeout <= 0 || c.Scrape.Timeout > c.Scrape.Interval {
+		addErr("scrape.timeout", "must be positive and not longer than scrape.interval")
+	}
+	for _, target := range c.Scrape.Targets {
+		if target == "" {
+			addErr("scrape.targets", "empty target")
+		}
+	}
+
+	if c.Alerting.Interval <= 0 {
+		addErr("alerting.interval", "must be positive")
+	}
+	if c.History.Retention <= 0 {
+		addErr("history.retention", "must be positive")
+	}
+	if c.History.MaxSamples <= 0 {
+		addErr("history.max_samples", "must be positive")
+	}
+	for _, w := range c.History.RateWindows {
+		if w <= 0 || w > c.History.Retention {
+			addErr("history.rate_windows", "window %s must be positive and not longer than history.retention", w.Std())
+		}
+	}
+
+	if c.Influx.Template == "" {
+		addErr("influx.template", "must not be empty")
+	}
+	for _, pattern := range c.Influx.Counters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			addErr("influx.counters", "invalid pattern %q", pattern)
+		}
+	}
+
+	if c.Graphite.Enabled() {
+		if _, _, err := net.SplitHostPort(c.Graphite.Address); err != nil {
+			addErr("graphite.address", "%v", err)
+		}
+	}
+	for i, rule := range c.Graphite.Rules {
+		field := fmt.Sprintf("graphite.rules[%d]", i)
+		if (rule.Glob == "") == (rule.Regex == "") {
+			addErr(field, "exactly one of glob and regex must be set")
+		}
+		if _, err := regexp.Compile(rule.Regex); err != nil {
+			addErr(field+".regex", "%v", err)
+		}
+	}
+
+	if c.OTLP.Template == "" {
+		addErr("otlp.template", "must not be empty")
+	}
+
+	if c.RemoteWrite.Enabled() {
+		if u, err := url.Parse(c.RemoteWrite.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("remote_write.url", "invalid url %q", c.RemoteWrite.URL)
+		}
+		if c.RemoteWrite.Mode != RemoteWriteValues && c.RemoteWrite.Mode != RemoteWriteSamples {
+			addErr("remote_write.mode", "unknown mode %q, expected %s or %s", c.RemoteWrite.Mode, RemoteWriteValues, RemoteWriteSamples)
+		}
+		for field, v := range map[string]int64{
+			"remote_write.interval":     int64(c.RemoteWrite.Interval),
+			"remote_write.shards":       int64(c.RemoteWrite.Shards),
+			"remote_write.queue_size":   int64(c.RemoteWrite.QueueSize),
+			"remote_write.batch_size":   int64(c.RemoteWrite.BatchSize),
+			"remote_write.max_attempts": int64(c.RemoteWrite.MaxAttempts),
+			"remote_write.timeout":      int64(c.RemoteWrite.Timeout),
+		} {
+			if v <= 0 {
+				addErr(field, "must be positive")
+			}
+		}
+	}
+
+	for i, ep := range c.Webhooks.Endpoints {
+		field := fmt.Sprintf("webhooks.endpoints[%d]", i)
+		if u, err := url.Parse(ep.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr(field+".url", "invalid url %q", ep.URL)
+		}
+		if ep.Threshold != nil && ep.Threshold.Op == "" {
+			addErr(field+".threshold.op", "must not be empty")
+		}
+		if ep.QueueSize < 0 {
+			addErr(field+".queue_size", "must not be negative")
+		}
+		if ep.MaxAttempts < 0 {
+			addErr(field+".max_attempts", "must not be negative")
+		}
+		if ep.Timeout < 0 {
+			addErr(field+".timeout", "must not be negative")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted возвращает копию конфигурации, в которой секреты заменены на REDACTED.
+func (c ServerConfig) Redacted() ServerConfig {
+	if c.Key != "" {
+		c.Key = redacted
+	}
+	endpoints := make([]WebhookEndpoint, len(c.Webhooks.Endpoints))
+	for i, ep := range c.Webhooks.Endpoints {
+		if ep.Secret != "" {
+			ep.Secret = redacted
+		}
+		endpoints[i] = ep
+	}
+	c.Webhooks.Endpoints = endpoints
+	if c.RemoteWrite.BearerToken != "" {
+		c.RemoteWrite.BearerToken = redacted
+	}
+	if u, err := url.Parse(c.Storage.DSN); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.Storage.DSN = u.String()
+		}
+	}
+	return c
+}
+
+// Print выводит итоговую конфигурацию в формате YAML со скрытыми секретами.
+func (c ServerConfig) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
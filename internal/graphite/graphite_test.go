@@ -0,0 +1,107 @@
+package graphite
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{line: "servers.web1.cpu.idle 97.5 1700000000", want: Sample{ID: "servers.web1.cpu.idle", Value: 97.5, Time: time.Unix(1700000000, 0)}},
+		{line: "load.shortterm 0.5", want: Sample{ID: "load.shortterm", Value: 0.5}},
+		{line: "load.shortterm 0.5 -1", want: Sample{ID: "load.shortterm", Value: 0.5}},
+		{line: "disk.used;mount=/var;host=db1 42 1700000000", want: Sample{ID: "disk.used;host=db1;mount=/var", Value: 42, Time: time.Unix(1700000000, 0)}},
+		{line: "cpu.idle", wantErr: true},
+		{line: "cpu.idle abc 1700000000", wantErr: true},
+		{line: "cpu.idle nan 1700000000", wantErr: true},
+		{line: "cpu..idle 1 1700000000", wantErr: true},
+		{line: "cpu.idle;host 1 1700000000", wantErr: true},
+		{line: "cpu.idle 1 yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_rewrite(t *testing.T) {
+	rules, err := compileRules([]config.GraphiteRule{
+		{Glob: "collectd.*.cpu-*.percent-idle", Replace: "cpu_idle;host=$1;cpu=$2"},
+		{Glob: "collectd.*.interface-lo.*", Replace: ""},
+		{Regex: `collectd\.(\w+)\.load\.load\.(\w+)`, Replace: "load_${2};host=$1"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		id     string
+		want   string
+		wantOK bool
+	}{
+		{id: "collectd.web1.cpu-0.percent-idle", want: "cpu_idle;host=web1;cpu=0", wantOK: true},
+		{id: "collectd.web1.cpu-0.extra.percent-idle", want: "collectd.web1.cpu-0.extra.percent-idle", wantOK: true},
+		{id: "collectd.web1.interface-lo.if_octets", wantOK: false},
+		{id: "collectd.db1.load.load.shortterm", want: "load_shortterm;host=db1", wantOK: true},
+		{id: "servers.web1.uptime", want: "servers.web1.uptime", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, ok := rewrite(rules, tt.id)
+			assert.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := storage.NewMemStorage()
+	srv, err := NewServer(config.GraphiteConfig{
+		Address: "127.0.0.1:0",
+		Rules:   []config.GraphiteRule{{Glob: "collectd.*.memory.used", Replace: "mem_used;host=$1"}},
+	}, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	require.NoError(t, srv.Start())
+
+	tcp, err := net.Dial("tcp", srv.Addr())
+	require.NoError(t, err)
+	_, err = tcp.Write([]byte("collectd.web1.memory.used 1024 1700000000\nbad line\nservers.web1.load 0.5 1700000000\n"))
+	require.NoError(t, err)
+
+	udp, err := net.Dial("udp", srv.Addr())
+	require.NoError(t, err)
+	_, err = udp.Write([]byte("servers.web2.load 1.5 1700000000\n"))
+	require.NoError(t, err)
+	require.NoError(t, udp.Close())
+
+	want := map[string]float64{"mem_used;host=web1": 1024, "servers.web1.load": 0.5, "servers.web2.load": 1.5}
+	assert.Eventually(t, func() bool { return len(s.GetAll()) == len(want) }, time.Second, 10*time.Millisecond)
+	for id, v := range want {
+		m, ok := s.Get(models.Gauge, id)
+		require.True(t, ok, id)
+		assert.Equal(t, v, *m.Value)
+	}
+
+	// Close не ждет, пока клиент закроет соединение
+	require.NoError(t, srv.Close())
+	tcp.Close()
+}
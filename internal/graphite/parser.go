@@ -0,0 +1,75 @@
+// Package graphite реализует прием метрик по протоколу Graphite plaintext:
+//
+//	path.to.metric value timestamp
+//
+// Путь становится ID метрики (с учетом правил переименования), значение сохраняется как gauge.
+// Поддерживаются и теги в формате Graphite 1.1: path.to.metric;tag1=value1;tag2=value2.
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Sample — разобранная строка протокола.
+type Sample struct {
+	ID    string    // Путь метрики с отсортированными тегами
+	Value float64   // Значение
+	Time  time.Time // Метка времени, нулевая, если не указана или равна -1
+}
+
+// ParseLine разбирает строку "path value [timestamp]". Метка времени задается в секундах Unix.
+func ParseLine(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Sample{}, fmt.Errorf("invalid line %q: expected \"path value timestamp\"", line)
+	}
+
+	id, err := parsePath(fields[0])
+	if err != nil {
+		return Sample{}, err
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("invalid value %q for %s", fields[1], id)
+	}
+
+	s := Sample{ID: id, Value: value}
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || ts < 0 {
+			return Sample{}, fmt.Errorf("invalid timestamp %q for %s", fields[2], id)
+		}
+		sec, frac := math.Modf(ts)
+		s.Time = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+	}
+	return s, nil
+}
+
+// parsePath проверяет путь метрики и приводит теги к виду models.TaggedID.
+func parsePath(path string) (string, error) {
+	name, rawTags, hasTags := strings.Cut(path, models.TagSeparator)
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid metric path %q", path)
+	}
+	if !hasTags {
+		return name, nil
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(rawTags, models.TagSeparator) {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" || value == "" {
+			return "", errors.New("invalid tag " + strconv.Quote(tag) + " in " + path)
+		}
+		tags[key] = value
+	}
+	return models.TaggedID(name, tags), nil
+}
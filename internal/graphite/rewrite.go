@@ -0,0 +1,58 @@
+package graphite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+)
+
+// rule — скомпилированное правило переименования.
+type rule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// compileRules компилирует правила переименования. Glob превращается в регулярное
+// выражение, в котором каждая * — группа, соответствующая части пути между точками.
+func compileRules(rules []config.GraphiteRule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		expr := r.Regex
+		if r.Glob != "" {
+			expr = globToRegex(r.Glob)
+		} else {
+			expr = "^(?:" + expr + ")$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("graphite rule %d: %w", i, err)
+		}
+		compiled = append(compiled, rule{re: re, replace: r.Replace})
+	}
+	return compiled, nil
+}
+
+// globToRegex переводит glob в регулярное выражение для всего ID.
+func globToRegex(glob string) string {
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return "^" + strings.Join(parts, "([^.;]*)") + "$"
+}
+
+// rewrite применяет первое подходящее правило к id. Если правило дало пустой ID,
+// возвращает false — метрика отбрасывается. Если ни одно правило не подошло, id не меняется.
+func rewrite(rules []rule, id string) (string, bool) {
+	for _, r := range rules {
+		match := r.re.FindStringSubmatchIndex(id)
+		if match == nil {
+			continue
+		}
+		result := string(r.re.ExpandString(nil, r.replace, id, match))
+		return result, result != ""
+	}
+	return id, true
+}
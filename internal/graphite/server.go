@@ -0,0 +1,180 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// maxPacketSize — максимальный размер UDP-пакета.
+const maxPacketSize = 65535
+
+// Server принимает строки протокола Graphite plaintext по TCP и UDP на одном адресе
+// и сохраняет значения как gauge-метрики.
+type Server struct {
+	address string
+	rules   []rule
+	storage handler.Storager
+	logger  *zap.SugaredLogger
+
+	packetConn net.PacketConn
+	listener   net.Listener
+	wg         sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Открытые TCP-соединения, закрываются при остановке
+	closed bool
+}
+
+// NewServer создает сервер Graphite с адресом и правилами переименования из cfg.
+func NewServer(cfg config.GraphiteConfig, storage handler.Storager, logger *zap.SugaredLogger) (*Server, error) {
+	rules, err := compileRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		address: cfg.Address,
+		rules:   rules,
+		storage: storage,
+		logger:  logger,
+		conns:   make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Start открывает сокеты и начинает прием в отдельных горутинах.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("graphite: %w", err)
+	}
+	// UDP-сокет открывается на том же порту, даже если в адресе указан порт 0
+	packetConn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("graphite: %w", err)
+	}
+	s.listener, s.packetConn = listener, packetConn
+
+	s.wg.Add(2)
+	go s.serveTCP()
+	go s.serveUDP()
+	return nil
+}
+
+// Addr возвращает адрес, на котором принимаются соединения. Вызывается после Start.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close закрывает сокеты и соединения и дожидается завершения горутин приема.
+func (s *Server) Close() error {
+	var errs []error
+	if s.packetConn != nil {
+		errs = append(errs, s.packetConn.Close())
+	}
+	if s.listener != nil {
+		errs = append(errs, s.listener.Close())
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// serveUDP читает пакеты, каждый из которых может содержать несколько строк.
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Errorln("graphite udp", err)
+			}
+			return
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			s.handleLine(string(line), addr)
+		}
+	}
+}
+
+// serveTCP принимает соединения, в которых строки разделены переводом строки.
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Errorln("graphite tcp", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				s.handleLine(scanner.Text(), conn.RemoteAddr())
+			}
+		}()
+	}
+}
+
+// handleLine разбирает строку, переименовывает метрику и сохраняет значение.
+// Некорректные строки пропускаются с записью в лог.
+func (s *Server) handleLine(line string, from net.Addr) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	sample, err := ParseLine(line)
+	if err != nil {
+		s.logger.Warnw("invalid graphite line", "from", from.String(), "error", err)
+		return
+	}
+
+	id, ok := rewrite(s.rules, sample.ID)
+	if !ok {
+		return
+	}
+	value := sample.Value
+	if err = s.storage.Save(models.Metrics{ID: id, MType: models.Gauge, Value: &value}); err != nil {
+		s.logger.Errorln("failed to save graphite metric", id, err)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListMetrics — HTTP-обработчик GET /api/v1/metrics. Возвращает метрики в формате JSON.
+// Параметры запроса: type, prefix и regex отбирают метрики, sort=name|value задает порядок
+// (по умолчанию по ID), limit — размер страницы. Если метрик больше limit, заголовок Link
+// с rel="next" содержит ссылку на следующую страницу с непрозрачным курсором cursor.
+func (h *Handler) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, false)
+}
+
+// GetMetric — HTTP-обработчик GET /api/v1/metrics/{type}/{id}. Возвращает метрику
+// в том же виде, что и ValueJSON, включая скорость изменения счетчика.
+func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
+	mType, id := chi.URLParam(r, "type"), chi.URLParam(r, "id")
+
+	m, ok := h.storage.Get(mType, id)
+	if !ok {
+		problem.Write(w, r, notFound(mType, id))
+		return
+	}
+
+	h.writeJSON(w, r, valueResponse{Metrics: m, CounterRates: h.counterRates(m)})
+}
+
+// PutMetric — HTTP-обработчик PUT /api/v1/metrics/{type}/{id}. Тип и ID берутся из URL,
+// значение — из тела запроса: {"value": 1.5} для gauge или {"delta": 3} для counter.
+// Поля id и type в теле необязательны, но если заданы, должны совпадать с URL.
+// Как и в UpdateJSON, значение gauge заменяется, а delta прибавляется к счетчику.
+// Возвращает сохраненную метрику.
+func (h *Handler) PutMetric(w http.ResponseWriter, r *http.Request) {
+	mType, id := chi.URLParam(r, "type"), chi.URLParam(r, "id")
+
+	var metric models.Metrics
+	if err := decodeStrict(r.Body, &metric); err != nil {
+		problem.Write(w, r, decodeProblem(err))
+		return
+	}
+
+	var mismatch *problem.Problem
+	for _, f := range []struct{ name, body, url string }{{"id", metric.ID, id}, {"type", metric.MType, mType}} {
+		if f.body != "" && f.body != f.url {
+			if mismatch == nil {
+				mismatch = problem.New(http.StatusBadRequest, problem.InvalidParameter, "metric in the body does not match the URL")
+			}
+			mismatch.Field(f.name, problem.InvalidParameter, "must match the URL: "+f.url)
+		}
+	}
+	if mismatch != nil {
+		problem.Write(w, r, mismatch)
+		return
+	}
+
+	metric.ID, metric.MType = id, mType
+	if p := validateMetric(metric, ""); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if err := h.storage.Save(metric); err != nil {
+		problem.Write(w, r, saveProblem(err, ""))
+		return
+	}
+
+	stored, ok := h.storage.Get(mType, id)
+	if !ok {
+		stored = metric
+	}
+	h.writeJSON(w, r, stored)
+}
+
+// DeleteMetric — HTTP-обработчик DELETE /api/v1/metrics/{type}/{id}.
+// Отвечает 204, если метрика удалена, и 404, если ее нет.
+func (h *Handler) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	mType, id := chi.URLParam(r, "type"), chi.URLParam(r, "id")
+
+	deleted, err := h.storage.Delete(mType, id)
+	if err != nil {
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.StorageUnavailable, "failed to delete metric: "+err.Error())
+		return
+	}
+	if !deleted {
+		problem.Write(w, r, notFound(mType, id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
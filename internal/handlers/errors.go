@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// validateMetric проверяет метрику из тела запроса. prefix добавляется к именам полей
+// в ошибках, чтобы в пакетном запросе указать номер метрики.
+func validateMetric(m models.Metrics, prefix string) *problem.Problem {
+	var errs models.ValidationError
+	if !errors.As(m.Validate(), &errs) {
+		return nil
+	}
+
+	p := problem.New(http.StatusBadRequest, fieldCode(errs[0]), "invalid metric")
+	for _, fe := range errs {
+		p.Field(prefix+fe.Field, fieldCode(fe), fe.Detail)
+	}
+	return p
+}
+
+// fieldCode возвращает код ошибки для причины, по которой метрика не прошла проверку.
+func fieldCode(err error) problem.Code {
+	switch {
+	case errors.Is(err, models.ErrMissingID):
+		return problem.MissingID
+	case errors.Is(err, models.ErrInvalidID):
+		return problem.InvalidID
+	case errors.Is(err, models.ErrUnknownType):
+		return problem.UnknownType
+	default:
+		return problem.InvalidValue
+	}
+}
+
+// invalidMetric описывает ошибку в одном поле метрики.
+func invalidMetric(field string, code problem.Code, detail string) *problem.Problem {
+	return problem.New(http.StatusBadRequest, code, "invalid metric").Field(field, code, detail)
+}
+
+// unknownType описывает метрику неизвестного типа.
+func unknownType(field, mType string) *problem.Problem {
+	return invalidMetric(field, problem.UnknownType, fmt.Sprintf("unknown metric type %q, expected gauge or counter", mType))
+}
+
+// notFound описывает отсутствующую метрику.
+func notFound(mType, id string) *problem.Problem {
+	return problem.New(http.StatusNotFound, problem.NotFound, fmt.Sprintf("metric %s of type %q not found", id, mType))
+}
+
+// decodeStrict разбирает JSON из body в v. В отличие от json.Decoder по умолчанию,
+// неизвестные поля и данные после JSON-значения считаются ошибкой.
+func decodeStrict(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// unknownFieldPrefix — начало текста ошибки json.Decoder о неизвестном поле.
+const unknownFieldPrefix = "json: unknown field "
+
+// decodeProblem описывает ошибку разбора тела запроса.
+func decodeProblem(err error) *problem.Problem {
+	var (
+		maxBytesErr *http.MaxBytesError
+		typeErr     *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return problem.New(http.StatusRequestEntityTooLarge, problem.BodyTooLarge,
+			fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return invalidMetric(typeErr.Field, problem.InvalidValue, fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type))
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		// encoding/json не экспортирует тип этой ошибки, имя поля есть только в тексте
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+		return problem.New(http.StatusBadRequest, problem.InvalidBody, "invalid JSON: unknown field").
+			Field(field, problem.InvalidBody, "unknown field")
+	default:
+		return problem.New(http.StatusBadRequest, problem.InvalidBody, "invalid JSON: "+err.Error())
+	}
+}
+
+// saveProblem описывает ошибку сохранения метрики. field — поле запроса с метрикой,
+// пусто, если метрика в запросе одна.
+func saveProblem(err error, field string) *problem.Problem {
+	if errors.Is(err, ErrTypeConflict) {
+		p := problem.New(http.StatusConflict, problem.TypeConflict, err.Error())
+		if field != "" {
+			p.Field(field, problem.TypeConflict, err.Error())
+		}
+		return p
+	}
+	p := problem.New(http.StatusServiceUnavailable, problem.StorageUnavailable, "failed to save metric: "+err.Error())
+	if field != "" {
+		p.Field(field, problem.StorageUnavailable, err.Error())
+	}
+	return p
+}
@@ -5,23 +5,56 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
 	"github.com/go-chi/chi/v5"
 )
 
 // Handler — структура, инкапсулирующая хранилище метрик.
 type Handler struct {
 	storage Storager // Интерфейс хранилища метрик
+	rates   Rater    // Скорость изменения счетчиков, nil — не вычисляется
 }
 
+// ErrTypeConflict возвращается хранилищем, если метрика с таким ID уже сохранена с другим типом.
+var ErrTypeConflict = errors.New("metric already exists with another type")
+
+// BatchError возвращается SaveBatch, если метрику с номером Index сохранить нельзя.
+// Пакет в этом случае не сохраняется целиком.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string { return fmt.Sprintf("metric %d: %v", e.Index, e.Err) }
+func (e *BatchError) Unwrap() error { return e.Err }
+
 // Storager — интерфейс для абстракции хранилища метрик.
+// Save возвращает ErrTypeConflict при попытке сохранить метрику с ID, занятым метрикой
+// другого типа, и models.ValidationError для метрики, не прошедшей models.Metrics.Validate;
+// остальные ошибки Save означают, что хранилище недоступно.
+// SaveBatch сохраняет пакет атомарно — все метрики или ни одной — и возвращает сохраненные
+// значения (для counter — итог) в порядке пакета. Ошибки отдельных метрик оборачиваются в *BatchError.
+// Delete возвращает false, если метрики с таким типом и ID нет.
+// List возвращает метрики, подходящие под opts.Match, в порядке opts.Less, не более opts.Limit.
 type Storager interface {
 	Save(metric models.Metrics) error
+	SaveBatch(metrics []models.Metrics) ([]models.Metrics, error)
 	Get(mType, id string) (models.Metrics, bool)
 	GetAll() []models.Metrics
+	List(opts ListOptions) ([]models.Metrics, error)
+	Delete(mType, id string) (bool, error)
+}
+
+// Rater — интерфейс для расчета скорости изменения счетчиков.
+type Rater interface {
+	CounterRates(id string) (models.CounterRates, bool)
 }
 
 // NewHandler создает новый экземпляр Handler с заданным хранилищем.
@@ -29,6 +62,23 @@ func NewHandler(storage Storager) *Handler {
 	return &Handler{storage: storage}
 }
 
+// SetRates включает расчет скорости изменения счетчиков в ответах ValueJSON и на HTML-странице.
+func (h *Handler) SetRates(r Rater) {
+	h.rates = r
+}
+
+// counterRates возвращает скорость изменения метрики, если это счетчик и расчет включен.
+func (h *Handler) counterRates(m models.Metrics) *models.CounterRates {
+	if h.rates == nil || m.MType != models.Counter {
+		return nil
+	}
+	rates, ok := h.rates.CounterRates(m.ID)
+	if !ok {
+		return nil
+	}
+	return &rates
+}
+
 // Update — HTTP-обработчик для обновления метрики через параметры URL.
 // Поддерживает типы gauge и counter. Валидирует входные данные.
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
@@ -37,90 +87,117 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	value := chi.URLParam(r, "value")
 
 	if id == "" {
-		w.WriteHeader(http.StatusNotFound)
-		return
-	}
-
-	if mType == "" || value == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	if mType != models.Counter && mType != models.Gauge {
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, problem.New(http.StatusNotFound, problem.MissingID, "metric id is required").
+			Field("id", problem.MissingID, "must not be empty"))
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-
 	metric := models.Metrics{
 		ID:    id,
 		MType: mType,
 	}
 
-	if mType == models.Counter {
+	switch mType {
+	case models.Counter:
 		parseInt, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			problem.Write(w, r, invalidMetric("value", problem.InvalidValue, "counter value must be an integer"))
 			return
 		}
 		metric.Delta = &parseInt
-	} else {
+	case models.Gauge:
 		parseFloat, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			problem.Write(w, r, invalidMetric("value", problem.InvalidValue, "gauge value must be a number"))
 			return
 		}
 		metric.Value = &parseFloat
+	default:
+		problem.Write(w, r, unknownType("type", mType))
+		return
+	}
+	if p := validateMetric(metric, ""); p != nil {
+		problem.Write(w, r, p)
+		return
 	}
 
-	err := h.storage.Save(metric)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if err := h.storage.Save(metric); err != nil {
+		problem.Write(w, r, saveProblem(err, ""))
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 }
 
 // UpdateJSON — HTTP-обработчик для обновления метрики через JSON в теле запроса.
+// Неизвестные поля JSON и метрики, не прошедшие models.Metrics.Validate, отклоняются.
 // Возвращает обновлённую метрику в ответе.
 func (h *Handler) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	requestMetric := models.Metrics{}
-	err := json.NewDecoder(r.Body).Decode(&requestMetric)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if err := decodeStrict(r.Body, &requestMetric); err != nil {
+		problem.Write(w, r, decodeProblem(err))
+		return
+	}
+	if p := validateMetric(requestMetric, ""); p != nil {
+		problem.Write(w, r, p)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-
-	var responseMetric models.Metrics
 
-	err = h.storage.Save(requestMetric)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if err := h.storage.Save(requestMetric); err != nil {
+		problem.Write(w, r, saveProblem(err, ""))
 		return
 	}
-	metric, ok := h.storage.Get(requestMetric.MType, requestMetric.ID)
+	responseMetric, ok := h.storage.Get(requestMetric.MType, requestMetric.ID)
 	if !ok {
 		responseMetric = requestMetric
-	} else {
-		responseMetric = metric
 	}
 
-	res, err := json.Marshal(responseMetric)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	h.writeJSON(w, r, responseMetric)
+}
+
+// UpdatesJSON — HTTP-обработчик для пакетного обновления метрик через JSON-массив в теле запроса.
+// Возвращает сохранённые значения метрик в том же порядке. Сначала проверяются все метрики
+// пакета: если хотя бы одна некорректна, ничего не сохраняется, а в ответе перечисляются
+// ошибки всех некорректных метрик. Пакет сохраняется атомарно: при конфликте типов
+// или ошибке хранилища не сохраняется ни одна метрика, и клиент может безопасно повторить запрос.
+func (h *Handler) UpdatesJSON(w http.ResponseWriter, r *http.Request) {
+	var requestMetrics []models.Metrics
+	if err := decodeStrict(r.Body, &requestMetrics); err != nil {
+		problem.Write(w, r, decodeProblem(err))
 		return
 	}
 
-	_, err = w.Write(res)
+	var invalid *problem.Problem
+	for i, m := range requestMetrics {
+		p := validateMetric(m, fmt.Sprintf("[%d].", i))
+		if p == nil {
+			continue
+		}
+		if invalid == nil {
+			invalid = p
+			invalid.Detail = "invalid metrics in batch"
+			continue
+		}
+		invalid.Errors = append(invalid.Errors, p.Errors...)
+	}
+	if invalid != nil {
+		problem.Write(w, r, invalid)
+		return
+	}
+
+	responseMetrics, err := h.storage.SaveBatch(requestMetrics)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		field := ""
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			field, err = fmt.Sprintf("[%d]", batchErr.Index), batchErr.Err
+		}
+		problem.Write(w, r, saveProblem(err, field))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	h.writeJSON(w, r, responseMetrics)
 }
 
 // Value — HTTP-обработчик для получения значения метрики по типу и id через URL.
@@ -129,11 +206,9 @@ func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 	mType := chi.URLParam(r, "type")
 	id := chi.URLParam(r, "id")
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-
 	m, ok := h.storage.Get(mType, id)
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
+		problem.Write(w, r, notFound(mType, id))
 		return
 	}
 
@@ -144,71 +219,63 @@ func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 	} else {
 		bytes, err = json.Marshal(m.Value)
 	}
-
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(bytes)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	_, _ = w.Write(bytes)
+}
+
+// valueResponse — ответ ValueJSON. Для счетчиков дополнительно содержит скорость изменения.
+type valueResponse struct {
+	models.Metrics
+	*models.CounterRates
 }
 
 // ValueJSON — HTTP-обработчик для получения метрики через JSON-запрос.
-// Возвращает всю структуру метрики в формате JSON.
+// Возвращает всю структуру метрики в формате JSON. Если включен расчет скорости,
+// для счетчика в ответ добавляются поля rate (прирост в секунду между двумя последними
+// значениями) и rates (скорость и прирост за настроенные интервалы).
 func (h *Handler) ValueJSON(w http.ResponseWriter, r *http.Request) {
 	metric := models.Metrics{}
-
-	err := json.NewDecoder(r.Body).Decode(&metric)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+		problem.Write(w, r, decodeProblem(err))
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
 
 	m, ok := h.storage.Get(metric.MType, metric.ID)
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
+		problem.Write(w, r, notFound(metric.MType, metric.ID))
 		return
 	}
 
-	bytes, err := json.Marshal(m)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(bytes)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	h.writeJSON(w, r, valueResponse{Metrics: m, CounterRates: h.counterRates(m)})
 }
 
 // All — HTTP-обработчик для получения всех метрик.
-// Возвращает список всех метрик в формате JSON.
+// Возвращает список метрик в формате JSON, а браузеру (Accept: text/html) — HTML-страницу.
+// Метрики отбираются и упорядочиваются по параметрам запроса, как в ListMetrics.
 func (h *Handler) All(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		problem.MethodNotAllowedHandler(w, r)
 		return
 	}
 
-	m := h.storage.GetAll()
+	h.list(w, r, strings.Contains(r.Header.Get("Accept"), "text/html"))
+}
 
-	bytes, err := json.Marshal(m)
+// writeJSON отправляет v в формате JSON со статусом 200.
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	bytes, err := json.Marshal(v)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(bytes)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	_, _ = w.Write(bytes)
 }
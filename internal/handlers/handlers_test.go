@@ -1,13 +1,19 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type TestStorage struct {
@@ -16,6 +22,9 @@ type TestStorage struct {
 
 func (r *TestStorage) Save(metric models.Metrics) error {
 	mType, ID, value, delta := metric.MType, metric.ID, metric.Value, metric.Delta
+	if stored, ok := r.metrics[ID]; ok && stored.MType != mType {
+		return ErrTypeConflict
+	}
 
 	existMetric, ok := r.Get(mType, ID)
 
@@ -36,6 +45,20 @@ func (r *TestStorage) Save(metric models.Metrics) error {
 	return nil
 }
 
+func (r *TestStorage) SaveBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	for i, m := range metrics {
+		if stored, ok := r.metrics[m.ID]; ok && stored.MType != m.MType {
+			return nil, &BatchError{Index: i, Err: ErrTypeConflict}
+		}
+	}
+	stored := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		_ = r.Save(m)
+		stored[i], _ = r.Get(m.MType, m.ID)
+	}
+	return stored, nil
+}
+
 func (r *TestStorage) Get(mType string, ID string) (models.Metrics, bool) {
 	m, ok := r.metrics[ID]
 	if !ok {
@@ -48,6 +71,28 @@ func (r *TestStorage) Get(mType string, ID string) (models.Metrics, bool) {
 	return m, true
 }
 
+func (r *TestStorage) Delete(mType string, ID string) (bool, error) {
+	if _, ok := r.Get(mType, ID); !ok {
+		return false, nil
+	}
+	delete(r.metrics, ID)
+	return true, nil
+}
+
+func (r *TestStorage) List(opts ListOptions) ([]models.Metrics, error) {
+	metrics := make([]models.Metrics, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		if opts.Match(m) {
+			metrics = append(metrics, m)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return opts.Less(metrics[i], metrics[j]) })
+	if opts.Limit > 0 && len(metrics) > opts.Limit {
+		metrics = metrics[:opts.Limit]
+	}
+	return metrics, nil
+}
+
 func (r *TestStorage) GetAll() []models.Metrics {
 	all := make([]models.Metrics, 0, len(r.metrics))
 	for _, m := range r.metrics {
@@ -190,3 +235,350 @@ func TestHandler_Value(t *testing.T) {
 		})
 	}
 }
+
+type testRater map[string]models.CounterRates
+
+func (r testRater) CounterRates(id string) (models.CounterRates, bool) {
+	rates, ok := r[id]
+	return rates, ok
+}
+
+func newRatesHandler() *Handler {
+	memStorage := &TestStorage{metrics: make(map[string]models.Metrics)}
+	alloc, polls := 1.5, int64(100)
+	_ = memStorage.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &alloc})
+	_ = memStorage.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &polls})
+
+	rate := 0.5
+	h := NewHandler(memStorage)
+	h.SetRates(testRater{"PollCount": {
+		Rate:    &rate,
+		Windows: []models.WindowRate{{Window: "1m0s", Rate: 0.25, Increase: 15}},
+	}})
+	return h
+}
+
+func TestHandler_ValueJSONRates(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "counter with rates",
+			body: `{"id":"PollCount","type":"counter"}`,
+			want: `{"id":"PollCount","type":"counter","delta":100,"rate":0.5,"rates":[{"window":"1m0s","rate":0.25,"increase":15}]}`,
+		},
+		{
+			name: "gauge without rates",
+			body: `{"id":"Alloc","type":"gauge"}`,
+			want: `{"id":"Alloc","type":"gauge","value":1.5}`,
+		},
+	}
+	h := newRatesHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ValueJSON(w, httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(tt.body)))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func TestHandler_AllHTML(t *testing.T) {
+	h := newRatesHandler()
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	h.All(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "<th>Increase (1m0s)</th>")
+	assert.Contains(t, body, `<tr><td>Alloc</td><td>gauge</td><td class="num">1.5</td><td class="num"></td><td class="num"></td><td class="num"></td></tr>`)
+	assert.Contains(t, body, `<tr><td>PollCount</td><td>counter</td><td class="num">100</td><td class="num">0.5</td><td class="num">0.25</td><td class="num">15</td></tr>`)
+
+	w = httptest.NewRecorder()
+	h.All(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "["), "JSON by default")
+}
+
+// failingStorage — хранилище, которое не может сохранить ни одной метрики.
+type failingStorage struct {
+	TestStorage
+}
+
+func (failingStorage) Save(models.Metrics) error {
+	return errors.New("disk is full")
+}
+
+func TestHandler_Problems(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage Storager
+		method  string
+		target  string
+		body    string
+		status  int
+		want    string
+	}{
+		{
+			name:   "unknown type in URL",
+			method: http.MethodPost,
+			target: "/update/histogram/cpu/1",
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"unknown_type","detail":"invalid metric",
+				"instance":"/update/histogram/cpu/1","errors":[{"field":"type","code":"unknown_type",
+				"detail":"unknown metric type \"histogram\", expected gauge or counter"}]}`,
+		},
+		{
+			name:   "invalid counter value",
+			method: http.MethodPost,
+			target: "/update/counter/polls/1.5",
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_value","detail":"invalid metric",
+				"instance":"/update/counter/polls/1.5","errors":[{"field":"value","code":"invalid_value",
+				"detail":"counter value must be an integer"}]}`,
+		},
+		{
+			name:   "type conflict",
+			method: http.MethodPost,
+			target: "/update/counter/Alloc/1",
+			status: http.StatusConflict,
+			want: `{"type":"about:blank","title":"Conflict","status":409,"code":"type_conflict",
+				"detail":"metric already exists with another type","instance":"/update/counter/Alloc/1"}`,
+		},
+		{
+			name:    "storage unavailable",
+			storage: &failingStorage{},
+			method:  http.MethodPost,
+			target:  "/update/gauge/cpu/1",
+			status:  http.StatusServiceUnavailable,
+			want: `{"type":"about:blank","title":"Service Unavailable","status":503,"code":"storage_unavailable",
+				"detail":"failed to save metric: disk is full","instance":"/update/gauge/cpu/1"}`,
+		},
+		{
+			name:   "missing id in JSON",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"type":"gauge","value":1}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"missing_id","detail":"invalid metric",
+				"instance":"/update/","errors":[{"field":"id","code":"missing_id","detail":"must not be empty"}]}`,
+		},
+		{
+			name:   "wrong value type in JSON",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"cpu","type":"counter","delta":"one"}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_value","detail":"invalid metric",
+				"instance":"/update/","errors":[{"field":"delta","code":"invalid_value","detail":"cannot use string as int64"}]}`,
+		},
+		{
+			name:   "malformed JSON",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body",
+				"detail":"invalid JSON: unexpected EOF","instance":"/update/"}`,
+		},
+		{
+			name:   "non-finite gauge value in URL",
+			method: http.MethodPost,
+			target: "/update/gauge/cpu/NaN",
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_value","detail":"invalid metric",
+				"instance":"/update/gauge/cpu/NaN","errors":[{"field":"value","code":"invalid_value","detail":"must be a finite number"}]}`,
+		},
+		{
+			name:   "counter with value instead of delta",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"polls","type":"counter","value":1}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_value","detail":"invalid metric",
+				"instance":"/update/","errors":[
+				{"field":"delta","code":"invalid_value","detail":"counter requires an integer delta"},
+				{"field":"value","code":"invalid_value","detail":"counter must not have a value"}]}`,
+		},
+		{
+			name:   "id with control characters",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"cpu\n","type":"gauge","value":1}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_id","detail":"invalid metric",
+				"instance":"/update/","errors":[{"field":"id","code":"invalid_id","detail":"must contain only printable characters"}]}`,
+		},
+		{
+			name:   "too long id",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"` + strings.Repeat("a", models.MaxIDLength+1) + `","type":"gauge","value":1}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_id","detail":"invalid metric",
+				"instance":"/update/","errors":[{"field":"id","code":"invalid_id","detail":"must be at most 256 bytes"}]}`,
+		},
+		{
+			name:   "unknown JSON field",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"cpu","type":"gauge","value":1,"unit":"percent"}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body","detail":"invalid JSON: unknown field",
+				"instance":"/update/","errors":[{"field":"unit","code":"invalid_body","detail":"unknown field"}]}`,
+		},
+		{
+			name:   "data after JSON value",
+			method: http.MethodPost,
+			target: "/update/",
+			body:   `{"id":"cpu","type":"gauge","value":1}{}`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body",
+				"detail":"invalid JSON: unexpected data after JSON value","instance":"/update/"}`,
+		},
+		{
+			name:   "batch lists every invalid metric",
+			method: http.MethodPost,
+			target: "/updates/",
+			body:   `[{"id":"a","type":"gauge","value":1},{"id":"b","type":"timer"},{"type":"counter"}]`,
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"unknown_type",
+				"detail":"invalid metrics in batch","instance":"/updates/","errors":[
+				{"field":"[1].type","code":"unknown_type","detail":"unknown metric type \"timer\", expected gauge or counter"},
+				{"field":"[2].id","code":"missing_id","detail":"must not be empty"},
+				{"field":"[2].delta","code":"invalid_value","detail":"counter requires an integer delta"}]}`,
+		},
+		{
+			name:   "batch type conflict points to the metric",
+			method: http.MethodPost,
+			target: "/updates/",
+			body:   `[{"id":"cpu","type":"gauge","value":1},{"id":"Alloc","type":"counter","delta":1}]`,
+			status: http.StatusConflict,
+			want: `{"type":"about:blank","title":"Conflict","status":409,"code":"type_conflict",
+				"detail":"metric already exists with another type","instance":"/updates/",
+				"errors":[{"field":"[1]","code":"type_conflict","detail":"metric already exists with another type"}]}`,
+		},
+		{
+			name:   "unknown metric",
+			method: http.MethodGet,
+			target: "/value/gauge/missing",
+			status: http.StatusNotFound,
+			want: `{"type":"about:blank","title":"Not Found","status":404,"code":"not_found",
+				"detail":"metric missing of type \"gauge\" not found","instance":"/value/gauge/missing"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := tt.storage
+			if storage == nil {
+				alloc := 1.5
+				storage = &TestStorage{metrics: map[string]models.Metrics{
+					"Alloc": {ID: "Alloc", MType: models.Gauge, Value: &alloc},
+				}}
+			}
+			h := NewHandler(storage)
+			router := chi.NewRouter()
+			router.Post("/update/{type}/{id}/{value}", h.Update)
+			router.Post("/update/", h.UpdateJSON)
+			router.Post("/updates/", h.UpdatesJSON)
+			router.Get("/value/{type}/{id}", h.Value)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func TestHandler_List(t *testing.T) {
+	newStorage := func() *TestStorage {
+		s := &TestStorage{metrics: make(map[string]models.Metrics)}
+		for id, v := range map[string]float64{"cpu.user": 30, "cpu.system": 10, "mem.free": 20} {
+			_ = s.Save(models.Metrics{ID: id, MType: models.Gauge, Value: &v})
+		}
+		for id, d := range map[string]int64{"requests": 25, "cpu.ticks": 5} {
+			_ = s.Save(models.Metrics{ID: id, MType: models.Counter, Delta: &d})
+		}
+		return s
+	}
+	ids := func(body string) []string {
+		var metrics []models.Metrics
+		require.NoError(t, json.Unmarshal([]byte(body), &metrics))
+		ids := make([]string, 0, len(metrics))
+		for _, m := range metrics {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		query  string
+		want   []string
+		status int
+	}{
+		{query: "", want: []string{"cpu.system", "cpu.ticks", "cpu.user", "mem.free", "requests"}},
+		{query: "type=gauge", want: []string{"cpu.system", "cpu.user", "mem.free"}},
+		{query: "prefix=cpu.&type=gauge", want: []string{"cpu.system", "cpu.user"}},
+		{query: "regex=^(mem|req)", want: []string{"mem.free", "requests"}},
+		{query: "sort=value", want: []string{"cpu.ticks", "cpu.system", "mem.free", "requests", "cpu.user"}},
+		{query: "type=timer", status: http.StatusBadRequest},
+		{query: "regex=(", status: http.StatusBadRequest},
+		{query: "sort=size", status: http.StatusBadRequest},
+		{query: "limit=0", status: http.StatusBadRequest},
+		{query: "cursor=!!!", status: http.StatusBadRequest},
+		{query: "sort=value&cursor=" + encodeCursor(SortName, models.Metrics{ID: "cpu.user"}), status: http.StatusBadRequest},
+	}
+	h := NewHandler(newStorage())
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ListMetrics(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+tt.query, nil))
+
+			if tt.status != 0 {
+				assert.Equal(t, tt.status, w.Code)
+				assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+				return
+			}
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, ids(w.Body.String()))
+			assert.Empty(t, w.Header().Get("Link"))
+		})
+	}
+
+	t.Run("pages are stable under concurrent inserts", func(t *testing.T) {
+		s := newStorage()
+		h := NewHandler(s)
+
+		var got []string
+		target := "/api/v1/metrics?sort=value&limit=2"
+		for page := 0; target != ""; page++ {
+			w := httptest.NewRecorder()
+			h.ListMetrics(w, httptest.NewRequest(http.MethodGet, target, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			got = append(got, ids(w.Body.String())...)
+
+			target = ""
+			if link := w.Header().Get("Link"); link != "" {
+				require.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+				target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+			if page == 0 {
+				// Метрики до и после курсора не сдвигают следующие страницы
+				low, high := 1.0, 40.0
+				_ = s.Save(models.Metrics{ID: "aaa", MType: models.Gauge, Value: &low})
+				_ = s.Save(models.Metrics{ID: "zzz", MType: models.Gauge, Value: &high})
+			}
+		}
+		assert.Equal(t, []string{"cpu.ticks", "cpu.system", "mem.free", "requests", "cpu.user", "zzz"}, got)
+	})
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// Порядок сортировки метрик в List.
+const (
+	SortName  = "name"  // По ID
+	SortValue = "value" // По значению gauge или итогу counter, при равенстве — по ID
+)
+
+// ListOptions — параметры выборки метрик для Storager.List. Пустые поля не ограничивают выборку.
+// Фильтры и порядок описаны методами Match и Less, чтобы хранилища, которые выполняют
+// выборку сами (например, в базе данных), могли повторить ту же семантику.
+type ListOptions struct {
+	Type   string         // Тип метрики: gauge или counter
+	Prefix string         // Префикс ID
+	Regex  *regexp.Regexp // Регулярное выражение для ID
+	Sort   string         // SortName (по умолчанию) или SortValue
+	After  *ListCursor    // Вернуть только метрики после этой позиции в порядке Sort
+	Limit  int            // Максимальное число метрик, 0 — без ограничения
+}
+
+// ListCursor — позиция в упорядоченном списке метрик: ключ сортировки последней
+// полученной метрики. Страницы по такому курсору не сдвигаются, если между
+// запросами добавляются или удаляются другие метрики.
+type ListCursor struct {
+	ID    string  `json:"id"`
+	Value float64 `json:"value,omitempty"` // Значение последней метрики для SortValue
+}
+
+// Match сообщает, проходит ли метрика фильтры и находится ли она после курсора.
+func (o ListOptions) Match(m models.Metrics) bool {
+	switch {
+	case o.Type != "" && m.MType != o.Type:
+		return false
+	case !strings.HasPrefix(m.ID, o.Prefix):
+		return false
+	case o.Regex != nil && !o.Regex.MatchString(m.ID):
+		return false
+	case o.After != nil:
+		return o.less(*o.After, ListCursor{ID: m.ID, Value: sortValue(m)})
+	}
+	return true
+}
+
+// Less сообщает, идет ли метрика a раньше метрики b в порядке Sort.
+func (o ListOptions) Less(a, b models.Metrics) bool {
+	return o.less(ListCursor{ID: a.ID, Value: sortValue(a)}, ListCursor{ID: b.ID, Value: sortValue(b)})
+}
+
+func (o ListOptions) less(a, b ListCursor) bool {
+	if o.Sort == SortValue && a.Value != b.Value {
+		return a.Value < b.Value
+	}
+	return a.ID < b.ID
+}
+
+// sortValue возвращает значение метрики для сортировки: value для gauge и delta для counter.
+func sortValue(m models.Metrics) float64 {
+	switch {
+	case m.Value != nil:
+		return *m.Value
+	case m.Delta != nil:
+		return float64(*m.Delta)
+	default:
+		return 0
+	}
+}
+
+// cursorToken — содержимое курсора в параметре cursor. Порядок сортировки хранится
+// в курсоре, чтобы курсор нельзя было применить к списку в другом порядке.
+type cursorToken struct {
+	Sort string `json:"sort"`
+	ListCursor
+}
+
+// encodeCursor кодирует позицию после метрики m в непрозрачную строку.
+func encodeCursor(sort string, m models.Metrics) string {
+	token := cursorToken{Sort: sort, ListCursor: ListCursor{ID: m.ID}}
+	if sort == SortValue {
+		token.Value = sortValue(m)
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор, выданный encodeCursor для того же порядка сортировки.
+func decodeCursor(s, sort string) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var token cursorToken
+	if err = json.Unmarshal(data, &token); err != nil || token.ID == "" {
+		return nil, errors.New("malformed cursor")
+	}
+	if token.Sort != sort {
+		return nil, fmt.Errorf("cursor was issued for sort=%s", token.Sort)
+	}
+	return &token.ListCursor, nil
+}
+
+// listOptions разбирает параметры запроса списка метрик: type, prefix, regex,
+// sort=name|value, limit и cursor.
+func listOptions(query url.Values) (ListOptions, *problem.Problem) {
+	opts := ListOptions{Type: query.Get("type"), Prefix: query.Get("prefix"), Sort: query.Get("sort")}
+
+	var p *problem.Problem
+	fail := func(field string, code problem.Code, detail string) {
+		if p == nil {
+			p = problem.New(http.StatusBadRequest, code, "invalid list parameters")
+		}
+		p.Field(field, code, detail)
+	}
+
+	if opts.Type != "" && opts.Type != models.Gauge && opts.Type != models.Counter {
+		fail("type", problem.UnknownType, fmt.Sprintf("unknown metric type %q, expected gauge or counter", opts.Type))
+	}
+	if expr := query.Get("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			fail("regex", problem.InvalidParameter, "invalid regex: "+err.Error())
+		}
+		opts.Regex = re
+	}
+	switch opts.Sort {
+	case "":
+		opts.Sort = SortName
+	case SortName, SortValue:
+	default:
+		fail("sort", problem.InvalidParameter, fmt.Sprintf("unknown sort %q, expected name or value", opts.Sort))
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			fail("limit", problem.InvalidParameter, "must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+	if s := query.Get("cursor"); s != "" && p == nil {
+		after, err := decodeCursor(s, opts.Sort)
+		if err != nil {
+			fail("cursor", problem.InvalidParameter, err.Error())
+		}
+		opts.After = after
+	}
+	return opts, p
+}
+
+// list отдает метрики, выбранные по параметрам запроса. Если метрик больше limit,
+// ответ содержит заголовок Link со ссылкой на следующую страницу (rel="next").
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, html bool) {
+	opts, p := listOptions(r.URL.Query())
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	limit := opts.Limit
+	if limit > 0 {
+		opts.Limit++ // Лишняя метрика показывает, что есть следующая страница
+	}
+	metrics, err := h.storage.List(opts)
+	if err != nil {
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.StorageUnavailable, "failed to list metrics: "+err.Error())
+		return
+	}
+	if limit > 0 && len(metrics) > limit {
+		metrics = metrics[:limit]
+		next := r.URL.Query()
+		next.Set("cursor", encodeCursor(opts.Sort, metrics[limit-1]))
+		w.Header().Add("Link", "<"+r.URL.Path+"?"+next.Encode()+`>; rel="next"`)
+	}
+
+	if html {
+		h.page(w, r, metrics)
+		return
+	}
+	h.writeJSON(w, r, metrics)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// pageTemplate — HTML-страница со списком метрик.
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Metrics</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Metrics</h1>
+<table>
+<tr><th>ID</th><th>Type</th><th>Value</th><th>Rate/s</th>{{range .Windows}}<th>Rate/s ({{.}})</th><th>Increase ({{.}})</th>{{end}}</tr>
+{{range .Rows}}<tr><td>{{.ID}}</td><td>{{.Type}}</td><td class="num">{{.Value}}</td><td class="num">{{.Rate}}</td>{{range .Windows}}<td class="num">{{.Rate}}</td><td class="num">{{.Increase}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// pageData — данные HTML-страницы.
+type pageData struct {
+	Windows []string // Интервалы расчета скорости, общие для всех счетчиков
+	Rows    []pageRow
+}
+
+// pageRow — строка таблицы метрик. Пустые ячейки означают, что значение не вычислено.
+type pageRow struct {
+	ID, Type, Value, Rate string
+	Windows               []pageWindow
+}
+
+// pageWindow — скорость и прирост счетчика за интервал.
+type pageWindow struct {
+	Rate, Increase string
+}
+
+// page выводит метрики HTML-таблицей в переданном порядке.
+// Для счетчиков выводятся скорость и прирост за интервалы, если включен их расчет.
+func (h *Handler) page(w http.ResponseWriter, r *http.Request, metrics []models.Metrics) {
+	var data pageData
+	rates := make([]*models.CounterRates, len(metrics))
+	for i, m := range metrics {
+		rates[i] = h.counterRates(m)
+		if rates[i] == nil {
+			continue
+		}
+		for _, wr := range rates[i].Windows {
+			if !contains(data.Windows, wr.Window) {
+				data.Windows = append(data.Windows, wr.Window)
+			}
+		}
+	}
+
+	sort.Slice(data.Windows, func(i, j int) bool {
+		a, _ := time.ParseDuration(data.Windows[i])
+		b, _ := time.ParseDuration(data.Windows[j])
+		return a < b
+	})
+
+	for i, m := range metrics {
+		row := pageRow{ID: m.ID, Type: m.MType, Windows: make([]pageWindow, len(data.Windows))}
+		switch {
+		case m.Value != nil:
+			row.Value = formatFloat(*m.Value)
+		case m.Delta != nil:
+			row.Value = strconv.FormatInt(*m.Delta, 10)
+		}
+		if r := rates[i]; r != nil {
+			if r.Rate != nil {
+				row.Rate = formatFloat(*r.Rate)
+			}
+			for _, wr := range r.Windows {
+				for j, window := range data.Windows {
+					if window == wr.Window {
+						row.Windows[j] = pageWindow{Rate: formatFloat(wr.Rate), Increase: formatFloat(wr.Increase)}
+					}
+				}
+			}
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	// Страница собирается целиком, чтобы при ошибке шаблона можно было ответить ошибкой
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, data); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.Internal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
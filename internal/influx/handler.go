@@ -0,0 +1,273 @@
+package influx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"go.uber.org/zap"
+)
+
+// maxLineBytes — максимальная длина строки line protocol.
+const maxLineBytes = 64 << 10
+
+// Handler принимает метрики в формате line protocol и сохраняет их в хранилище.
+type Handler struct {
+	storage  handler.Storager
+	template *models.IDTemplate
+	counters []string
+	logger   *zap.SugaredLogger
+
+	mu     sync.Mutex       // Делает вычисление приростов, сохранение и обновление totals одним шагом
+	totals map[string]int64 // Последние сохраненные накопленные значения счетчиков по ID метрики
+}
+
+// NewHandler создает обработчик с шаблоном ID и шаблонами счетчиков из cfg.
+func NewHandler(cfg config.InfluxConfig, storage handler.Storager, logger *zap.SugaredLogger) (*Handler, error) {
+	template, err := models.ParseIDTemplate(cfg.Template, "measurement", "field")
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range cfg.Counters {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid counter pattern %q: %w", pattern, err)
+		}
+	}
+
+	return &Handler{
+		storage:  storage,
+		template: template,
+		counters: cfg.Counters,
+		logger:   logger,
+		totals:   make(map[string]int64),
+	}, nil
+}
+
+// ServeHTTP обрабатывает POST /write. Параметр precision задает единицы меток времени
+// (ns, us, ms, s). Метки времени проверяются, но значения сохраняются с временем приема.
+//
+// Каждая строка обрабатывается отдельно: некорректная строка не мешает сохранить остальные.
+// Если все строки приняты, отвечает 204; иначе — ошибка в формате application/problem+json
+// с числом сохраненных метрик в поле written и ошибками по строкам в errors
+// (поле вида "line 2"). Если хотя бы одну строку не удалось сохранить из-за ошибки
+// хранилища, статус ответа — 503, иначе — 400.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	precision, err := ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.InvalidParameter, err.Error()).
+			Field("precision", problem.InvalidParameter, err.Error()))
+		return
+	}
+
+	var (
+		written int
+		errs    []problem.FieldError
+	)
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineBytes)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		n, err := h.writeLine(line, precision)
+		written += n
+		if err != nil {
+			errs = append(errs, lineError(lineNo, err))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		errs = append(errs, problem.FieldError{Field: lineField(lineNo + 1), Code: problem.InvalidBody, Detail: readError(err)})
+	}
+
+	if len(errs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Ошибка хранилища не зависит от запроса: клиент должен повторить его позже, а не исправлять
+	status, code := http.StatusBadRequest, errs[0].Code
+	for _, e := range errs {
+		if e.Code == problem.StorageUnavailable {
+			status, code = http.StatusServiceUnavailable, problem.StorageUnavailable
+			break
+		}
+	}
+
+	h.logger.Warnf("influx: rejected %d lines, first: %s", len(errs), errs[0].Detail)
+	p := problem.New(status, code, fmt.Sprintf("rejected lines: %d", len(errs))).With("written", written)
+	p.Errors = errs
+	problem.Write(w, r, p)
+}
+
+// saveError — ошибка сохранения метрики в хранилище.
+type saveError struct {
+	id  string
+	err error
+}
+
+func (e *saveError) Error() string { return "save " + e.id + ": " + e.err.Error() }
+func (e *saveError) Unwrap() error { return e.err }
+
+// lineError описывает ошибку строки lineNo с кодом, зависящим от причины.
+func lineError(lineNo int, err error) problem.FieldError {
+	code := problem.InvalidBody
+	var sErr *saveError
+	switch {
+	case errors.Is(err, handler.ErrTypeConflict):
+		code = problem.TypeConflict
+	case errors.Is(err, models.ErrInvalidID):
+		code = problem.InvalidID
+	case errors.Is(err, models.ErrInvalidValue):
+		code = problem.InvalidValue
+	case errors.As(err, &sErr):
+		code = problem.StorageUnavailable
+	}
+	return problem.FieldError{Field: lineField(lineNo), Code: code, Detail: err.Error()}
+}
+
+// lineField возвращает имя поля ошибки для строки lineNo.
+func lineField(lineNo int) string {
+	return "line " + strconv.Itoa(lineNo)
+}
+
+// readError описывает ошибку чтения тела запроса.
+func readError(err error) string {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		return fmt.Sprintf("line is longer than %d bytes", maxLineBytes)
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit)
+	default:
+		return err.Error()
+	}
+}
+
+// writeLine разбирает строку и сохраняет ее поля. Сначала проверяются все поля строки,
+// чтобы строка с ошибкой не была сохранена частично. Строковые поля пропускаются.
+func (h *Handler) writeLine(line string, precision time.Duration) (int, error) {
+	p, err := ParseLine(line, precision)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics := make([]models.Metrics, 0, len(p.Fields))
+	for _, f := range p.Fields {
+		if f.Kind == FieldString {
+			continue
+		}
+		id, err := h.template.Execute(map[string]string{"measurement": p.Measurement, "field": f.Key}, p.Tags)
+		if err != nil {
+			return 0, err
+		}
+
+		if !h.isCounter(p.Measurement, f.Key) {
+			value := f.Number
+			metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+			continue
+		}
+
+		total := f.Int
+		if f.Kind == FieldFloat {
+			if f.Number != math.Trunc(f.Number) || math.Abs(f.Number) > 1<<53 {
+				return 0, fmt.Errorf("field %q: counter value %v is not an integer", f.Key, f.Number)
+			}
+			total = int64(f.Number)
+		}
+		if f.Kind == FieldBool || total < 0 {
+			return 0, fmt.Errorf("field %q: counter value must be a non-negative integer", f.Key)
+		}
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &total})
+	}
+
+	for _, m := range metrics {
+		if err = m.Validate(); err != nil {
+			return 0, fmt.Errorf("metric %q: %w", m.ID, err)
+		}
+	}
+
+	return h.save(metrics)
+}
+
+// save сохраняет поля строки одним пакетом, чтобы строка не была сохранена частично.
+// Для счетчиков сохраняется прирост, а накопленные значения запоминаются только после
+// успешного сохранения: иначе прирост отклоненной строки был бы потерян.
+func (h *Handler) save(metrics []models.Metrics) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	totals := make(map[string]int64) // Новые накопленные значения счетчиков строки
+	batch := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if m.MType == models.Counter {
+			total := *m.Delta
+			delta, ok := h.counterDelta(m.ID, total, totals)
+			totals[m.ID] = total
+			if !ok {
+				continue
+			}
+			m.Delta = &delta
+		}
+		batch = append(batch, m)
+	}
+
+	if len(batch) > 0 {
+		if _, err := h.storage.SaveBatch(batch); err != nil {
+			var batchErr *handler.BatchError
+			if errors.As(err, &batchErr) {
+				return 0, &saveError{id: batch[batchErr.Index].ID, err: batchErr.Err}
+			}
+			ids := make([]string, len(batch))
+			for i, m := range batch {
+				ids[i] = m.ID
+			}
+			return 0, &saveError{id: strings.Join(ids, ", "), err: err}
+		}
+	}
+	for id, total := range totals {
+		h.totals[id] = total
+	}
+	return len(batch), nil
+}
+
+// counterDelta возвращает прирост счетчика id относительно прошлого накопленного значения:
+// из pending, если счетчик уже встречался в строке, иначе из сохраненных. Уменьшение
+// значения считается сбросом счетчика. Нулевой прирост не сохраняется. Вызывается под h.mu.
+func (h *Handler) counterDelta(id string, total int64, pending map[string]int64) (int64, bool) {
+	prev, seen := pending[id]
+	if !seen {
+		prev, seen = h.totals[id]
+	}
+
+	delta := total - prev
+	if total < prev {
+		delta = total // Источник перезапустился, счетчик начался заново
+	}
+	return delta, !seen || delta != 0
+}
+
+// isCounter сообщает, что поле field измерения measurement — накопленный счетчик.
+func (h *Handler) isCounter(measurement, field string) bool {
+	key := measurement + "." + field
+	for _, pattern := range h.counters {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package influx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr string
+	}{
+		{
+			name: "tags, fields and timestamp",
+			line: "cpu,host=web1,region=eu usage=0.5,count=3i,up=true 1700000000000000000",
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "web1", "region": "eu"},
+				Fields: []Field{
+					{Key: "usage", Kind: FieldFloat, Number: 0.5},
+					{Key: "count", Kind: FieldInt, Number: 3, Int: 3},
+					{Key: "up", Kind: FieldBool, Number: 1},
+				},
+				Time: time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "escaping",
+			line: `disk\ io,path=/var\,log,dev\=x=sd\ a free\ bytes=10u,msg="say \"hi\", ok" `,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "/var,log", "dev=x": "sd a"},
+				Fields: []Field{
+					{Key: "free bytes", Kind: FieldUint, Number: 10, Int: 10},
+					{Key: "msg", Kind: FieldString, Str: `say "hi", ok`},
+				},
+			},
+		},
+		{name: "missing fields", line: "cpu,host=a", wantErr: "missing fields"},
+		{name: "tag without value", line: "cpu,host usage=1", wantErr: `tag "host": missing value`},
+		{name: "field without value", line: "cpu usage=", wantErr: `field "usage": missing value`},
+		{name: "invalid integer", line: "cpu count=1.5i", wantErr: `invalid integer "1.5i"`},
+		{name: "nan", line: "cpu usage=NaN", wantErr: `invalid number "NaN"`},
+		{name: "unterminated string", line: `cpu msg="oops`, wantErr: "unterminated string"},
+		{name: "invalid timestamp", line: "cpu usage=1 yesterday", wantErr: `invalid timestamp "yesterday"`},
+		{name: "trailing garbage", line: "cpu usage=1 1700000000 extra", wantErr: `unexpected "extra"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLine(tt.line, time.Nanosecond)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.InfluxConfig
+		query      string
+		body       string
+		existing   []models.Metrics // Метрики, сохраненные до запроса
+		failIDs    []string         // ID метрик, сохранение которых завершается ошибкой хранилища
+		wantStatus int
+		wantBody   string
+		want       map[string]float64
+	}{
+		{
+			name:       "default template folds tags into ID",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}{tags}"},
+			query:      "?precision=s",
+			body:       "# comment\n\nmem,host=web1 used=512,free=256i 1700000000\n",
+			wantStatus: http.StatusNoContent,
+			want:       map[string]float64{"mem_used;host=web1": 512, "mem_free;host=web1": 256},
+		},
+		{
+			name:       "explicit tag in template",
+			cfg:        config.InfluxConfig{Template: "{host}.{measurement}.{field}{tags}"},
+			body:       "mem,host=web1,dc=eu used=1\nmem,dc=eu used=2\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body","detail":"rejected lines: 1","instance":"/write","written":1,
+				"errors":[{"field":"line 2","code":"invalid_body","detail":"tag \"host\" required by the metric ID template is missing"}]}`,
+			want: map[string]float64{"web1.mem.used;dc=eu": 1},
+		},
+		{
+			name:       "bad line does not reject batch",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}"},
+			body:       "cpu usage=1\ncpu usage=oops,idle=2\ncpu idle=3\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body","detail":"rejected lines: 1","instance":"/write","written":2,
+				"errors":[{"field":"line 2","code":"invalid_body","detail":"field \"usage\": invalid number \"oops\""}]}`,
+			want: map[string]float64{"cpu_usage": 1, "cpu_idle": 3},
+		},
+		{
+			name:       "cumulative counters",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}", Counters: []string{"net.bytes_*"}},
+			body:       "net bytes_recv=100i,errors=1i\nnet bytes_recv=150i\nnet bytes_recv=20i\nnet bytes_recv=-1i\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_body","detail":"rejected lines: 1","instance":"/write","written":4,
+				"errors":[{"field":"line 4","code":"invalid_body","detail":"field \"bytes_recv\": counter value must be a non-negative integer"}]}`,
+			want: map[string]float64{"net_bytes_recv": 100 + 50 + 20, "net_errors": 1},
+		},
+		{
+			name:       "storage failure",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}"},
+			body:       "cpu usage=1\ncpu usage=oops\ncpu idle=3\n",
+			failIDs:    []string{"cpu_idle"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: `{"type":"about:blank","title":"Service Unavailable","status":503,"code":"storage_unavailable","detail":"rejected lines: 2","instance":"/write","written":1,
+				"errors":[{"field":"line 2","code":"invalid_body","detail":"field \"usage\": invalid number \"oops\""},
+				{"field":"line 3","code":"storage_unavailable","detail":"save cpu_idle: storage unavailable"}]}`,
+			want: map[string]float64{"cpu_usage": 1},
+		},
+		{
+			name:       "type conflict rejects the whole line",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}"},
+			existing:   []models.Metrics{{ID: "cpu_idle", MType: models.Counter, Delta: func() *int64 { d := int64(7); return &d }()}},
+			body:       "cpu usage=1,idle=2\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"type_conflict","detail":"rejected lines: 1","instance":"/write","written":0,
+				"errors":[{"field":"line 1","code":"type_conflict","detail":"save cpu_idle: metric already exists with another type: cpu_idle is a counter"}]}`,
+			want: map[string]float64{"cpu_idle": 7},
+		},
+		{
+			name:       "unknown precision",
+			cfg:        config.InfluxConfig{Template: "{measurement}_{field}"},
+			query:      "?precision=h",
+			body:       "cpu usage=1\n",
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_parameter","detail":"unknown precision \"h\", expected ns, us, ms or s","instance":"/write",
+				"errors":[{"field":"precision","code":"invalid_parameter","detail":"unknown precision \"h\", expected ns, us, ms or s"}]}`,
+			want: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemStorage()
+			for _, m := range tt.existing {
+				require.NoError(t, s.Save(m))
+			}
+			h, err := NewHandler(tt.cfg, &failingStorage{Storager: s, failIDs: tt.failIDs}, zap.NewNop().Sugar())
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/write"+tt.query, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if strings.HasPrefix(tt.wantBody, "{") {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			} else {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+
+			got := make(map[string]float64)
+			for _, m := range s.GetAll() {
+				if m.MType == models.Counter {
+					got[m.ID] = float64(*m.Delta)
+				} else {
+					got[m.ID] = *m.Value
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// failingStorage отклоняет сохранение метрик с ID из failIDs.
+type failingStorage struct {
+	handler.Storager
+	failIDs []string
+}
+
+func (s *failingStorage) SaveBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	for _, m := range metrics {
+		if slices.Contains(s.failIDs, m.ID) {
+			return nil, errors.New("storage unavailable")
+		}
+	}
+	return s.Storager.SaveBatch(metrics)
+}
+
+func TestHandler_FailedSaveKeepsCounter(t *testing.T) {
+	s := &failingStorage{Storager: storage.NewMemStorage()}
+	h, err := NewHandler(config.InfluxConfig{Template: "{measurement}_{field}", Counters: []string{"net.*"}}, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	write := func(body string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body)))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusNoContent, write("net bytes=100i"))
+
+	// Прирост отклоненной строки сохраняется вместе со следующей.
+	s.failIDs = []string{"net_bytes"}
+	require.Equal(t, http.StatusServiceUnavailable, write("net bytes=150i"))
+	s.failIDs = nil
+	require.Equal(t, http.StatusNoContent, write("net bytes=170i"))
+
+	m, ok := s.Get(models.Counter, "net_bytes")
+	require.True(t, ok)
+	assert.Equal(t, int64(170), *m.Delta)
+}
+
+func TestNewHandler_InvalidTemplate(t *testing.T) {
+	for _, tmpl := range []string{"", "{measurement", "{}_{field}"} {
+		_, err := NewHandler(config.InfluxConfig{Template: tmpl}, storage.NewMemStorage(), zap.NewNop().Sugar())
+		assert.Error(t, err, tmpl)
+	}
+}
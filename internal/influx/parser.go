@@ -0,0 +1,221 @@
+// Package influx реализует прием метрик в формате InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Каждое поле строки сохраняется как отдельная метрика gauge или counter,
+// а measurement, имя поля и теги складываются в ID метрики по шаблону.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды значений полей.
+const (
+	FieldFloat = iota
+	FieldInt
+	FieldUint
+	FieldBool
+	FieldString
+)
+
+// Field — поле строки line protocol.
+type Field struct {
+	Key    string
+	Kind   int     // Вид значения: FieldFloat, FieldInt и т. д.
+	Number float64 // Числовое значение, для bool — 1 или 0
+	Int    int64   // Значение для FieldInt и FieldUint, если оно помещается в int64
+	Str    string  // Значение для FieldString
+}
+
+// Point — разобранная строка line protocol.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Time        time.Time // Нулевое, если метка времени не указана
+}
+
+// precisions — множители для меток времени в разных единицах (параметр precision).
+var precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// ParsePrecision проверяет единицу меток времени и возвращает ее длительность.
+func ParsePrecision(s string) (time.Duration, error) {
+	p, ok := precisions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown precision %q, expected ns, us, ms or s", s)
+	}
+	return p, nil
+}
+
+// ParseLine разбирает строку line protocol. Метка времени задается в единицах precision.
+// Пустые строки и комментарии (#) должны быть отброшены до вызова.
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	var p Point
+
+	measurement, i := scanEscaped(line, 0, ", ", ", ")
+	if measurement == "" {
+		return Point{}, errors.New("missing measurement")
+	}
+	p.Measurement = measurement
+
+	// Теги
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scanEscaped(line, i+1, ",= ", ",= ")
+		if i >= len(line) || line[i] != '=' {
+			return Point{}, fmt.Errorf("tag %q: missing value", key)
+		}
+		value, i = scanEscaped(line, i+1, ",= ", ",= ")
+		if key == "" || value == "" {
+			return Point{}, fmt.Errorf("tag %q: empty key or value", key)
+		}
+		if p.Tags == nil {
+			p.Tags = make(map[string]string)
+		}
+		p.Tags[key] = value
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return Point{}, errors.New("missing fields")
+	}
+	i = skipSpaces(line, i)
+
+	// Поля
+	for {
+		var key string
+		key, i = scanEscaped(line, i, ",= ", ",= ")
+		if key == "" {
+			return Point{}, errors.New("missing field key")
+		}
+		if i >= len(line) || line[i] != '=' {
+			return Point{}, fmt.Errorf("field %q: missing value", key)
+		}
+
+		field, next, err := parseFieldValue(line, i+1)
+		if err != nil {
+			return Point{}, fmt.Errorf("field %q: %w", key, err)
+		}
+		field.Key = key
+		p.Fields = append(p.Fields, field)
+
+		i = next
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	// Метка времени
+	if i < len(line) && line[i] != ' ' {
+		return Point{}, fmt.Errorf("unexpected %q after fields", line[i])
+	}
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		end := strings.IndexByte(line[i:], ' ')
+		if end < 0 {
+			end = len(line) - i
+		}
+		ts, err := strconv.ParseInt(line[i:i+end], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid timestamp %q", line[i:i+end])
+		}
+		if rest := strings.TrimSpace(line[i+end:]); rest != "" {
+			return Point{}, fmt.Errorf("unexpected %q after timestamp", rest)
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+	return p, nil
+}
+
+// parseFieldValue разбирает значение поля, начинающееся с line[i], и возвращает позицию после него.
+func parseFieldValue(line string, i int) (Field, int, error) {
+	if i < len(line) && line[i] == '"' {
+		var b strings.Builder
+		for j := i + 1; j < len(line); j++ {
+			switch c := line[j]; {
+			case c == '\\' && j+1 < len(line) && (line[j+1] == '"' || line[j+1] == '\\'):
+				b.WriteByte(line[j+1])
+				j++
+			case c == '"':
+				return Field{Kind: FieldString, Str: b.String()}, j + 1, nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return Field{}, 0, errors.New("unterminated string value")
+	}
+
+	end := i
+	for end < len(line) && line[end] != ',' && line[end] != ' ' {
+		end++
+	}
+	raw := line[i:end]
+	if raw == "" {
+		return Field{}, 0, errors.New("missing value")
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return Field{Kind: FieldBool, Number: 1}, end, nil
+	case "f", "F", "false", "False", "FALSE":
+		return Field{Kind: FieldBool, Number: 0}, end, nil
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return Field{}, 0, fmt.Errorf("invalid integer %q", raw)
+		}
+		return Field{Kind: FieldInt, Number: float64(n), Int: n}, end, nil
+	case 'u':
+		n, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return Field{}, 0, fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		return Field{Kind: FieldUint, Number: float64(n), Int: int64(min(n, 1<<63-1))}, end, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || strings.ContainsAny(raw, "nN") { // NaN и Inf в line protocol недопустимы
+		return Field{}, 0, fmt.Errorf("invalid number %q", raw)
+	}
+	return Field{Kind: FieldFloat, Number: v}, end, nil
+}
+
+// scanEscaped читает строку начиная с line[i] до первого неэкранированного символа из stop.
+// Обратная косая черта перед символом из escapable убирается.
+func scanEscaped(line string, i int, stop, escapable string) (string, int) {
+	var b strings.Builder
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(escapable, line[i+1]) >= 0 {
+			b.WriteByte(line[i+1])
+			i++
+			continue
+		}
+		if strings.IndexByte(stop, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
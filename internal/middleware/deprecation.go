@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecated — middleware для устаревших маршрутов, у которых есть замена в версионированном API.
+// Добавляет к ответу заголовок Deprecation с моментом устаревания since в формате RFC 9745
+// (@ и секунды Unix) и заголовок Link со ссылкой successor и rel="successor-version",
+// чтобы клиенты могли заметить устаревание, не меняя обработку ответа.
+func Deprecated(h http.Handler, successor string, since time.Time) http.Handler {
+	deprecation := "@" + strconv.FormatInt(since.Unix(), 10)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gzipReadCloser распаковывает тело запроса и закрывает как распаковщик, так и исходное тело.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close закрывает распаковщик и исходное тело запроса.
+func (r *gzipReadCloser) Close() error {
+	if err := r.Reader.Close(); err != nil {
+		return err
+	}
+	return r.body.Close()
+}
+
+// Gzip — middleware, которое распаковывает тела запросов с заголовком Content-Encoding: gzip.
+// Обработчики получают уже распакованное тело и не зависят от способа передачи.
+func Gzip(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeReadError(w, r, fmt.Errorf("invalid gzip body: %w", err))
+			return
+		}
+
+		r.Body = &gzipReadCloser{Reader: zr, body: r.Body}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyHeader — заголовок, в котором клиент передает ключ идемпотентности запроса.
+const IdempotencyHeader = "Idempotency-Key"
+
+type (
+	// IdempotencyCache хранит ответы на запросы с ключом идемпотентности в течение ttl.
+	IdempotencyCache struct {
+		mu        sync.Mutex
+		ttl       time.Duration
+		entries   map[string]*idempotencyEntry
+		lastSweep time.Time
+	}
+
+	// idempotencyEntry — сохраненный ответ на запрос. Канал done закрывается,
+	// когда первый запрос с этим ключом обработан.
+	idempotencyEntry struct {
+		done    chan struct{}
+		status  int
+		header  http.Header
+		body    []byte
+		expires time.Time
+	}
+
+	// recordingResponseWriter дублирует ответ в буфер, чтобы его можно было повторить.
+	recordingResponseWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// NewIdempotencyCache создает кэш ответов с заданным временем жизни записей.
+func NewIdempotencyCache(ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+// Idempotency — middleware, которое не выполняет повторно запросы с уже обработанным ключом
+// идемпотентности, а возвращает сохраненный ответ. Одновременные запросы с одним ключом
+// ждут завершения первого. Сохраняются только успешные ответы, чтобы после ошибки
+// клиент мог повторить запрос.
+func Idempotency(h http.Handler, cache *IdempotencyCache) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key = r.Method + " " + r.URL.Path + " " + key
+
+		entry, owner := cache.acquire(key)
+		if !owner {
+			<-entry.done
+			if entry.status != 0 {
+				replay(w, entry)
+				return
+			}
+			// Первый запрос завершился ошибкой — обрабатываем этот как новый.
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		defer func() {
+			cache.release(key, entry, rw)
+		}()
+
+		h.ServeHTTP(rw, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// acquire возвращает запись для ключа. owner равен true, если запись создана
+// этим вызовом и запрос должен быть обработан.
+func (c *IdempotencyCache) acquire(key string) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if e, ok := c.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+
+	e := &idempotencyEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true
+}
+
+// release сохраняет успешный ответ или удаляет запись, если запрос завершился ошибкой.
+func (c *IdempotencyCache) release(key string, e *idempotencyEntry, rw *recordingResponseWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status < 300 {
+		e.status = status
+		e.header = rw.Header().Clone()
+		e.body = rw.body.Bytes()
+		e.expires = time.Now().Add(c.ttl)
+	} else {
+		delete(c.entries, key)
+	}
+	close(e.done)
+}
+
+// replay записывает сохраненный ответ.
+func replay(w http.ResponseWriter, e *idempotencyEntry) {
+	for k, v := range e.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(e.status)
+	_, _ = w.Write(e.body)
+}
+
+// Write реализует интерфейс http.ResponseWriter и сохраняет копию тела ответа.
+func (r *recordingResponseWriter) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// WriteHeader реализует интерфейс http.ResponseWriter и сохраняет статус ответа.
+func (r *recordingResponseWriter) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("ok"))
+	}), NewIdempotencyCache(time.Minute))
+
+	do := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader("[]"))
+		if key != "" {
+			r.Header.Set(IdempotencyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	do("a")
+	replayed := do("a")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "ok", replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+
+	do("")
+	do("")
+	assert.Equal(t, 3, calls)
+
+	// Неуспешные ответы не запоминаются, повтор выполняется заново.
+	status = http.StatusInternalServerError
+	do("b")
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, do("b").Code)
+	assert.Equal(t, 5, calls)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// BodyLimit — middleware, которое ограничивает размер тела запроса n байтами.
+// Запрос с заведомо большим Content-Length отклоняется со статусом 413 до чтения тела,
+// а при чтении тела сверх лимита обработчик получает ошибку.
+func BodyLimit(h http.Handler, n int64) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			problem.Error(w, r, http.StatusRequestEntityTooLarge, problem.BodyTooLarge,
+				fmt.Sprintf("request body is larger than %d bytes", n))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// writeReadError отвечает на ошибку чтения тела запроса: 413, если тело больше лимита
+// BodyLimit, иначе 400.
+func writeReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, problem.BodyTooLarge,
+			fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	problem.Error(w, r, http.StatusBadRequest, problem.InvalidBody, err.Error())
+}
@@ -4,6 +4,8 @@
 package middleware
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"time"
 
@@ -65,3 +67,18 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 	r.ResponseWriter.WriteHeader(statusCode)
 }
+
+// Unwrap возвращает исходный http.ResponseWriter, чтобы http.ResponseController
+// мог вызвать Flush и управлять таймаутами соединения, например для потоковых ответов.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack позволяет обработчику забрать соединение, например для перехода на WebSocket.
+func (r *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.responseData.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
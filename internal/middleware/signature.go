@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// SignatureHeader — заголовок с подписью HMAC-SHA256 тела запроса или ответа в шестнадцатеричном виде.
+const SignatureHeader = "HashSHA256"
+
+// Sign возвращает подпись HMAC-SHA256 данных data ключом key в шестнадцатеричном виде.
+func Sign(key string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureResponseWriter накапливает тело ответа, чтобы подписать его целиком.
+// Если обработчик сбрасывает ответ (потоковые ответы, например Server-Sent Events),
+// накопленное отправляется без подписи, а дальнейшая запись идет напрямую.
+type signatureResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+// WriteHeader откладывает отправку статуса до вычисления подписи.
+func (w *signatureResponseWriter) WriteHeader(status int) {
+	if !w.streaming {
+		w.status = status
+	}
+}
+
+// Write накапливает тело ответа или, после сброса, пишет его напрямую.
+func (w *signatureResponseWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// FlushError переводит ответ в потоковый режим: потоковый ответ нельзя подписать,
+// потому что подпись передается в заголовке до тела. Вызывается через http.ResponseController.
+func (w *signatureResponseWriter) FlushError() error {
+	if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.WriteHeader(w.status)
+		if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+			return err
+		}
+		w.body.Reset()
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Flush реализует http.Flusher для обработчиков, которые не используют http.ResponseController.
+func (w *signatureResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// Unwrap возвращает исходный http.ResponseWriter, чтобы http.ResponseController
+// мог управлять таймаутами соединения.
+func (w *signatureResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Signature — middleware, которое проверяет подпись тела запроса и подписывает тело ответа.
+//
+// Подпись необязательна для клиента: она защищает от искажения тела, но не аутентифицирует
+// отправителя. Запросы без заголовка HashSHA256 принимаются без проверки, чтобы клиенты
+// без ключа (например, pkg/client) продолжали работать; запрос с неверной подписью
+// отклоняется со статусом 400. Ограничивать доступ к серверу нужно средствами сети или TLS.
+//
+// Ответ подписывается, если обработчик не сбрасывал его до завершения. Потоковые ответы
+// (обработчик вызвал Flush) и переход на WebSocket не буферизуются и не подписываются.
+// Если ключ пуст, middleware ничего не делает.
+func Signature(h http.Handler, key string) http.Handler {
+	if key == "" {
+		return h
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if sign := r.Header.Get(SignatureHeader); sign != "" {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeReadError(w, r, err)
+				return
+			}
+			if !hmac.Equal([]byte(sign), []byte(Sign(key, body))) {
+				problem.Error(w, r, http.StatusBadRequest, problem.InvalidSignature, SignatureHeader+" does not match the request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		sw := &signatureResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		if sw.streaming {
+			return
+		}
+
+		w.Header().Set(SignatureHeader, Sign(key, sw.body.Bytes()))
+		w.WriteHeader(sw.status)
+		_, _ = w.Write(sw.body.Bytes())
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	const key = "secret"
+
+	tests := []struct {
+		name       string
+		body       string
+		sign       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantSigned bool
+	}{
+		{
+			name: "signed response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   "ok",
+			wantSigned: true,
+		},
+		{
+			name: "streaming response is not buffered",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte("data: 1\n\n"))
+				require.NoError(t, http.NewResponseController(w).Flush())
+				_, _ = w.Write([]byte("data: 2\n\n"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "data: 1\n\ndata: 2\n\n",
+		},
+		{
+			name:       "invalid request signature",
+			body:       `{"id":"a"}`,
+			sign:       Sign(key, []byte("other")),
+			handler:    func(w http.ResponseWriter, r *http.Request) { t.Error("handler must not be called") },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unsigned request is accepted",
+			body: `{"id":"a"}`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+			wantSigned: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.sign != "" {
+				r.Header.Set(SignatureHeader, tt.sign)
+			}
+			w := httptest.NewRecorder()
+			Signature(tt.handler, key).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.wantSigned {
+				assert.Equal(t, Sign(key, []byte(tt.wantBody)), w.Header().Get(SignatureHeader))
+			} else {
+				assert.Empty(t, w.Header().Get(SignatureHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TagSeparator отделяет имя метрики от тегов и теги друг от друга в идентификаторе.
+const TagSeparator = ";"
+
+// TaggedID формирует идентификатор метрики из имени и тегов в формате
+// name;key1=value1;key2=value2. Теги сортируются по ключу, чтобы одинаковый набор
+// тегов всегда давал один и тот же идентификатор. Тег без значения записывается как key.
+func TaggedID(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString(TagSeparator)
+		b.WriteString(k)
+		if v := tags[k]; v != "" {
+			b.WriteString("=")
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// IDTemplate строит ID метрики из имени, полей и тегов по шаблону вида
+// "{measurement}_{field}{tags}". Подстановки:
+//   - поля, перечисленные при разборе шаблона, например {measurement};
+//   - {tags} — теги, не использованные в шаблоне явно, в формате ;key=value;
+//   - {имя_тега} — значение конкретного тега; если тега нет, построить ID нельзя.
+type IDTemplate struct {
+	parts []templatePart
+	refs  map[string]bool // Теги, явно использованные в шаблоне
+}
+
+// templatePart — часть шаблона: текст, поле или тег.
+type templatePart struct {
+	text  string // Текст без подстановки
+	field string // Имя поля
+	tag   string // Имя тега
+	tags  bool   // Подстановка {tags}
+}
+
+// ParseIDTemplate разбирает шаблон ID. fields — имена подстановок, значения которых
+// передаются в Execute; остальные подстановки, кроме {tags}, считаются именами тегов.
+func ParseIDTemplate(s string, fields ...string) (*IDTemplate, error) {
+	if s == "" {
+		return nil, errors.New("empty metric ID template")
+	}
+
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+
+	t := &IDTemplate{refs: make(map[string]bool)}
+	for rest := s; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{text: rest[:start]})
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed {", s)
+		}
+		name := rest[start+1 : start+end]
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("template %q: empty placeholder", s)
+		case name == "tags":
+			t.parts = append(t.parts, templatePart{tags: true})
+		case known[name]:
+			t.parts = append(t.parts, templatePart{field: name})
+		default:
+			t.parts = append(t.parts, templatePart{tag: name})
+			t.refs[name] = true
+		}
+		rest = rest[start+end+1:]
+	}
+	return t, nil
+}
+
+// Execute строит ID из значений полей и тегов.
+func (t *IDTemplate) Execute(fields, tags map[string]string) (string, error) {
+	var b strings.Builder
+	for _, part := range t.parts {
+		switch {
+		case part.field != "":
+			b.WriteString(fields[part.field])
+		case part.tag != "":
+			v, ok := tags[part.tag]
+			if !ok {
+				return "", fmt.Errorf("tag %q required by the metric ID template is missing", part.tag)
+			}
+			b.WriteString(v)
+		case part.tags:
+			rest := make(map[string]string, len(tags))
+			for k, v := range tags {
+				if !t.refs[k] {
+					rest[k] = v
+				}
+			}
+			// TaggedID без имени дает ;key=value;... с тегами, отсортированными по ключу
+			b.WriteString(TaggedID("", rest))
+		default:
+			b.WriteString(part.text)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,15 @@
+package models
+
+// WindowRate — скорость изменения счетчика за интервал.
+type WindowRate struct {
+	Window   string  `json:"window"`   // Интервал, например 5m0s
+	Rate     float64 `json:"rate"`     // Средний прирост в секунду
+	Increase float64 `json:"increase"` // Прирост за интервал
+}
+
+// CounterRates — скорость изменения счетчика: между двумя последними значениями
+// и за настроенные на сервере интервалы. Сбросы счетчика учитываются так же, как в Prometheus.
+type CounterRates struct {
+	Rate    *float64     `json:"rate,omitempty"`  // Прирост в секунду между двумя последними значениями
+	Windows []WindowRate `json:"rates,omitempty"` // Скорость и прирост за интервалы
+}
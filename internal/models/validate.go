@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxIDLength — максимальная длина ID метрики в байтах.
+const MaxIDLength = 256
+
+// Причины, по которым метрика не проходит проверку. По ним вызывающий код
+// определяет код ошибки, не разбирая текст.
+var (
+	ErrMissingID    = errors.New("metric id is missing")
+	ErrInvalidID    = errors.New("invalid metric id")
+	ErrUnknownType  = errors.New("unknown metric type")
+	ErrInvalidValue = errors.New("invalid metric value")
+)
+
+// FieldError — ошибка в одном поле метрики.
+type FieldError struct {
+	Field  string // Имя поля JSON: id, type, delta или value
+	Err    error  // Причина: ErrMissingID, ErrInvalidID, ErrUnknownType или ErrInvalidValue
+	Detail string // Описание ошибки для человека
+}
+
+func (e FieldError) Error() string { return e.Field + ": " + e.Detail }
+func (e FieldError) Unwrap() error { return e.Err }
+
+// ValidationError — ошибки во всех некорректных полях метрики.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap позволяет проверять причины ошибок через errors.Is.
+func (e ValidationError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// ValidateID проверяет ID метрики: он не пустой, не длиннее MaxIDLength байт
+// и состоит из печатных символов UTF-8.
+func ValidateID(id string) error {
+	switch {
+	case id == "":
+		return FieldError{Field: "id", Err: ErrMissingID, Detail: "must not be empty"}
+	case len(id) > MaxIDLength:
+		return FieldError{Field: "id", Err: ErrInvalidID, Detail: fmt.Sprintf("must be at most %d bytes", MaxIDLength)}
+	case !utf8.ValidString(id) || strings.IndexFunc(id, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0:
+		return FieldError{Field: "id", Err: ErrInvalidID, Detail: "must contain only printable characters"}
+	}
+	return nil
+}
+
+// Validate проверяет метрику перед сохранением: корректность ID, известный тип
+// и соответствие полей типу — у counter задан только delta, у gauge только конечное value.
+// Возвращает ValidationError со всеми найденными ошибками или nil.
+func (m Metrics) Validate() error {
+	var errs ValidationError
+	fail := func(field string, err error, detail string) {
+		errs = append(errs, FieldError{Field: field, Err: err, Detail: detail})
+	}
+
+	var idErr FieldError
+	if errors.As(ValidateID(m.ID), &idErr) {
+		errs = append(errs, idErr)
+	}
+
+	switch m.MType {
+	case Counter:
+		if m.Delta == nil {
+			fail("delta", ErrInvalidValue, "counter requires an integer delta")
+		}
+		if m.Value != nil {
+			fail("value", ErrInvalidValue, "counter must not have a value")
+		}
+	case Gauge:
+		switch {
+		case m.Value == nil:
+			fail("value", ErrInvalidValue, "gauge requires a value")
+		case math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0):
+			fail("value", ErrInvalidValue, "must be a finite number")
+		}
+		if m.Delta != nil {
+			fail("delta", ErrInvalidValue, "gauge must not have a delta")
+		}
+	default:
+		fail("type", ErrUnknownType, fmt.Sprintf("unknown metric type %q, expected gauge or counter", m.MType))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
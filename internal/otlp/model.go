@@ -0,0 +1,227 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Временность агрегации Sum и Histogram.
+const (
+	TemporalityUnspecified Temporality = 0
+	TemporalityDelta       Temporality = 1 // Точка содержит изменение с прошлой точки
+	TemporalityCumulative  Temporality = 2 // Точка содержит накопленное значение с StartTimeUnixNano
+)
+
+// Структуры ниже повторяют подмножество сообщений opentelemetry.proto.metrics.v1,
+// нужное приемнику. Теги json соответствуют кодировке OTLP/JSON.
+type (
+	// ExportRequest — тело запроса ExportMetricsServiceRequest.
+	ExportRequest struct {
+		ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+	}
+
+	// ResourceMetrics — метрики одного ресурса (сервиса).
+	ResourceMetrics struct {
+		Resource     Resource       `json:"resource"`
+		ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+	}
+
+	// Resource описывает источник метрик.
+	Resource struct {
+		Attributes []KeyValue `json:"attributes"`
+	}
+
+	// ScopeMetrics — метрики одной библиотеки инструментирования.
+	ScopeMetrics struct {
+		Scope   Scope    `json:"scope"`
+		Metrics []Metric `json:"metrics"`
+	}
+
+	// Scope — библиотека инструментирования.
+	Scope struct {
+		Name       string     `json:"name"`
+		Version    string     `json:"version"`
+		Attributes []KeyValue `json:"attributes"`
+	}
+
+	// Metric — метрика с точками данных одного из видов.
+	Metric struct {
+		Name                 string      `json:"name"`
+		Gauge                *Gauge      `json:"gauge"`
+		Sum                  *Sum        `json:"sum"`
+		Histogram            *Histogram  `json:"histogram"`
+		ExponentialHistogram *pointsOnly `json:"exponentialHistogram"`
+		Summary              *pointsOnly `json:"summary"`
+	}
+
+	// Gauge — мгновенные значения.
+	Gauge struct {
+		DataPoints []NumberDataPoint `json:"dataPoints"`
+	}
+
+	// Sum — сумма: монотонная (счетчик) или немонотонная (UpDownCounter).
+	Sum struct {
+		DataPoints             []NumberDataPoint `json:"dataPoints"`
+		AggregationTemporality Temporality       `json:"aggregationTemporality"`
+		IsMonotonic            bool              `json:"isMonotonic"`
+	}
+
+	// Histogram — гистограмма с явными границами корзин.
+	Histogram struct {
+		DataPoints             []HistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality Temporality          `json:"aggregationTemporality"`
+	}
+
+	// pointsOnly — метрика неподдерживаемого вида, у которой нужно только число точек.
+	pointsOnly struct {
+		DataPoints []struct{} `json:"dataPoints"`
+	}
+
+	// NumberDataPoint — точка Gauge или Sum.
+	NumberDataPoint struct {
+		Attributes        []KeyValue `json:"attributes"`
+		StartTimeUnixNano Uint64     `json:"startTimeUnixNano"`
+		TimeUnixNano      Uint64     `json:"timeUnixNano"`
+		AsDouble          *float64   `json:"asDouble"`
+		AsInt             *Int64     `json:"asInt"`
+	}
+
+	// HistogramDataPoint — точка гистограммы. BucketCounts на одну корзину больше,
+	// чем ExplicitBounds: последняя корзина — значения больше последней границы.
+	HistogramDataPoint struct {
+		Attributes        []KeyValue `json:"attributes"`
+		StartTimeUnixNano Uint64     `json:"startTimeUnixNano"`
+		TimeUnixNano      Uint64     `json:"timeUnixNano"`
+		Count             Uint64     `json:"count"`
+		Sum               *float64   `json:"sum"`
+		BucketCounts      []Uint64   `json:"bucketCounts"`
+		ExplicitBounds    []float64  `json:"explicitBounds"`
+	}
+
+	// KeyValue — атрибут.
+	KeyValue struct {
+		Key   string   `json:"key"`
+		Value AnyValue `json:"value"`
+	}
+
+	// AnyValue — значение атрибута одного из типов.
+	AnyValue struct {
+		StringValue *string       `json:"stringValue"`
+		BoolValue   *bool         `json:"boolValue"`
+		IntValue    *Int64        `json:"intValue"`
+		DoubleValue *float64      `json:"doubleValue"`
+		ArrayValue  *ArrayValue   `json:"arrayValue"`
+		KvlistValue *KeyValueList `json:"kvlistValue"`
+		BytesValue  []byte        `json:"bytesValue"`
+	}
+
+	// ArrayValue — список значений.
+	ArrayValue struct {
+		Values []AnyValue `json:"values"`
+	}
+
+	// KeyValueList — вложенный набор атрибутов.
+	KeyValueList struct {
+		Values []KeyValue `json:"values"`
+	}
+
+	// Temporality — временность агрегации. В JSON принимается число или имя из proto.
+	Temporality int32
+
+	// Uint64 — целое без знака. В JSON принимается число или строка, как требует OTLP/JSON для 64-битных чисел.
+	Uint64 uint64
+
+	// Int64 — целое со знаком. В JSON принимается число или строка.
+	Int64 int64
+)
+
+// String возвращает значение атрибута как строку.
+func (v AnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	case v.ArrayValue != nil:
+		items := make([]string, len(v.ArrayValue.Values))
+		for i, item := range v.ArrayValue.Values {
+			items[i] = item.String()
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case v.KvlistValue != nil:
+		items := make([]string, len(v.KvlistValue.Values))
+		for i, kv := range v.KvlistValue.Values {
+			items[i] = kv.Key + ":" + kv.Value.String()
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	default:
+		return ""
+	}
+}
+
+// Value возвращает значение точки как число.
+func (p NumberDataPoint) Value() (float64, bool) {
+	switch {
+	case p.AsDouble != nil:
+		return *p.AsDouble, true
+	case p.AsInt != nil:
+		return float64(*p.AsInt), true
+	default:
+		return 0, false
+	}
+}
+
+// temporalityNames — имена значений перечисления AggregationTemporality.
+var temporalityNames = map[string]Temporality{
+	"AGGREGATION_TEMPORALITY_UNSPECIFIED": TemporalityUnspecified,
+	"AGGREGATION_TEMPORALITY_DELTA":       TemporalityDelta,
+	"AGGREGATION_TEMPORALITY_CUMULATIVE":  TemporalityCumulative,
+}
+
+// UnmarshalJSON разбирает временность из числа или имени.
+func (t *Temporality) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		v, ok := temporalityNames[name]
+		if !ok {
+			return fmt.Errorf("unknown aggregation temporality %q", name)
+		}
+		*t = v
+		return nil
+	}
+	var n int32
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid aggregation temporality %s", data)
+	}
+	*t = Temporality(n)
+	return nil
+}
+
+// UnmarshalJSON разбирает число из числа или строки.
+func (u *Uint64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseUint(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid unsigned integer %s", data)
+	}
+	*u = Uint64(n)
+	return nil
+}
+
+// UnmarshalJSON разбирает число из числа или строки.
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*i = Int64(n)
+	return nil
+}
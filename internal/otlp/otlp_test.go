@@ -0,0 +1,332 @@
+package otlp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var defaultConfig = config.OTLPConfig{Template: "{name}{tags}", ResourceAttributes: []string{"service.name"}}
+
+// Функции ниже собирают сообщения OTLP в protobuf для тестов.
+
+func pbMessage(num protowire.Number, fields ...[]byte) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, bytes.Join(fields, nil))
+}
+
+func pbString(num protowire.Number, s string) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func pbVarint(num protowire.Number, v uint64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func pbFixed64(num protowire.Number, v uint64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func pbPacked(num protowire.Number, values ...uint64) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendFixed64(packed, v)
+	}
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+func pbAttr(num protowire.Number, key, value string) []byte {
+	return pbMessage(num, pbString(1, key), pbMessage(2, pbString(1, value)))
+}
+
+func post(rc *Receiver, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	rc.ServeHTTP(rec, req)
+	return rec
+}
+
+// values возвращает значения всех метрик хранилища по ID.
+func values(s handler.Storager) map[string]float64 {
+	got := make(map[string]float64)
+	for _, m := range s.GetAll() {
+		if m.MType == models.Counter {
+			got[m.ID] = float64(*m.Delta)
+		} else {
+			got[m.ID] = *m.Value
+		}
+	}
+	return got
+}
+
+func TestReceiver_Protobuf(t *testing.T) {
+	s := storage.NewMemStorage()
+	rc, err := NewReceiver(defaultConfig, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	// Счетчики начались после запуска приемника, поэтому первые точки сохраняются целиком.
+	start := uint64(time.Now().UnixNano())
+	request := pbMessage(1, // resource_metrics
+		pbMessage(1, pbAttr(1, "service.name", "api"), pbAttr(1, "host.name", "h1")),
+		pbMessage(2, // scope_metrics
+			pbMessage(1, pbString(1, "http"), pbString(2, "1.0")),
+			pbMessage(2, // gauge
+				pbString(1, "memory"),
+				pbMessage(5, pbMessage(1, pbAttr(7, "state", "used"), pbFixed64(4, math.Float64bits(0.5)))),
+			),
+			pbMessage(2, // монотонная накопленная сумма
+				pbString(1, "requests"),
+				pbMessage(7,
+					pbMessage(1, pbFixed64(2, start), pbFixed64(6, 42)),
+					pbVarint(2, uint64(TemporalityCumulative)),
+					pbVarint(3, 1),
+				),
+			),
+			pbMessage(2, // гистограмма
+				pbString(1, "latency"),
+				pbMessage(9,
+					pbMessage(1,
+						pbFixed64(2, start),
+						pbFixed64(4, 6),
+						pbFixed64(5, math.Float64bits(1.5)),
+						pbPacked(6, 1, 3, 2),
+						pbPacked(7, math.Float64bits(0.1), math.Float64bits(0.5)),
+					),
+					pbVarint(2, uint64(TemporalityCumulative)),
+				),
+			),
+		),
+	)
+
+	rec := post(rc, contentTypeProtobuf, request)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, contentTypeProtobuf, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Body.Bytes())
+
+	assert.Equal(t, map[string]float64{
+		"memory;service.name=api;state=used":      0.5,
+		"requests;service.name=api":               42,
+		"latency_count;service.name=api":          6,
+		"latency_sum;service.name=api":            1.5,
+		"latency_bucket;le=0.1;service.name=api":  1,
+		"latency_bucket;le=0.5;service.name=api":  4,
+		"latency_bucket;le=+Inf;service.name=api": 6,
+	}, values(s))
+}
+
+func TestReceiver_JSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.OTLPConfig
+		requests []string
+		wantBody string
+		want     map[string]float64
+	}{
+		{
+			name: "cumulative counter with resets",
+			requests: []string{
+				// Ряд начался до запуска сервера: первая точка — только база
+				sumRequest(`"AGGREGATION_TEMPORALITY_CUMULATIVE"`, true, `{"startTimeUnixNano":"1","asInt":"10"}`),
+				sumRequest(`2`, true, `{"startTimeUnixNano":"1","asInt":"15"}`, `{"startTimeUnixNano":"1","asInt":"15"}`),
+				// Уменьшение значения — сброс
+				sumRequest(`2`, true, `{"startTimeUnixNano":"1","asInt":"3"}`),
+				// Смена времени начала — тоже сброс, даже если значение выросло
+				sumRequest(`2`, true, `{"startTimeUnixNano":"2","asDouble":7.9}`),
+			},
+			want: map[string]float64{"ops;service.name=api": 5 + 3 + 7},
+		},
+		{
+			name: "cumulative counter started after the server",
+			requests: []string{
+				sumRequest(`2`, true, `{"startTimeUnixNano":"9000000000000000000","asInt":"10"}`),
+				sumRequest(`2`, true, `{"startTimeUnixNano":"9000000000000000000","asInt":"12"}`),
+			},
+			want: map[string]float64{"ops;service.name=api": 12},
+		},
+		{
+			name: "delta counter accumulates fractions",
+			requests: []string{
+				sumRequest(`1`, true, `{"asDouble":0.75}`, `{"asDouble":0.75}`),
+				sumRequest(`1`, true, `{"asInt":"2"}`, `{"asDouble":0.5}`),
+			},
+			want: map[string]float64{"ops;service.name=api": 4},
+		},
+		{
+			name: "non-monotonic sums",
+			requests: []string{
+				sumRequest(`1`, false, `{"asInt":"5"}`, `{"asInt":"-2"}`),
+				sumRequest(`2`, false, `{"asDouble":-1.5,"attributes":[{"key":"kind","value":{"stringValue":"total"}}]}`),
+			},
+			want: map[string]float64{"ops;service.name=api": 3, "ops;kind=total;service.name=api": -1.5},
+		},
+		{
+			name: "scope and resource attributes in template",
+			cfg: config.OTLPConfig{
+				Template:           "{service.name}.{scope}.{name}{tags}",
+				ResourceAttributes: []string{"*"},
+				ScopeAttributes:    []string{"*"},
+			},
+			requests: []string{
+				`{"resourceMetrics":[{"resource":{"attributes":[
+					{"key":"service.name","value":{"stringValue":"api"}},
+					{"key":"replica","value":{"intValue":"2"}}]},
+				"scopeMetrics":[{"scope":{"name":"db","attributes":[{"key":"replica","value":{"intValue":"3"}}]},
+					"metrics":[{"name":"up","gauge":{"dataPoints":[{"asInt":"1"}]}}]}]}]}`,
+			},
+			want: map[string]float64{"api.db.up;replica=3": 1},
+		},
+		{
+			name: "unsupported metrics are rejected",
+			requests: []string{
+				`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+					{"name":"rt","summary":{"dataPoints":[{},{}]}},
+					{"name":"ops","sum":{"dataPoints":[{"asInt":"1"}],"isMonotonic":true}},
+					{"name":"up","gauge":{"dataPoints":[{"asInt":"1"},{}]}}]}]}]}`,
+			},
+			wantBody: `{"partialSuccess":{"rejectedDataPoints":"4","errorMessage":"metric \"rt\": summaries are not supported"}}`,
+			want:     map[string]float64{"up": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg.Template == "" {
+				cfg = defaultConfig
+			}
+			s := storage.NewMemStorage()
+			rc, err := NewReceiver(cfg, s, zap.NewNop().Sugar())
+			require.NoError(t, err)
+
+			var rec *httptest.ResponseRecorder
+			for _, body := range tt.requests {
+				rec = post(rc, "application/json; charset=utf-8", []byte(body))
+				require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			}
+			wantBody := tt.wantBody
+			if wantBody == "" {
+				wantBody = "{}"
+			}
+			assert.JSONEq(t, wantBody, rec.Body.String())
+			assert.Equal(t, tt.want, values(s))
+		})
+	}
+}
+
+// failingStorage отклоняет сохранение, пока fail равен true.
+type failingStorage struct {
+	handler.Storager
+	fail bool
+}
+
+func (s *failingStorage) Save(m models.Metrics) error {
+	if s.fail {
+		return errors.New("storage unavailable")
+	}
+	return s.Storager.Save(m)
+}
+
+func TestReceiver_FailedSaveKeepsSeries(t *testing.T) {
+	s := &failingStorage{Storager: storage.NewMemStorage()}
+	rc, err := NewReceiver(defaultConfig, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	point := func(v string) []byte {
+		return []byte(sumRequest(`2`, true, `{"startTimeUnixNano":"9000000000000000000","asInt":"`+v+`"}`))
+	}
+	require.Equal(t, http.StatusOK, post(rc, contentTypeJSON, point("10")).Code)
+
+	// Точка отклонена, прирост будет сохранен со следующей точкой.
+	s.fail = true
+	rec := post(rc, contentTypeJSON, point("15"))
+	assert.Contains(t, rec.Body.String(), "storage unavailable")
+
+	s.fail = false
+	require.Equal(t, http.StatusOK, post(rc, contentTypeJSON, point("17")).Code)
+	assert.Equal(t, map[string]float64{"ops;service.name=api": 17}, values(s))
+}
+
+// sumRequest собирает запрос OTLP/JSON с метрикой ops типа Sum.
+func sumRequest(temporality string, monotonic bool, points ...string) string {
+	mono := "false"
+	if monotonic {
+		mono = "true"
+	}
+	return `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+		"scopeMetrics":[{"metrics":[{"name":"ops","sum":{"aggregationTemporality":` + temporality +
+		`,"isMonotonic":` + mono + `,"dataPoints":[` + strings.Join(points, ",") + `]}}]}]}]}`
+}
+
+func TestReceiver_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        []byte("up 1"),
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantBody: `{"code":"unsupported_media","detail":"unsupported content type, expected application/x-protobuf or application/json",` +
+				`"instance":"/v1/metrics","status":415,"title":"Unsupported Media Type","type":"about:blank"}` + "\n",
+		},
+		{
+			name:        "empty body",
+			contentType: contentTypeJSON,
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    `{"code":3,"message":"empty request body"}` + "\n",
+		},
+		{
+			name:        "invalid json",
+			contentType: contentTypeJSON,
+			body:        []byte(`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"x","sum":{"aggregationTemporality":"SOMETIMES"}}]}]}]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    `{"code":3,"message":"invalid request body: unknown aggregation temporality \"SOMETIMES\""}` + "\n",
+		},
+		{
+			name:        "wrong wire type",
+			contentType: contentTypeProtobuf,
+			body:        pbVarint(1, 5),
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    string(Status{Code: codeInvalidArgument, Message: "invalid request body: field 1: unexpected wire type 0"}.MarshalProto()),
+		},
+		{
+			name:        "truncated protobuf",
+			contentType: contentTypeProtobuf,
+			body:        pbMessage(1, pbString(1, "x"))[:3],
+			wantStatus:  http.StatusBadRequest,
+			wantBody:    string(Status{Code: codeInvalidArgument, Message: "invalid request body: field 1: unexpected EOF"}.MarshalProto()),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := NewReceiver(defaultConfig, storage.NewMemStorage(), zap.NewNop().Sugar())
+			require.NoError(t, err)
+
+			rec := post(rc, tt.contentType, tt.body)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field — значение поля protobuf-сообщения.
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value uint64 // Для varint, fixed32 и fixed64
+	bytes []byte // Для length-delimited
+}
+
+// decodeMessage перебирает поля сообщения b и вызывает fn для каждого из них.
+// Поля с неизвестными номерами fn должна пропускать, как требует protobuf.
+func decodeMessage(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.value = uint64(v)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect проверяет тип поля.
+func (f field) expect(typ protowire.Type) error {
+	if f.typ != typ {
+		return fmt.Errorf("field %d: unexpected wire type %d", f.num, f.typ)
+	}
+	return nil
+}
+
+// message возвращает содержимое поля-сообщения или строки.
+func (f field) message() ([]byte, error) {
+	return f.bytes, f.expect(protowire.BytesType)
+}
+
+// string возвращает значение строкового поля.
+func (f field) string() (string, error) {
+	b, err := f.message()
+	return string(b), err
+}
+
+// fixed64 возвращает значение поля fixed64, sfixed64 или double.
+func (f field) fixed64() (uint64, error) {
+	return f.value, f.expect(protowire.Fixed64Type)
+}
+
+// double возвращает значение поля double.
+func (f field) double() (float64, error) {
+	v, err := f.fixed64()
+	return math.Float64frombits(v), err
+}
+
+// varint возвращает значение поля varint.
+func (f field) varint() (uint64, error) {
+	return f.value, f.expect(protowire.VarintType)
+}
+
+// repeatedFixed64 добавляет к dst значения повторяющегося поля fixed64 или double
+// в упакованном (packed) или обычном виде.
+func (f field) repeatedFixed64(dst []uint64) ([]uint64, error) {
+	if f.typ == protowire.Fixed64Type {
+		return append(dst, f.value), nil
+	}
+	b, err := f.message()
+	if err != nil {
+		return nil, err
+	}
+	for len(b) > 0 {
+		v, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return nil, fmt.Errorf("field %d: %w", f.num, protowire.ParseError(n))
+		}
+		dst = append(dst, v)
+		b = b[n:]
+	}
+	return dst, nil
+}
+
+// UnmarshalProto разбирает ExportMetricsServiceRequest в кодировке protobuf.
+func (r *ExportRequest) UnmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		data, err := f.message()
+		if err != nil {
+			return err
+		}
+		var rm ResourceMetrics
+		if err = rm.unmarshalProto(data); err != nil {
+			return err
+		}
+		r.ResourceMetrics = append(r.ResourceMetrics, rm)
+		return nil
+	})
+}
+
+func (r *ResourceMetrics) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		switch f.num {
+		case 1:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			return decodeMessage(data, func(f field) error {
+				if f.num != 1 {
+					return nil
+				}
+				return appendKeyValue(&r.Resource.Attributes, f)
+			})
+		case 2:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			var sm ScopeMetrics
+			if err = sm.unmarshalProto(data); err != nil {
+				return err
+			}
+			r.ScopeMetrics = append(r.ScopeMetrics, sm)
+		}
+		return nil
+	})
+}
+
+func (s *ScopeMetrics) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		switch f.num {
+		case 1:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			return s.Scope.unmarshalProto(data)
+		case 2:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			var m Metric
+			if err = m.unmarshalProto(data); err != nil {
+				return err
+			}
+			s.Metrics = append(s.Metrics, m)
+		}
+		return nil
+	})
+}
+
+func (s *Scope) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			s.Name, err = f.string()
+		case 2:
+			s.Version, err = f.string()
+		case 3:
+			err = appendKeyValue(&s.Attributes, f)
+		}
+		return err
+	})
+}
+
+func (m *Metric) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		if f.num == 1 {
+			var err error
+			m.Name, err = f.string()
+			return err
+		}
+
+		var decode func([]byte) error
+		switch f.num {
+		case 5:
+			m.Gauge = &Gauge{}
+			decode = m.Gauge.unmarshalProto
+		case 7:
+			m.Sum = &Sum{}
+			decode = m.Sum.unmarshalProto
+		case 9:
+			m.Histogram = &Histogram{}
+			decode = m.Histogram.unmarshalProto
+		case 10:
+			m.ExponentialHistogram = &pointsOnly{}
+			decode = m.ExponentialHistogram.unmarshalProto
+		case 11:
+			m.Summary = &pointsOnly{}
+			decode = m.Summary.unmarshalProto
+		default:
+			return nil
+		}
+		data, err := f.message()
+		if err != nil {
+			return err
+		}
+		return decode(data)
+	})
+}
+
+func (g *Gauge) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		return appendNumberDataPoint(&g.DataPoints, f)
+	})
+}
+
+func (s *Sum) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		switch f.num {
+		case 1:
+			return appendNumberDataPoint(&s.DataPoints, f)
+		case 2:
+			v, err := f.varint()
+			s.AggregationTemporality = Temporality(v)
+			return err
+		case 3:
+			v, err := f.varint()
+			s.IsMonotonic = v != 0
+			return err
+		}
+		return nil
+	})
+}
+
+func (h *Histogram) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		switch f.num {
+		case 1:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			var p HistogramDataPoint
+			if err = p.unmarshalProto(data); err != nil {
+				return err
+			}
+			h.DataPoints = append(h.DataPoints, p)
+		case 2:
+			v, err := f.varint()
+			h.AggregationTemporality = Temporality(v)
+			return err
+		}
+		return nil
+	})
+}
+
+func (p *pointsOnly) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		if f.num == 1 {
+			p.DataPoints = append(p.DataPoints, struct{}{})
+		}
+		return nil
+	})
+}
+
+// appendNumberDataPoint разбирает NumberDataPoint из поля f и добавляет к dst.
+func appendNumberDataPoint(dst *[]NumberDataPoint, f field) error {
+	data, err := f.message()
+	if err != nil {
+		return err
+	}
+
+	var p NumberDataPoint
+	err = decodeMessage(data, func(f field) error {
+		var err error
+		switch f.num {
+		case 2:
+			var v uint64
+			v, err = f.fixed64()
+			p.StartTimeUnixNano = Uint64(v)
+		case 3:
+			var v uint64
+			v, err = f.fixed64()
+			p.TimeUnixNano = Uint64(v)
+		case 4:
+			var v float64
+			v, err = f.double()
+			p.AsDouble, p.AsInt = &v, nil
+		case 6:
+			var v uint64
+			v, err = f.fixed64()
+			i := Int64(v)
+			p.AsInt, p.AsDouble = &i, nil
+		case 7:
+			err = appendKeyValue(&p.Attributes, f)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	*dst = append(*dst, p)
+	return nil
+}
+
+func (p *HistogramDataPoint) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 2:
+			var v uint64
+			v, err = f.fixed64()
+			p.StartTimeUnixNano = Uint64(v)
+		case 3:
+			var v uint64
+			v, err = f.fixed64()
+			p.TimeUnixNano = Uint64(v)
+		case 4:
+			var v uint64
+			v, err = f.fixed64()
+			p.Count = Uint64(v)
+		case 5:
+			var v float64
+			v, err = f.double()
+			p.Sum = &v
+		case 6:
+			var counts []uint64
+			if counts, err = f.repeatedFixed64(nil); err == nil {
+				for _, c := range counts {
+					p.BucketCounts = append(p.BucketCounts, Uint64(c))
+				}
+			}
+		case 7:
+			var bounds []uint64
+			if bounds, err = f.repeatedFixed64(nil); err == nil {
+				for _, b := range bounds {
+					p.ExplicitBounds = append(p.ExplicitBounds, math.Float64frombits(b))
+				}
+			}
+		case 9:
+			err = appendKeyValue(&p.Attributes, f)
+		}
+		return err
+	})
+}
+
+// appendKeyValue разбирает KeyValue из поля f и добавляет к dst.
+func appendKeyValue(dst *[]KeyValue, f field) error {
+	data, err := f.message()
+	if err != nil {
+		return err
+	}
+
+	var kv KeyValue
+	err = decodeMessage(data, func(f field) error {
+		switch f.num {
+		case 1:
+			var err error
+			kv.Key, err = f.string()
+			return err
+		case 2:
+			data, err := f.message()
+			if err != nil {
+				return err
+			}
+			return kv.Value.unmarshalProto(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*dst = append(*dst, kv)
+	return nil
+}
+
+func (v *AnyValue) unmarshalProto(b []byte) error {
+	return decodeMessage(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			var s string
+			s, err = f.string()
+			v.StringValue = &s
+		case 2:
+			var n uint64
+			n, err = f.varint()
+			b := n != 0
+			v.BoolValue = &b
+		case 3:
+			var n uint64
+			n, err = f.varint()
+			i := Int64(n)
+			v.IntValue = &i
+		case 4:
+			var d float64
+			d, err = f.double()
+			v.DoubleValue = &d
+		case 5:
+			var data []byte
+			if data, err = f.message(); err == nil {
+				v.ArrayValue = &ArrayValue{}
+				err = decodeMessage(data, func(f field) error {
+					if f.num != 1 {
+						return nil
+					}
+					item, err := f.message()
+					if err != nil {
+						return err
+					}
+					var av AnyValue
+					if err = av.unmarshalProto(item); err != nil {
+						return err
+					}
+					v.ArrayValue.Values = append(v.ArrayValue.Values, av)
+					return nil
+				})
+			}
+		case 6:
+			var data []byte
+			if data, err = f.message(); err == nil {
+				v.KvlistValue = &KeyValueList{}
+				err = decodeMessage(data, func(f field) error {
+					if f.num != 1 {
+						return nil
+					}
+					return appendKeyValue(&v.KvlistValue.Values, f)
+				})
+			}
+		case 7:
+			v.BytesValue, err = f.message()
+		}
+		return err
+	})
+}
+
+// Status — тело ответа с ошибкой (google.rpc.Status).
+type Status struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+}
+
+// codeInvalidArgument — код google.rpc.Code для некорректного запроса.
+const codeInvalidArgument = 3
+
+// MarshalProto кодирует Status в protobuf.
+func (s Status) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.Code))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, s.Message)
+}
+
+// ExportResponse — тело ответа ExportMetricsServiceResponse.
+// Если часть точек отклонена, заполняется PartialSuccess.
+type ExportResponse struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// PartialSuccess сообщает, сколько точек данных не было принято и почему.
+type PartialSuccess struct {
+	RejectedDataPoints int64  `json:"rejectedDataPoints,string"`
+	ErrorMessage       string `json:"errorMessage"`
+}
+
+// MarshalProto кодирует ответ в protobuf.
+func (r ExportResponse) MarshalProto() []byte {
+	if r.PartialSuccess == nil {
+		return nil
+	}
+	var ps []byte
+	ps = protowire.AppendTag(ps, 1, protowire.VarintType)
+	ps = protowire.AppendVarint(ps, uint64(r.PartialSuccess.RejectedDataPoints))
+	ps = protowire.AppendTag(ps, 2, protowire.BytesType)
+	ps = protowire.AppendString(ps, r.PartialSuccess.ErrorMessage)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, ps)
+}
+
+// errEmptyBody возвращается для запроса без тела.
+var errEmptyBody = errors.New("empty request body")
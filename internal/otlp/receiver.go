@@ -0,0 +1,484 @@
+// Package otlp реализует прием метрик OpenTelemetry по протоколу OTLP/HTTP
+// (POST /v1/metrics) в кодировках protobuf и JSON.
+//
+// Точки данных переводятся в модель проекта:
+//   - Gauge и немонотонный Sum — gauge;
+//   - монотонный Sum — counter, в хранилище записывается прирост; первая накопленная
+//     точка ряда, начавшегося до запуска сервера, только задает базу, потому что
+//     ее значение уже может быть учтено в восстановленном хранилище;
+//   - Histogram — счетчики {name}_count и {name}_bucket с тегом le (накопительные,
+//     как в Prometheus) и gauge {name}_sum.
+//
+// ExponentialHistogram, Summary и точки без временности агрегации не поддерживаются:
+// они отклоняются и учитываются в partial_success ответа.
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"go.uber.org/zap"
+)
+
+// Типы содержимого OTLP/HTTP.
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// allAttributes в списке атрибутов ресурса или scope означает «все атрибуты».
+const allAttributes = "*"
+
+// series — состояние ряда, нужное для перевода накопленных и дельта-значений в приросты.
+type series struct {
+	start     uint64  // StartTimeUnixNano последней точки накопленного ряда
+	total     float64 // Последнее накопленное значение
+	remainder float64 // Дробная часть дельт, еще не записанная в счетчик
+}
+
+// Receiver принимает метрики OTLP/HTTP и сохраняет их в хранилище.
+type Receiver struct {
+	storage       handler.Storager
+	template      *models.IDTemplate
+	resourceAttrs []string
+	scopeAttrs    []string
+	logger        *zap.SugaredLogger
+
+	started uint64 // Время создания приемника в Unix-наносекундах
+
+	mu     sync.Mutex         // Защищает series и делает сохранение прироста и обновление ряда одним шагом
+	series map[string]*series // Состояние счетчиков по ID метрики
+}
+
+// NewReceiver создает приемник с шаблоном ID и списками атрибутов из cfg.
+func NewReceiver(cfg config.OTLPConfig, storage handler.Storager, logger *zap.SugaredLogger) (*Receiver, error) {
+	template, err := models.ParseIDTemplate(cfg.Template, "name", "scope")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receiver{
+		storage:       storage,
+		template:      template,
+		resourceAttrs: cfg.ResourceAttributes,
+		scopeAttrs:    cfg.ScopeAttributes,
+		logger:        logger,
+		started:       uint64(time.Now().UnixNano()),
+		series:        make(map[string]*series),
+	}, nil
+}
+
+// ServeHTTP обрабатывает POST /v1/metrics. Тип тела определяется по Content-Type:
+// application/x-protobuf или application/json; ответ возвращается в той же кодировке.
+// Метки времени точек не используются: значения сохраняются с временем приема.
+//
+// Некорректное тело запроса — 400 с google.rpc.Status, как требует спецификация OTLP;
+// неподдерживаемый Content-Type — 415 в формате application/problem+json. Если часть точек отклонена,
+// остальные сохраняются, а ответ 200 содержит partial_success с числом отклоненных точек.
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != contentTypeProtobuf && mediaType != contentTypeJSON {
+		problem.Error(w, r, http.StatusUnsupportedMediaType, problem.UnsupportedMedia,
+			"unsupported content type, expected "+contentTypeProtobuf+" or "+contentTypeJSON)
+		return
+	}
+
+	req, err := decodeRequest(r.Body, mediaType)
+	if err != nil {
+		rc.writeStatus(w, mediaType, err)
+		return
+	}
+
+	var resp ExportResponse
+	if rejected, err := rc.export(req); rejected > 0 {
+		resp.PartialSuccess = &PartialSuccess{RejectedDataPoints: rejected, ErrorMessage: err.Error()}
+	}
+	rc.write(w, mediaType, http.StatusOK, resp, resp.MarshalProto())
+}
+
+// decodeRequest читает и разбирает тело запроса.
+func decodeRequest(body io.Reader, mediaType string) (ExportRequest, error) {
+	var req ExportRequest
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return req, err
+	}
+	if len(data) == 0 {
+		return req, errEmptyBody
+	}
+
+	if mediaType == contentTypeJSON {
+		err = json.Unmarshal(data, &req)
+	} else {
+		err = req.UnmarshalProto(data)
+	}
+	if err != nil {
+		return req, fmt.Errorf("invalid request body: %w", err)
+	}
+	return req, nil
+}
+
+// writeStatus отвечает 400 с описанием ошибки разбора запроса.
+func (rc *Receiver) writeStatus(w http.ResponseWriter, mediaType string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	code := http.StatusBadRequest
+	if errors.As(err, &maxBytesErr) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	status := Status{Code: codeInvalidArgument, Message: err.Error()}
+	rc.write(w, mediaType, code, status, status.MarshalProto())
+}
+
+// write отправляет ответ: v в JSON или pb в protobuf, в зависимости от mediaType.
+func (rc *Receiver) write(w http.ResponseWriter, mediaType string, code int, v any, pb []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(code)
+
+	var err error
+	if mediaType == contentTypeJSON {
+		err = json.NewEncoder(w).Encode(v)
+	} else {
+		_, err = w.Write(pb)
+	}
+	if err != nil {
+		rc.logger.Errorln("failed to write otlp response", err)
+	}
+}
+
+// export сохраняет точки данных запроса. Возвращает число отклоненных точек
+// и первую ошибку, по которой точка была отклонена.
+func (rc *Receiver) export(req ExportRequest) (int64, error) {
+	var (
+		rejected int64
+		firstErr error
+	)
+	reject := func(n int, err error) {
+		if n == 0 {
+			return
+		}
+		rejected += int64(n)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, rm := range req.ResourceMetrics {
+		resourceTags := selectAttributes(rm.Resource.Attributes, rc.resourceAttrs)
+		for _, sm := range rm.ScopeMetrics {
+			tags := selectAttributes(sm.Scope.Attributes, rc.scopeAttrs)
+			for k, v := range resourceTags {
+				if _, ok := tags[k]; !ok {
+					tags[k] = v
+				}
+			}
+			for _, m := range sm.Metrics {
+				rc.exportMetric(m, sm.Scope.Name, tags, reject)
+			}
+		}
+	}
+
+	if rejected > 0 {
+		rc.logger.Warnf("otlp: rejected %d data points: %v", rejected, firstErr)
+	}
+	return rejected, firstErr
+}
+
+// exportMetric сохраняет точки данных одной метрики и сообщает об отклоненных через reject.
+func (rc *Receiver) exportMetric(m Metric, scope string, tags map[string]string, reject func(int, error)) {
+	metricErr := func(err error) error { return fmt.Errorf("metric %q: %w", m.Name, err) }
+	switch {
+	case m.ExponentialHistogram != nil:
+		reject(len(m.ExponentialHistogram.DataPoints), metricErr(errors.New("exponential histograms are not supported")))
+		return
+	case m.Summary != nil:
+		reject(len(m.Summary.DataPoints), metricErr(errors.New("summaries are not supported")))
+		return
+	}
+
+	if m.Name == "" {
+		reject(m.dataPoints(), errors.New("metric name is empty"))
+		return
+	}
+
+	idFor := func(suffix string, attrs []KeyValue, extra map[string]string) (string, error) {
+		pointTags := make(map[string]string, len(tags)+len(attrs)+len(extra))
+		for k, v := range tags {
+			pointTags[k] = v
+		}
+		for _, kv := range attrs {
+			pointTags[kv.Key] = kv.Value.String()
+		}
+		for k, v := range extra {
+			pointTags[k] = v
+		}
+		return rc.template.Execute(map[string]string{"name": m.Name + suffix, "scope": scope}, pointTags)
+	}
+
+	switch {
+	case m.Gauge != nil:
+		for _, p := range m.Gauge.DataPoints {
+			if err := rc.exportGauge(p, idFor); err != nil {
+				reject(1, metricErr(err))
+			}
+		}
+	case m.Sum != nil:
+		for _, p := range m.Sum.DataPoints {
+			if err := rc.exportSum(m.Sum, p, idFor); err != nil {
+				reject(1, metricErr(err))
+			}
+		}
+	case m.Histogram != nil:
+		for _, p := range m.Histogram.DataPoints {
+			if err := rc.exportHistogram(m.Histogram.AggregationTemporality, p, idFor); err != nil {
+				reject(1, metricErr(err))
+			}
+		}
+	}
+}
+
+// dataPoints возвращает число точек данных метрики.
+func (m Metric) dataPoints() int {
+	switch {
+	case m.Gauge != nil:
+		return len(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		return len(m.Sum.DataPoints)
+	case m.Histogram != nil:
+		return len(m.Histogram.DataPoints)
+	default:
+		return 0
+	}
+}
+
+// idFunc строит ID метрики с суффиксом имени, атрибутами точки и дополнительными тегами.
+type idFunc func(suffix string, attrs []KeyValue, extra map[string]string) (string, error)
+
+func (rc *Receiver) exportGauge(p NumberDataPoint, idFor idFunc) error {
+	value, err := pointValue(p)
+	if err != nil {
+		return err
+	}
+	id, err := idFor("", p.Attributes, nil)
+	if err != nil {
+		return err
+	}
+	return rc.save(models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+}
+
+func (rc *Receiver) exportSum(s *Sum, p NumberDataPoint, idFor idFunc) error {
+	value, err := pointValue(p)
+	if err != nil {
+		return err
+	}
+	if err = checkTemporality(s.AggregationTemporality); err != nil {
+		return err
+	}
+	if s.IsMonotonic && value < 0 {
+		return fmt.Errorf("monotonic sum value %v is negative", value)
+	}
+	id, err := idFor("", p.Attributes, nil)
+	if err != nil {
+		return err
+	}
+
+	delta := s.AggregationTemporality == TemporalityDelta
+	switch {
+	case s.IsMonotonic && delta:
+		return rc.addCounter(id, value)
+	case s.IsMonotonic:
+		return rc.setCounter(id, uint64(p.StartTimeUnixNano), value)
+	case delta:
+		return rc.addGauge(id, value)
+	default:
+		return rc.save(models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+	}
+}
+
+// exportHistogram сохраняет точку гистограммы. Корзины переводятся в накопительные
+// счетчики с тегом le: каждая содержит число значений не больше своей границы.
+func (rc *Receiver) exportHistogram(temporality Temporality, p HistogramDataPoint, idFor idFunc) error {
+	if err := checkTemporality(temporality); err != nil {
+		return err
+	}
+	if n := len(p.BucketCounts); n != 0 && n != len(p.ExplicitBounds)+1 {
+		return fmt.Errorf("histogram has %d bucket counts for %d bounds", n, len(p.ExplicitBounds))
+	}
+
+	// Сначала строятся все ID, чтобы точка с ошибкой не была сохранена частично.
+	countID, err := idFor("_count", p.Attributes, nil)
+	if err != nil {
+		return err
+	}
+	sumID, err := idFor("_sum", p.Attributes, nil)
+	if err != nil {
+		return err
+	}
+	bucketIDs := make([]string, len(p.BucketCounts))
+	for i := range p.BucketCounts {
+		le := "+Inf"
+		if i < len(p.ExplicitBounds) {
+			le = strconv.FormatFloat(p.ExplicitBounds[i], 'g', -1, 64)
+		}
+		if bucketIDs[i], err = idFor("_bucket", p.Attributes, map[string]string{"le": le}); err != nil {
+			return err
+		}
+	}
+
+	start := uint64(p.StartTimeUnixNano)
+	counter := func(id string, value uint64) error {
+		if temporality == TemporalityDelta {
+			return rc.addCounter(id, float64(value))
+		}
+		return rc.setCounter(id, start, float64(value))
+	}
+
+	if err = counter(countID, uint64(p.Count)); err != nil {
+		return err
+	}
+	if p.Sum != nil {
+		if temporality == TemporalityDelta {
+			err = rc.addGauge(sumID, *p.Sum)
+		} else {
+			err = rc.save(models.Metrics{ID: sumID, MType: models.Gauge, Value: p.Sum})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var cumulative uint64
+	for i, c := range p.BucketCounts {
+		cumulative += uint64(c)
+		if err = counter(bucketIDs[i], cumulative); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pointValue возвращает значение точки, проверяя, что оно задано и конечно.
+func pointValue(p NumberDataPoint) (float64, error) {
+	value, ok := p.Value()
+	if !ok {
+		return 0, errors.New("data point has no value")
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid data point value %v", value)
+	}
+	return value, nil
+}
+
+// checkTemporality проверяет, что временность агрегации указана.
+func checkTemporality(t Temporality) error {
+	if t != TemporalityDelta && t != TemporalityCumulative {
+		return fmt.Errorf("unsupported aggregation temporality %d", t)
+	}
+	return nil
+}
+
+// setCounter сохраняет накопленное значение счетчика как прирост относительно прошлой точки.
+// Смена StartTimeUnixNano или уменьшение значения считается сбросом счетчика.
+// Первая точка ряда сохраняется целиком, только если StartTimeUnixNano показывает, что счетчик
+// начался после запуска приемника; иначе она становится базой с нулевым приростом.
+// Дробная часть накопленного значения отбрасывается; нулевой прирост не сохраняется.
+// Состояние ряда обновляется только после успешного сохранения.
+func (rc *Receiver) setCounter(id string, start uint64, total float64) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	s, seen := rc.series[id]
+	var prev float64
+	switch {
+	case !seen && start < rc.started:
+		prev = total // Ряд начался до запуска сервера, его прежние приросты уже могли быть сохранены
+	case !seen, s.start != start, total < s.total:
+		prev = 0 // Новый ряд или источник перезапустился, счетчик начался заново
+	default:
+		prev = s.total
+	}
+
+	delta := int64(math.Floor(total) - math.Floor(prev))
+	if !seen || delta != 0 {
+		if err := rc.save(models.Metrics{ID: id, MType: models.Counter, Delta: &delta}); err != nil {
+			return err
+		}
+	}
+	if !seen {
+		s = &series{}
+		rc.series[id] = s
+	}
+	s.start, s.total = start, total
+	return nil
+}
+
+// addCounter добавляет к счетчику дельту. Дробная часть копится до следующих точек,
+// чтобы сумма записанных приростов не расходилась с суммой дельт.
+// Состояние ряда обновляется только после успешного сохранения.
+func (rc *Receiver) addCounter(id string, value float64) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	s, seen := rc.series[id]
+	remainder := value
+	if seen {
+		remainder += s.remainder
+	}
+	whole := math.Floor(remainder)
+
+	delta := int64(whole)
+	if !seen || delta != 0 {
+		if err := rc.save(models.Metrics{ID: id, MType: models.Counter, Delta: &delta}); err != nil {
+			return err
+		}
+	}
+	if !seen {
+		s = &series{}
+		rc.series[id] = s
+	}
+	s.remainder = remainder - whole
+	return nil
+}
+
+// addGauge прибавляет дельту к текущему значению gauge.
+func (rc *Receiver) addGauge(id string, delta float64) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	value := delta
+	if m, ok := rc.storage.Get(models.Gauge, id); ok && m.Value != nil {
+		value += *m.Value
+	}
+	return rc.save(models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+}
+
+func (rc *Receiver) save(m models.Metrics) error {
+	if err := rc.storage.Save(m); err != nil {
+		return fmt.Errorf("save %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// selectAttributes возвращает атрибуты attrs с ключами из keys как теги. Ключ * выбирает все атрибуты.
+func selectAttributes(attrs []KeyValue, keys []string) map[string]string {
+	tags := make(map[string]string)
+	for _, kv := range attrs {
+		for _, k := range keys {
+			if k == allAttributes || k == kv.Key {
+				tags[kv.Key] = kv.Value.String()
+				break
+			}
+		}
+	}
+	return tags
+}
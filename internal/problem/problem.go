@@ -0,0 +1,146 @@
+// Package problem формирует ответы с ошибками в формате application/problem+json (RFC 9457).
+//
+// Кроме стандартных полей type, title, status, detail и instance ответ содержит
+// машиночитаемый код ошибки code и, если ошибка относится к конкретным полям запроса,
+// список errors с кодом и описанием для каждого поля:
+//
+//	{
+//	  "type": "about:blank",
+//	  "title": "Bad Request",
+//	  "status": 400,
+//	  "code": "invalid_value",
+//	  "detail": "invalid metric",
+//	  "instance": "/update/",
+//	  "errors": [{"field": "value", "code": "invalid_value", "detail": "gauge requires a value"}]
+//	}
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType — тип содержимого ответа с ошибкой.
+const ContentType = "application/problem+json"
+
+// Code — машиночитаемый код ошибки.
+type Code string
+
+// Коды ошибок.
+const (
+	UnknownType        Code = "unknown_type"        // Неизвестный тип метрики
+	InvalidValue       Code = "invalid_value"       // Значение метрики отсутствует или некорректно
+	MissingID          Code = "missing_id"          // Не указан ID метрики
+	InvalidID          Code = "invalid_id"          // ID метрики слишком длинный или содержит недопустимые символы
+	TypeConflict       Code = "type_conflict"       // Метрика с таким ID уже существует с другим типом
+	StorageUnavailable Code = "storage_unavailable" // Хранилище не смогло сохранить метрику
+	InvalidBody        Code = "invalid_body"        // Тело запроса не удалось разобрать
+	BodyTooLarge       Code = "body_too_large"      // Тело запроса больше допустимого
+	InvalidSignature   Code = "invalid_signature"   // Подпись тела запроса не совпала
+	InvalidParameter   Code = "invalid_parameter"   // Некорректный параметр запроса
+	UnsupportedMedia   Code = "unsupported_media"   // Тип содержимого запроса не поддерживается
+	Forbidden          Code = "forbidden"           // Запрос запрещен, например с чужого origin
+	NotFound           Code = "not_found"           // Метрика или маршрут не найдены
+	MethodNotAllowed   Code = "method_not_allowed"  // Метод не поддерживается маршрутом
+	Internal           Code = "internal"            // Внутренняя ошибка сервера
+)
+
+// FieldError — ошибка в конкретном поле запроса. Field — путь к полю: имя поля JSON,
+// параметра URL или, для пакетных запросов, индекс элемента, например [2].value.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   Code   `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// Problem — описание ошибки.
+type Problem struct {
+	Status   int            // HTTP-статус ответа
+	Code     Code           // Машиночитаемый код ошибки
+	Detail   string         // Описание конкретной ошибки для человека
+	Errors   []FieldError   // Ошибки в отдельных полях
+	Extra    map[string]any // Дополнительные поля ответа, например позиция ошибки в выражении
+	instance string
+}
+
+// New создает описание ошибки со статусом status и кодом code.
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail}
+}
+
+// Field добавляет ошибку в поле field и возвращает p.
+func (p *Problem) Field(field string, code Code, detail string) *Problem {
+	p.Errors = append(p.Errors, FieldError{Field: field, Code: code, Detail: detail})
+	return p
+}
+
+// With добавляет в ответ дополнительное поле и возвращает p.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extra == nil {
+		p.Extra = make(map[string]any)
+	}
+	p.Extra[key] = value
+	return p
+}
+
+// Error возвращает описание ошибки, чтобы Problem можно было передавать как error.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return string(p.Code) + ": " + p.Detail
+	}
+	return string(p.Code)
+}
+
+// MarshalJSON кодирует ошибку в формате RFC 9457. Дополнительные поля не перекрывают стандартные.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any, len(p.Extra)+7)
+	for k, v := range p.Extra {
+		fields[k] = v
+	}
+	fields["type"] = "about:blank"
+	fields["title"] = http.StatusText(p.Status)
+	fields["status"] = p.Status
+	fields["code"] = p.Code
+	if p.Detail != "" {
+		fields["detail"] = p.Detail
+	}
+	if p.instance != "" {
+		fields["instance"] = p.instance
+	}
+	if len(p.Errors) > 0 {
+		fields["errors"] = p.Errors
+	}
+	return json.Marshal(fields)
+}
+
+// Write отправляет ошибку p в ответ на запрос r. Путь запроса записывается в поле instance.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if r != nil {
+		p.instance = r.URL.Path
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, p.Error(), p.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// Error отправляет ошибку со статусом status, кодом code и описанием detail.
+func Error(w http.ResponseWriter, r *http.Request, status int, code Code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// NotFoundHandler отвечает 404 для неизвестных маршрутов.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, NotFound, "no route for "+r.Method+" "+r.URL.Path)
+}
+
+// MethodNotAllowedHandler отвечает 405 для методов, которые маршрут не поддерживает.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, MethodNotAllowed, "method "+r.Method+" is not allowed for "+r.URL.Path)
+}
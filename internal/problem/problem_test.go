@@ -0,0 +1,57 @@
+package problem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      *Problem
+		status int
+		want   string
+	}{
+		{
+			name:   "field errors",
+			p:      New(http.StatusBadRequest, InvalidValue, "invalid metric").Field("value", InvalidValue, "gauge requires a value"),
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_value","detail":"invalid metric",
+				"instance":"/update/","errors":[{"field":"value","code":"invalid_value","detail":"gauge requires a value"}]}`,
+		},
+		{
+			name:   "extensions do not override standard fields",
+			p:      New(http.StatusBadRequest, InvalidParameter, "").With("position", 3).With("status", 200),
+			status: http.StatusBadRequest,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_parameter",
+				"instance":"/update/","position":3}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Write(w, httptest.NewRequest(http.MethodPost, "/update/", nil), tt.p)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func TestRoutingHandlers(t *testing.T) {
+	w := httptest.NewRecorder()
+	NotFoundHandler(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"code":"not_found",
+		"detail":"no route for GET /missing","instance":"/missing"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	MethodNotAllowedHandler(w, httptest.NewRequest(http.MethodDelete, "/update/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Method Not Allowed","status":405,"code":"method_not_allowed",
+		"detail":"method DELETE is not allowed for /update/","instance":"/update/"}`, w.Body.String())
+}
@@ -0,0 +1,260 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"go.uber.org/zap"
+)
+
+// lookback — насколько давним может быть последнее значение метрики,
+// чтобы селектор без интервала его вернул.
+const lookback = 5 * time.Minute
+
+// Point — значение в момент времени. NaN и бесконечности в JSON записываются строками.
+type Point struct {
+	T time.Time
+	V float64
+}
+
+// MarshalJSON записывает точку как {"t": время, "v": значение}.
+func (p Point) MarshalJSON() ([]byte, error) {
+	var v any = p.V
+	if math.IsNaN(p.V) || math.IsInf(p.V, 0) {
+		v = strconv.FormatFloat(p.V, 'f', -1, 64)
+	}
+	return json.Marshal(struct {
+		T time.Time `json:"t"`
+		V any       `json:"v"`
+	}{p.T, v})
+}
+
+// Series — значения результата для одной метрики. У результата агрегации и числа ID пустой.
+type Series struct {
+	ID     string  `json:"id,omitempty"`   // ID метрики
+	Type   string  `json:"type,omitempty"` // Тип метрики, если значения взяты из хранилища без преобразований
+	Points []Point `json:"points"`         // Одна точка для scalar и vector, значения за интервал для matrix
+}
+
+// Result — результат вычисления выражения.
+type Result struct {
+	Type   ValueType `json:"result_type"`
+	Series []Series  `json:"series"`
+}
+
+// Engine вычисляет выражения по истории значений метрик.
+type Engine struct {
+	history *storage.History
+	logger  *zap.SugaredLogger
+	now     func() time.Time
+}
+
+// NewEngine создает Engine, читающий значения из history.
+func NewEngine(history *storage.History, logger *zap.SugaredLogger) *Engine {
+	return &Engine{history: history, logger: logger, now: time.Now}
+}
+
+// Query разбирает выражение и вычисляет его на момент t.
+func (e *Engine) Query(expr string, t time.Time) (Result, error) {
+	node, err := Parse(expr)
+	if err != nil {
+		return Result{}, err
+	}
+	series := e.eval(node, t)
+	if series == nil {
+		series = []Series{}
+	}
+	return Result{Type: node.Type(), Series: series}, nil
+}
+
+// eval вычисляет узел дерева. Число возвращается как одна серия без ID.
+func (e *Engine) eval(node Node, t time.Time) []Series {
+	switch n := node.(type) {
+	case *NumberLiteral:
+		return []Series{{Points: []Point{{T: t, V: n.Value}}}}
+
+	case *Selector:
+		if n.Range > 0 {
+			return e.selectRange(n, t)
+		}
+		return e.selectInstant(n, t)
+
+	case *UnaryExpr:
+		series := e.eval(n.Expr, t)
+		for i := range series {
+			for j := range series[i].Points {
+				series[i].Points[j].V = -series[i].Points[j].V
+			}
+			series[i].Type = ""
+		}
+		return series
+
+	case *BinaryExpr:
+		return binary(n.Op, e.eval(n.LHS, t), e.eval(n.RHS, t), n.LHS.Type() == ValueScalar, n.RHS.Type() == ValueScalar)
+
+	case *Call:
+		arg := e.eval(n.Args[0], t)
+		if n.Func.overTime != nil {
+			var result []Series
+			for _, s := range arg {
+				samples := make([]storage.Sample, len(s.Points))
+				for i, p := range s.Points {
+					samples[i] = storage.Sample{T: p.T, V: p.V}
+				}
+				if v, ok := n.Func.overTime(samples); ok {
+					result = append(result, Series{ID: s.ID, Points: []Point{{T: t, V: v}}})
+				}
+			}
+			return result
+		}
+
+		if len(arg) == 0 {
+			return nil
+		}
+		values := make([]float64, len(arg))
+		for i, s := range arg {
+			values[i] = s.Points[0].V
+		}
+		return []Series{{Points: []Point{{T: t, V: n.Func.aggregate(values)}}}}
+	}
+	return nil
+}
+
+// selectInstant возвращает последнее значение каждой подходящей метрики не старше lookback.
+func (e *Engine) selectInstant(sel *Selector, t time.Time) []Series {
+	var result []Series
+	for _, s := range e.history.Select(sel.Match, t.Add(-lookback), t) {
+		last := s.Samples[len(s.Samples)-1]
+		result = append(result, Series{ID: s.ID, Type: s.MType, Points: []Point{{T: t, V: last.V}}})
+	}
+	return result
+}
+
+// selectRange возвращает значения подходящих метрик за интервал (t-Range, t].
+func (e *Engine) selectRange(sel *Selector, t time.Time) []Series {
+	var result []Series
+	for _, s := range e.history.Select(sel.Match, t.Add(-sel.Range), t) {
+		points := make([]Point, len(s.Samples))
+		for i, sample := range s.Samples {
+			points[i] = Point{T: sample.T, V: sample.V}
+		}
+		result = append(result, Series{ID: s.ID, Type: s.MType, Points: points})
+	}
+	return result
+}
+
+// binary применяет арифметическую операцию к операндам.
+// Число применяется к каждой метрике другого операнда. Метрики двух векторов
+// сопоставляются по ID; если в одном из векторов одна метрика, она применяется
+// к каждой метрике другого — так работают выражения вида HeapInuse / HeapSys.
+func binary(op tokenKind, lhs, rhs []Series, lhsScalar, rhsScalar bool) []Series {
+	apply := func(id string, l, r Point) Series {
+		return Series{ID: id, Points: []Point{{T: l.T, V: arithmetic(op, l.V, r.V)}}}
+	}
+
+	var result []Series
+	switch {
+	case lhsScalar && rhsScalar:
+		return []Series{apply("", lhs[0].Points[0], rhs[0].Points[0])}
+	case rhsScalar || !lhsScalar && len(rhs) == 1:
+		for _, l := range lhs {
+			result = append(result, apply(l.ID, l.Points[0], rhs[0].Points[0]))
+		}
+	case lhsScalar || len(lhs) == 1:
+		for _, r := range rhs {
+			result = append(result, apply(r.ID, lhs[0].Points[0], r.Points[0]))
+		}
+	default:
+		byID := make(map[string]Point, len(rhs))
+		for _, r := range rhs {
+			byID[r.ID] = r.Points[0]
+		}
+		for _, l := range lhs {
+			if r, ok := byID[l.ID]; ok {
+				result = append(result, apply(l.ID, l.Points[0], r))
+			}
+		}
+	}
+	return result
+}
+
+// arithmetic вычисляет a op b. Деление на ноль, как и в Prometheus, дает бесконечность или NaN.
+func arithmetic(op tokenKind, a, b float64) float64 {
+	switch op {
+	case tokenAdd:
+		return a + b
+	case tokenSub:
+		return a - b
+	case tokenMul:
+		return a * b
+	default:
+		return a / b
+	}
+}
+
+// ServeHTTP вычисляет выражение из параметра expr и отдает результат в формате JSON.
+// Параметр time задает момент вычисления в RFC 3339 или секундах Unix, по умолчанию — текущее время.
+// При ошибке в выражении отвечает 400 в формате application/problem+json с описанием ошибки
+// и ее позицией в поле position.
+func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	t := e.now()
+	if v := q.Get("time"); v != "" {
+		var err error
+		if t, err = parseTime(v); err != nil {
+			problem.Write(w, r, invalidParameter("time", err.Error()))
+			return
+		}
+	}
+
+	expr := q.Get("expr")
+	if expr == "" {
+		problem.Write(w, r, invalidParameter("expr", "expr parameter is required"))
+		return
+	}
+
+	result, err := e.Query(expr, t)
+	if err != nil {
+		p := invalidParameter("expr", err.Error())
+		var qErr *Error
+		if errors.As(err, &qErr) {
+			p.With("position", qErr.Pos)
+		}
+		problem.Write(w, r, p)
+		return
+	}
+	e.writeJSON(w, http.StatusOK, result)
+}
+
+// invalidParameter описывает ошибку в параметре запроса name.
+func invalidParameter(name, detail string) *problem.Problem {
+	return problem.New(http.StatusBadRequest, problem.InvalidParameter, detail).Field(name, problem.InvalidParameter, detail)
+}
+
+func (e *Engine) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		e.logger.Errorln("failed to write query response", err)
+	}
+}
+
+// parseTime разбирает время в RFC 3339 или в секундах Unix (допускается дробная часть).
+func parseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		whole, frac := math.Modf(sec)
+		return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time, expected RFC 3339 or Unix seconds")
+	}
+	return t, nil
+}
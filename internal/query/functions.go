@@ -0,0 +1,95 @@
+package query
+
+import (
+	"math"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+)
+
+// function описывает функцию языка запросов: типы аргументов и результата.
+// Функции над интервалами получают значения одной метрики, агрегации — значения всех метрик.
+type function struct {
+	name    string
+	args    []ValueType
+	returns ValueType
+
+	overTime  func(samples []storage.Sample) (float64, bool) // Для функций над интервалом
+	aggregate func(values []float64) float64                 // Для агрегаций
+}
+
+// functions — поддерживаемые функции.
+var functions = map[string]*function{}
+
+func init() {
+	overTime := map[string]func([]storage.Sample) (float64, bool){
+		"rate":            storage.Rate,
+		"increase":        storage.Increase,
+		"delta":           delta,
+		"avg_over_time":   overTime(func(vs []float64) float64 { return sum(vs) / float64(len(vs)) }),
+		"min_over_time":   overTime(minOf),
+		"max_over_time":   overTime(maxOf),
+		"sum_over_time":   overTime(sum),
+		"count_over_time": overTime(func(vs []float64) float64 { return float64(len(vs)) }),
+		"last_over_time":  overTime(func(vs []float64) float64 { return vs[len(vs)-1] }),
+	}
+	for name, fn := range overTime {
+		functions[name] = &function{name: name, args: []ValueType{ValueMatrix}, returns: ValueVector, overTime: fn}
+	}
+
+	aggregations := map[string]func([]float64) float64{
+		"sum":   sum,
+		"avg":   func(vs []float64) float64 { return sum(vs) / float64(len(vs)) },
+		"min":   minOf,
+		"max":   maxOf,
+		"count": func(vs []float64) float64 { return float64(len(vs)) },
+	}
+	for name, fn := range aggregations {
+		functions[name] = &function{name: name, args: []ValueType{ValueVector}, returns: ValueVector, aggregate: fn}
+	}
+}
+
+// delta возвращает разницу между последним и первым значением gauge за интервал.
+func delta(samples []storage.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	return samples[len(samples)-1].V - samples[0].V, true
+}
+
+// overTime превращает агрегацию значений в функцию над интервалом.
+func overTime(fn func([]float64) float64) func([]storage.Sample) (float64, bool) {
+	return func(samples []storage.Sample) (float64, bool) {
+		if len(samples) == 0 {
+			return 0, false
+		}
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = s.V
+		}
+		return fn(values), true
+	}
+}
+
+func sum(vs []float64) float64 {
+	var s float64
+	for _, v := range vs {
+		s += v
+	}
+	return s
+}
+
+func minOf(vs []float64) float64 {
+	m := math.Inf(1)
+	for _, v := range vs {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+func maxOf(vs []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range vs {
+		m = math.Max(m, v)
+	}
+	return m
+}
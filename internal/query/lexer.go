@@ -0,0 +1,252 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind — вид лексемы выражения.
+type tokenKind int
+
+const (
+	tokenEOF      tokenKind = iota
+	tokenIdent              // Имя метрики, функции или метки: HeapAlloc, rate, id
+	tokenNumber             // Число: 10, 0.5, 1e6
+	tokenString             // Строка в двойных кавычках
+	tokenDuration           // Длительность в квадратных скобках: 5m, 1h30m
+	tokenLParen
+	tokenRParen
+	tokenLBrace
+	tokenRBrace
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenAdd
+	tokenSub
+	tokenMul
+	tokenDiv
+	tokenEq    // =
+	tokenNeq   // !=
+	tokenRe    // =~
+	tokenNotRe // !~
+)
+
+// tokenNames — названия лексем для сообщений об ошибках.
+var tokenNames = map[tokenKind]string{
+	tokenEOF:      "end of input",
+	tokenIdent:    "identifier",
+	tokenNumber:   "number",
+	tokenString:   "string",
+	tokenDuration: "duration",
+	tokenLParen:   `"("`,
+	tokenRParen:   `")"`,
+	tokenLBrace:   `"{"`,
+	tokenRBrace:   `"}"`,
+	tokenLBracket: `"["`,
+	tokenRBracket: `"]"`,
+	tokenComma:    `","`,
+	tokenAdd:      `"+"`,
+	tokenSub:      `"-"`,
+	tokenMul:      `"*"`,
+	tokenDiv:      `"/"`,
+	tokenEq:       `"="`,
+	tokenNeq:      `"!="`,
+	tokenRe:       `"=~"`,
+	tokenNotRe:    `"!~"`,
+}
+
+func (k tokenKind) String() string {
+	return tokenNames[k]
+}
+
+// token — лексема с позицией начала в выражении (с единицы).
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// describe возвращает описание лексемы для сообщений об ошибках.
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return t.kind.String()
+	case tokenIdent, tokenNumber, tokenString, tokenDuration:
+		return fmt.Sprintf("%s %q", t.kind, t.text)
+	default:
+		return t.kind.String()
+	}
+}
+
+// Error — ошибка разбора или вычисления выражения с позицией (с единицы), к которой она относится.
+type Error struct {
+	Pos int    // Позиция в выражении
+	Msg string // Описание ошибки
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// errorf создает ошибку с позицией pos.
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// lex разбивает выражение на лексемы. Последняя лексема всегда tokenEOF.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	inBrackets := false
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		pos := i + 1
+
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+
+		// Внутри квадратных скобок допускается только длительность
+		if inBrackets && c != ']' {
+			end := i
+			for end < len(input) && isDurationChar(input[end]) {
+				end++
+			}
+			if end == i {
+				return nil, errorf(pos, "unexpected character %q in duration", c)
+			}
+			tokens = append(tokens, token{kind: tokenDuration, text: input[i:end], pos: pos})
+			i = end
+			continue
+		}
+
+		switch {
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(input) && isIdentChar(input[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[i:end], pos: pos})
+			i = end
+			continue
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			end := scanNumber(input, i)
+			tokens = append(tokens, token{kind: tokenNumber, text: input[i:end], pos: pos})
+			i = end
+			continue
+		case c == '"':
+			end, err := scanString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			text, err := strconv.Unquote(input[i:end])
+			if err != nil {
+				return nil, errorf(pos, "invalid string %s", input[i:end])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos})
+			i = end
+			continue
+		}
+
+		kind, width := tokenEOF, 1
+		switch c {
+		case '(':
+			kind = tokenLParen
+		case ')':
+			kind = tokenRParen
+		case '{':
+			kind = tokenLBrace
+		case '}':
+			kind = tokenRBrace
+		case '[':
+			kind = tokenLBracket
+			inBrackets = true
+		case ']':
+			kind = tokenRBracket
+			inBrackets = false
+		case ',':
+			kind = tokenComma
+		case '+':
+			kind = tokenAdd
+		case '-':
+			kind = tokenSub
+		case '*':
+			kind = tokenMul
+		case '/':
+			kind = tokenDiv
+		case '=':
+			kind = tokenEq
+			if strings.HasPrefix(input[i:], "=~") {
+				kind, width = tokenRe, 2
+			}
+		case '!':
+			switch {
+			case strings.HasPrefix(input[i:], "!="):
+				kind, width = tokenNeq, 2
+			case strings.HasPrefix(input[i:], "!~"):
+				kind, width = tokenNotRe, 2
+			default:
+				return nil, errorf(pos, `unexpected character "!", expected "!=" or "!~"`)
+			}
+		default:
+			return nil, errorf(pos, "unexpected character %q", rune(c))
+		}
+		tokens = append(tokens, token{kind: kind, text: input[i : i+width], pos: pos})
+		i += width
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(input) + 1}), nil
+}
+
+// scanNumber возвращает позицию конца числа, начинающегося в input[start].
+func scanNumber(input string, start int) int {
+	i := start
+	for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+		i++
+	}
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if j < len(input) && isDigit(input[j]) {
+			i = j
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// scanString возвращает позицию после закрывающей кавычки строки, начинающейся в input[start].
+func scanString(input string, start int) (int, error) {
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, errorf(start+1, "unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c < unicode.MaxASCII && unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.' || c == ':'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDurationChar(c byte) bool {
+	return isDigit(c) || c == '.' || c >= 'a' && c <= 'z'
+}
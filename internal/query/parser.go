@@ -0,0 +1,400 @@
+// Package query реализует язык запросов к истории метрик: выборку метрик по ID,
+// функции над интервалами (rate, avg_over_time и др.), агрегации по нескольким
+// метрикам и арифметику между ними. Синтаксис похож на PromQL, но ограничен
+// возможностями хранилища: у метрики есть только ID и тип.
+//
+//	rate(PollCount[5m])
+//	max_over_time(HeapAlloc[10m]) / 1024
+//	sum({id=~"Heap.*", type="gauge"})
+//	HeapInuse / HeapSys * 100
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// ValueType — тип результата выражения.
+type ValueType string
+
+const (
+	ValueScalar ValueType = "scalar" // Число
+	ValueVector ValueType = "vector" // По одному значению на метрику
+	ValueMatrix ValueType = "matrix" // Значения метрик за интервал
+)
+
+// Node — узел синтаксического дерева выражения.
+type Node interface {
+	Pos() int        // Позиция начала узла в выражении
+	Type() ValueType // Тип значения узла
+}
+
+// NumberLiteral — числовая константа.
+type NumberLiteral struct {
+	pos   int
+	Value float64
+}
+
+// Matcher — условие на ID или тип метрики в селекторе.
+type Matcher struct {
+	Label string         // id или type
+	Op    tokenKind      // =, !=, =~, !~
+	Value string         // Значение или регулярное выражение
+	re    *regexp.Regexp // Скомпилированное регулярное выражение для =~ и !~
+}
+
+// Selector выбирает метрики. Если Range больше нуля, выбираются значения за интервал.
+type Selector struct {
+	pos      int
+	Matchers []Matcher
+	Range    time.Duration
+}
+
+// Call — вызов функции.
+type Call struct {
+	pos  int
+	Func *function
+	Args []Node
+}
+
+// UnaryExpr — унарный минус.
+type UnaryExpr struct {
+	pos  int
+	Expr Node
+}
+
+// BinaryExpr — арифметическая операция.
+type BinaryExpr struct {
+	pos int
+	Op  tokenKind
+	LHS Node
+	RHS Node
+}
+
+func (n *NumberLiteral) Pos() int { return n.pos }
+func (n *Selector) Pos() int      { return n.pos }
+func (n *Call) Pos() int          { return n.pos }
+func (n *UnaryExpr) Pos() int     { return n.pos }
+func (n *BinaryExpr) Pos() int    { return n.pos }
+
+func (n *NumberLiteral) Type() ValueType { return ValueScalar }
+func (n *Call) Type() ValueType          { return n.Func.returns }
+func (n *UnaryExpr) Type() ValueType     { return n.Expr.Type() }
+
+func (n *Selector) Type() ValueType {
+	if n.Range > 0 {
+		return ValueMatrix
+	}
+	return ValueVector
+}
+
+func (n *BinaryExpr) Type() ValueType {
+	if n.LHS.Type() == ValueScalar && n.RHS.Type() == ValueScalar {
+		return ValueScalar
+	}
+	return ValueVector
+}
+
+// Match сообщает, что метрика удовлетворяет условию.
+func (m Matcher) Match(id, mType string) bool {
+	v := id
+	if m.Label == "type" {
+		v = mType
+	}
+	switch m.Op {
+	case tokenEq:
+		return v == m.Value
+	case tokenNeq:
+		return v != m.Value
+	case tokenRe:
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// Match сообщает, что метрика удовлетворяет всем условиям селектора.
+func (n *Selector) Match(id, mType string) bool {
+	for _, m := range n.Matchers {
+		if !m.Match(id, mType) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse разбирает выражение и проверяет типы аргументов функций и операндов.
+// Ошибки возвращаются как *Error с позицией в выражении.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	if p.peek().kind == tokenEOF {
+		return nil, errorf(p.peek().pos, "empty expression")
+	}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s", t.describe())
+	}
+	return node, nil
+}
+
+// parser — парсер рекурсивного спуска. Грамматика:
+//
+//	expr     = term { ("+" | "-") term }
+//	term     = unary { ("*" | "/") unary }
+//	unary    = "-" unary | primary
+//	primary  = number | "(" expr ")" | ident "(" [ expr { "," expr } ] ")" | selector
+//	selector = ( ident | "{" matcher { "," matcher } "}" ) [ "[" duration "]" ]
+//	matcher  = ("id" | "type") ("=" | "!=" | "=~" | "!~") string
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// expect возвращает следующую лексему, если она вида kind, иначе — ошибку.
+func (p *parser) expect(kind tokenKind, context string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, errorf(t.pos, "unexpected %s %s, expected %s", t.describe(), context, kind)
+	}
+	return t, nil
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAdd || p.peek().kind == tokenSub {
+		op := p.next()
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if lhs, err = newBinary(op, lhs, rhs); err != nil {
+			return nil, err
+		}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseTerm() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenMul || p.peek().kind == tokenDiv {
+		op := p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if lhs, err = newBinary(op, lhs, rhs); err != nil {
+			return nil, err
+		}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t := p.peek(); t.kind == tokenSub {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if expr.Type() == ValueMatrix {
+			return nil, errorf(expr.Pos(), "unary minus is not defined for a range selector")
+		}
+		return &UnaryExpr{pos: t.pos, Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		return &NumberLiteral{pos: t.pos, Value: v}, nil
+	case tokenLParen:
+		p.next()
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenRParen, "in parenthesized expression"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case tokenIdent:
+		if p.tokens[p.i+1].kind == tokenLParen {
+			return p.parseCall()
+		}
+		return p.parseSelector()
+	case tokenLBrace:
+		return p.parseSelector()
+	default:
+		return nil, errorf(t.pos, "unexpected %s, expected number, metric, function or \"(\"", t.describe())
+	}
+}
+
+func (p *parser) parseCall() (Node, error) {
+	name := p.next()
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, errorf(name.pos, "unknown function %q", name.text)
+	}
+	p.next() // (
+
+	call := &Call{pos: name.pos, Func: fn}
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	closing, err := p.expect(tokenRParen, "in function call")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(call.Args) != len(fn.args) {
+		return nil, errorf(closing.pos, "function %s expects %d argument(s), got %d", fn.name, len(fn.args), len(call.Args))
+	}
+	for i, arg := range call.Args {
+		if arg.Type() != fn.args[i] {
+			return nil, errorf(arg.Pos(), "function %s expects %s argument, got %s", fn.name, describeType(fn.args[i]), describeType(arg.Type()))
+		}
+	}
+	return call, nil
+}
+
+func (p *parser) parseSelector() (Node, error) {
+	t := p.next()
+	sel := &Selector{pos: t.pos}
+
+	if t.kind == tokenIdent {
+		sel.Matchers = []Matcher{{Label: "id", Op: tokenEq, Value: t.text}}
+	} else {
+		for {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			sel.Matchers = append(sel.Matchers, m)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokenRBrace, "in selector"); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek().kind != tokenLBracket {
+		return sel, nil
+	}
+	p.next()
+	d, err := p.expect(tokenDuration, "in range")
+	if err != nil {
+		return nil, err
+	}
+	sel.Range, err = time.ParseDuration(d.text)
+	if err != nil || sel.Range <= 0 {
+		return nil, errorf(d.pos, "invalid range %q, expected a positive duration like 5m", d.text)
+	}
+	if _, err = p.expect(tokenRBracket, "in range"); err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
+
+func (p *parser) parseMatcher() (Matcher, error) {
+	label, err := p.expect(tokenIdent, "in selector")
+	if err != nil {
+		return Matcher{}, err
+	}
+	if label.text != "id" && label.text != "type" {
+		return Matcher{}, errorf(label.pos, "unknown label %q, expected id or type", label.text)
+	}
+
+	op := p.next()
+	switch op.kind {
+	case tokenEq, tokenNeq, tokenRe, tokenNotRe:
+	default:
+		return Matcher{}, errorf(op.pos, "unexpected %s in selector, expected one of =, !=, =~, !~", op.describe())
+	}
+
+	value, err := p.expect(tokenString, "in selector")
+	if err != nil {
+		return Matcher{}, err
+	}
+
+	m := Matcher{Label: label.text, Op: op.kind, Value: value.text}
+	if op.kind == tokenRe || op.kind == tokenNotRe {
+		if m.re, err = regexp.Compile("^(?:" + value.text + ")$"); err != nil {
+			return Matcher{}, errorf(value.pos, "invalid regex: %v", err)
+		}
+	} else if m.Label == "type" && m.Value != models.Gauge && m.Value != models.Counter {
+		return Matcher{}, errorf(value.pos, "unknown metric type %q", m.Value)
+	}
+	return m, nil
+}
+
+// newBinary создает арифметическую операцию и проверяет типы операндов.
+func newBinary(op token, lhs, rhs Node) (Node, error) {
+	for _, n := range []Node{lhs, rhs} {
+		if n.Type() == ValueMatrix {
+			return nil, errorf(n.Pos(), "operator %s is not defined for a range selector, use a function like rate or avg_over_time", op.text)
+		}
+	}
+	return &BinaryExpr{pos: op.pos, Op: op.kind, LHS: lhs, RHS: rhs}, nil
+}
+
+// describeType возвращает название типа значения для сообщений об ошибках.
+func describeType(t ValueType) string {
+	switch t {
+	case ValueMatrix:
+		return "a range selector like m[5m]"
+	case ValueVector:
+		return "an instant vector"
+	default:
+		return fmt.Sprintf("a %s", t)
+	}
+}
@@ -0,0 +1,204 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// newTestEngine создает Engine с историей за 5 минут: значения пишутся раз в минуту,
+// счетчик PollCount сбрасывается на четвертой минуте.
+func newTestEngine() *Engine {
+	h := storage.NewHistory(time.Hour, 100)
+	polls := []int64{10, 20, 30, 5, 15}
+	for i, p := range polls {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		heapAlloc, heapSys, alloc := float64(100*(i+1)), 1000.0, float64(i)
+		h.Record(models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &heapAlloc}, ts)
+		h.Record(models.Metrics{ID: "HeapSys", MType: models.Gauge, Value: &heapSys}, ts)
+		h.Record(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &alloc}, ts)
+		h.Record(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &p}, ts)
+	}
+	return NewEngine(h, zap.NewNop().Sugar())
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "", wantPos: 1, wantMsg: "empty expression"},
+		{expr: "rate(PollCount)", wantPos: 6, wantMsg: "function rate expects a range selector"},
+		{expr: "sum(HeapAlloc[5m])", wantPos: 5, wantMsg: "function sum expects an instant vector"},
+		{expr: "avg_over_time(HeapAlloc[5m], 1)", wantPos: 31, wantMsg: "expects 1 argument(s), got 2"},
+		{expr: "median(HeapAlloc)", wantPos: 1, wantMsg: `unknown function "median"`},
+		{expr: "HeapAlloc[5x]", wantPos: 11, wantMsg: `invalid range "5x"`},
+		{expr: "HeapAlloc[5m] * 2", wantPos: 1, wantMsg: "operator * is not defined for a range selector"},
+		{expr: "(HeapAlloc + 1", wantPos: 15, wantMsg: `unexpected end of input in parenthesized expression, expected ")"`},
+		{expr: "HeapAlloc HeapSys", wantPos: 11, wantMsg: `unexpected identifier "HeapSys"`},
+		{expr: `{id=~"Heap("}`, wantPos: 6, wantMsg: "invalid regex"},
+		{expr: `{name="x"}`, wantPos: 2, wantMsg: `unknown label "name"`},
+		{expr: `{type="histogram"}`, wantPos: 7, wantMsg: `unknown metric type "histogram"`},
+		{expr: `{id="x}`, wantPos: 5, wantMsg: "unterminated string"},
+		{expr: "HeapAlloc # 2", wantPos: 11, wantMsg: `unexpected character '#'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			var qErr *Error
+			require.ErrorAs(t, err, &qErr)
+			assert.Equal(t, tt.wantPos, qErr.Pos)
+			assert.Contains(t, qErr.Msg, tt.wantMsg)
+		})
+	}
+}
+
+func TestEngine_Query(t *testing.T) {
+	e := newTestEngine()
+	now := start.Add(4 * time.Minute)
+
+	tests := []struct {
+		expr     string
+		wantType ValueType
+		want     map[string]float64
+	}{
+		{expr: "2 * (3 + 1) - -1", wantType: ValueScalar, want: map[string]float64{"": 9}},
+		{expr: "HeapAlloc", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 500}},
+		{expr: `{id=~"Heap.*"}`, wantType: ValueVector, want: map[string]float64{"HeapAlloc": 500, "HeapSys": 1000}},
+		{expr: `{type="gauge", id!~"Heap.*"}`, wantType: ValueVector, want: map[string]float64{"Alloc": 4}},
+		{expr: "increase(PollCount[10m])", wantType: ValueVector, want: map[string]float64{"PollCount": 10 + 10 + 5 + 10}},
+		{expr: "rate(PollCount[10m])", wantType: ValueVector, want: map[string]float64{"PollCount": 35.0 / 240}},
+		{expr: "rate(PollCount[90s])", wantType: ValueVector, want: map[string]float64{"PollCount": 10.0 / 60}},
+		{expr: "avg_over_time(HeapAlloc[10m])", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 300}},
+		{expr: "max_over_time(HeapAlloc[150s])", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 500}},
+		{expr: "min_over_time(HeapAlloc[150s])", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 300}},
+		{expr: "count_over_time(Alloc[10m])", wantType: ValueVector, want: map[string]float64{"Alloc": 5}},
+		{expr: "delta(HeapAlloc[10m])", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 400}},
+		{expr: `sum({id=~"Heap.*"})`, wantType: ValueVector, want: map[string]float64{"": 1500}},
+		{expr: `count({type="gauge"})`, wantType: ValueVector, want: map[string]float64{"": 3}},
+		{expr: "HeapAlloc / HeapSys * 100", wantType: ValueVector, want: map[string]float64{"HeapAlloc": 50}},
+		{expr: `{id=~"Heap.*"} - HeapAlloc`, wantType: ValueVector, want: map[string]float64{"HeapAlloc": 0, "HeapSys": 500}},
+		{expr: "Missing + 1", wantType: ValueVector, want: map[string]float64{}},
+		{expr: "sum(Missing)", wantType: ValueVector, want: map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := e.Query(tt.expr, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, result.Type)
+
+			got := make(map[string]float64)
+			for _, s := range result.Series {
+				require.Len(t, s.Points, 1)
+				assert.Equal(t, now, s.Points[0].T)
+				got[s.ID] = s.Points[0].V
+			}
+			require.Len(t, got, len(tt.want))
+			for id, v := range tt.want {
+				assert.InDelta(t, v, got[id], 1e-9, id)
+			}
+		})
+	}
+}
+
+func TestEngine_QueryLookback(t *testing.T) {
+	e := newTestEngine()
+
+	result, err := e.Query("HeapAlloc", start.Add(4*time.Minute+lookback-time.Second))
+	require.NoError(t, err)
+	assert.Len(t, result.Series, 1)
+
+	result, err = e.Query("HeapAlloc", start.Add(4*time.Minute+lookback))
+	require.NoError(t, err)
+	assert.Empty(t, result.Series, "values older than lookback are not returned")
+}
+
+func TestEngine_ServeHTTP(t *testing.T) {
+	e := newTestEngine()
+	e.now = func() time.Time { return start.Add(4 * time.Minute) }
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "range selector",
+			query:      url.Values{"expr": {"Alloc[90s]"}},
+			wantStatus: http.StatusOK,
+			wantBody: `{"result_type":"matrix","series":[{"id":"Alloc","type":"gauge","points":[` +
+				`{"t":"` + start.Add(3*time.Minute).Format(time.RFC3339) + `","v":3},` +
+				`{"t":"` + start.Add(4*time.Minute).Format(time.RFC3339) + `","v":4}]}]}`,
+		},
+		{
+			name:       "explicit time",
+			query:      url.Values{"expr": {"Alloc"}, "time": {"1700000060"}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"result_type":"vector","series":[{"id":"Alloc","type":"gauge","points":[{"t":"` + start.Add(time.Minute).Format(time.RFC3339) + `","v":1}]}]}`,
+		},
+		{
+			name:       "division by zero",
+			query:      url.Values{"expr": {"1 / 0"}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"result_type":"scalar","series":[{"points":[{"t":"` + start.Add(4*time.Minute).Format(time.RFC3339) + `","v":"+Inf"}]}]}`,
+		},
+		{
+			name:       "parse error",
+			query:      url.Values{"expr": {"rate(PollCount)"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_parameter","instance":"/query","position":6,
+				"detail":"position 6: function rate expects a range selector like m[5m] argument, got an instant vector",
+				"errors":[{"field":"expr","code":"invalid_parameter","detail":"position 6: function rate expects a range selector like m[5m] argument, got an instant vector"}]}`,
+		},
+		{
+			name:       "missing expr",
+			query:      url.Values{},
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_parameter","instance":"/query","detail":"expr parameter is required",
+				"errors":[{"field":"expr","code":"invalid_parameter","detail":"expr parameter is required"}]}`,
+		},
+		{
+			name:       "invalid time",
+			query:      url.Values{"expr": {"Alloc"}, "time": {"yesterday"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid_parameter","instance":"/query","detail":"invalid time, expected RFC 3339 or Unix seconds",
+				"errors":[{"field":"time","code":"invalid_parameter","detail":"invalid time, expected RFC 3339 or Unix seconds"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query?"+tt.query.Encode(), nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			contentType := "application/json"
+			if tt.wantStatus != http.StatusOK {
+				contentType = problem.ContentType
+			}
+			assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestPoint_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal([]Point{{T: start, V: math.NaN()}, {T: start, V: math.Inf(-1)}})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"v":"NaN"`)
+	assert.Contains(t, string(data), `"v":"-Inf"`)
+}
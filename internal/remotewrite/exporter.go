@@ -0,0 +1,390 @@
+// Package remotewrite отправляет метрики сервера во внешнее хранилище по протоколу
+// Prometheus remote write (protobuf, сжатый snappy).
+//
+// В режиме values Exporter раз в интервал отправляет текущие значения всех метрик,
+// в режиме samples — каждое сохранение метрики. Значения распределяются по шардам
+// по ID метрики: у каждого шарда своя ограниченная очередь и горутина, которая собирает
+// значения в пакеты и отправляет их с повторами и экспоненциальной задержкой.
+// Значения одной метрики всегда попадают в один шард и отправляются по порядку.
+// После удаления метрики отправляется маркер устаревания (StaleNaN).
+//
+// Если удаленное хранилище не успевает принимать данные, очереди заполняются
+// и новые значения отбрасываются; счетчики отправленных, отброшенных значений
+// и повторов доступны по GET /remote-write.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Версия протокола, которую сервер передает в заголовке запроса.
+const (
+	versionHeader = "X-Prometheus-Remote-Write-Version"
+	version       = "0.1.0"
+)
+
+// Задержки между попытками отправки: retryBase, затем вдвое больше, но не более retryMax.
+var (
+	retryBase = 500 * time.Millisecond
+	retryMax  = 30 * time.Second
+)
+
+// StaleNaN — маркер устаревания Prometheus: значение NaN с особым битовым представлением,
+// после которого ряд считается завершенным.
+var StaleNaN = math.Float64frombits(0x7ff0000000000002)
+
+// flushInterval — как долго шард копит неполный пакет перед отправкой.
+var flushInterval = time.Second
+
+// Status — состояние отправки по всем шардам.
+type Status struct {
+	URL       string        `json:"url"`        // Адрес удаленного хранилища
+	Mode      string        `json:"mode"`       // Режим отправки
+	Queued    int           `json:"queued"`     // Значений в очередях
+	QueueSize int           `json:"queue_size"` // Суммарный размер очередей
+	Sent      int64         `json:"sent"`       // Отправлено значений
+	Failed    int64         `json:"failed"`     // Не отправлено за все попытки
+	Dropped   int64         `json:"dropped"`    // Отброшено из-за переполнения очереди или остановки
+	Retries   int64         `json:"retries"`    // Повторных попыток отправки
+	Shards    []ShardStatus `json:"shards"`     // Состояние отдельных шардов
+}
+
+// ShardStatus — состояние отправки одного шарда.
+type ShardStatus struct {
+	Queued    int       `json:"queued"`
+	QueueSize int       `json:"queue_size"`
+	Sent      int64     `json:"sent"`
+	Failed    int64     `json:"failed"`
+	Dropped   int64     `json:"dropped"`
+	Retries   int64     `json:"retries"`
+	LastSent  time.Time `json:"last_sent"`            // Время последней успешной отправки
+	LastError string    `json:"last_error,omitempty"` // Ошибка последней неудачной отправки
+}
+
+// pending — значение метрики в очереди шарда.
+type pending struct {
+	id     string
+	sample Sample
+}
+
+// Exporter отправляет метрики во внешнее хранилище.
+type Exporter struct {
+	cfg     config.RemoteWriteConfig
+	url     string // Адрес без пароля для логов и состояния
+	storage handler.Storager
+	client  *http.Client
+	shards  []*shard
+	logger  *zap.SugaredLogger
+
+	ctx    context.Context // Отменяется, если очереди не успели отправиться при остановке
+	cancel context.CancelFunc
+}
+
+// NewExporter создает Exporter и запускает шарды. Значения для отправки передаются
+// через Observe (режим samples) или собираются из storage в Run (режим values).
+func NewExporter(cfg config.RemoteWriteConfig, storage handler.Storager, logger *zap.SugaredLogger) *Exporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Exporter{
+		cfg:     cfg,
+		url:     cfg.URL,
+		storage: storage,
+		client:  &http.Client{Timeout: cfg.Timeout.Std()},
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		e.url = u.Redacted()
+	}
+	for range cfg.Shards {
+		s := &shard{exporter: e, queue: make(chan pending, cfg.QueueSize), done: make(chan struct{})}
+		e.shards = append(e.shards, s)
+		go s.run()
+	}
+	return e
+}
+
+// Observe ставит сохраненную метрику в очередь отправки. Подходит для storage.Observable.Subscribe:
+// не блокируется, а при переполненной очереди значение отбрасывается.
+func (e *Exporter) Observe(metric models.Metrics) {
+	e.enqueue(metric, time.Now())
+}
+
+// ObserveDelete ставит в очередь маркер устаревания удаленной метрики, чтобы удаленное
+// хранилище сразу перестало возвращать ее последнее значение. Подходит для storage.Observable.OnDelete.
+func (e *Exporter) ObserveDelete(_, id string) {
+	e.send(id, Sample{Value: StaleNaN, Timestamp: time.Now().UnixMilli()})
+}
+
+// Run раз в интервал ставит в очередь текущие значения всех метрик, пока ctx не отменен.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Interval.Std())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.snapshot(now)
+		}
+	}
+}
+
+// snapshot ставит в очередь значения всех метрик хранилища с меткой времени now.
+func (e *Exporter) snapshot(now time.Time) {
+	for _, m := range e.storage.GetAll() {
+		e.enqueue(m, now)
+	}
+}
+
+// enqueue ставит значение метрики в очередь отправки.
+func (e *Exporter) enqueue(m models.Metrics, t time.Time) {
+	var value float64
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		value = *m.Value
+	case m.MType == models.Counter && m.Delta != nil:
+		value = float64(*m.Delta)
+	default:
+		return
+	}
+
+	e.send(m.ID, Sample{Value: value, Timestamp: t.UnixMilli()})
+}
+
+// send ставит значение метрики id в очередь шарда, выбранного по ID.
+func (e *Exporter) send(id string, sample Sample) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	s := e.shards[h.Sum32()%uint32(len(e.shards))]
+	s.enqueue(pending{id: id, sample: sample})
+}
+
+// Close прекращает прием значений и ждет, пока шарды отправят очереди.
+// Если ctx отменяется раньше, повторы прекращаются, а оставшиеся значения считаются неотправленными.
+func (e *Exporter) Close(ctx context.Context) {
+	for _, s := range e.shards {
+		s.close()
+	}
+
+	for _, s := range e.shards {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			e.cancel()
+			<-s.done
+		}
+	}
+	e.cancel()
+}
+
+// Status возвращает состояние отправки.
+func (e *Exporter) Status() Status {
+	status := Status{URL: e.url, Mode: e.cfg.Mode, Shards: make([]ShardStatus, 0, len(e.shards))}
+	for _, s := range e.shards {
+		ss := s.status()
+		status.Queued += ss.Queued
+		status.QueueSize += ss.QueueSize
+		status.Sent += ss.Sent
+		status.Failed += ss.Failed
+		status.Dropped += ss.Dropped
+		status.Retries += ss.Retries
+		status.Shards = append(status.Shards, ss)
+	}
+	return status
+}
+
+// ServeHTTP отдает состояние отправки в формате JSON.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(e.Status()); err != nil {
+		e.logger.Errorln("failed to write remote write status", err)
+	}
+}
+
+// shard — очередь значений с горутиной отправки.
+type shard struct {
+	exporter *Exporter
+	queue    chan pending
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	stats  ShardStatus
+}
+
+// enqueue ставит значение в очередь без блокировки.
+func (s *shard) enqueue(p pending) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		select {
+		case s.queue <- p:
+			return
+		default:
+		}
+	}
+	s.stats.Dropped++
+}
+
+// close закрывает очередь шарда.
+func (s *shard) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+}
+
+// run собирает значения из очереди в пакеты и отправляет их, пока очередь не закрыта.
+// Пакет отправляется, когда в нем BatchSize значений или когда прошел flushInterval.
+func (s *shard) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batchSize := s.exporter.cfg.BatchSize
+	batch := make([]pending, 0, batchSize)
+	for {
+		select {
+		case p, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) >= batchSize {
+				s.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send отправляет пакет с повторами и записывает результат.
+func (s *shard) send(batch []pending) {
+	if len(batch) == 0 {
+		return
+	}
+	e := s.exporter
+	body := EncodeRequest(group(batch))
+
+	var (
+		attempts int
+		err      error
+	)
+	delay := retryBase
+	for attempts < e.cfg.MaxAttempts {
+		if attempts > 0 {
+			select {
+			case <-time.After(delay):
+			case <-e.ctx.Done():
+			}
+			delay = min(delay*2, retryMax)
+		}
+		if e.ctx.Err() != nil {
+			err = fmt.Errorf("shutdown: %w", e.ctx.Err())
+			break
+		}
+
+		attempts++
+		var retry bool
+		retry, err = e.post(body)
+		if err == nil || !retry {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempts > 1 {
+		s.stats.Retries += int64(attempts - 1)
+	}
+	if err == nil {
+		s.stats.Sent += int64(len(batch))
+		s.stats.LastSent = time.Now()
+		return
+	}
+	s.stats.Failed += int64(len(batch))
+	s.stats.LastError = err.Error()
+	e.logger.Warnw("remote write failed", "url", e.url, "samples", len(batch), "attempts", attempts, "error", err)
+}
+
+// status возвращает состояние шарда.
+func (s *shard) status() ShardStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.stats
+	status.Queued = len(s.queue)
+	status.QueueSize = cap(s.queue)
+	return status
+}
+
+// group собирает значения пакета в ряды: значения одной метрики попадают в один ряд по порядку.
+func group(batch []pending) []TimeSeries {
+	index := make(map[string]int, len(batch))
+	series := make([]TimeSeries, 0, len(batch))
+	for _, p := range batch {
+		i, ok := index[p.id]
+		if !ok {
+			i = len(series)
+			index[p.id] = i
+			series = append(series, TimeSeries{Labels: labels(p.id)})
+		}
+		series[i].Samples = append(series[i].Samples, p.sample)
+	}
+	return series
+}
+
+// post выполняет одну попытку отправки. Возвращает признак того, что попытку стоит
+// повторить: при сетевой ошибке, 5xx и 429. Остальные ошибки означают, что хранилище
+// отклонило данные, и повтор не поможет.
+func (e *Exporter) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set(versionHeader, version)
+	if e.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.cfg.BearerToken)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %d: %s", res.StatusCode, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,157 @@
+package remotewrite
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label — метка ряда.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample — значение ряда в момент времени.
+type Sample struct {
+	Value     float64
+	Timestamp int64 // Миллисекунды Unix
+}
+
+// TimeSeries — ряд значений с набором меток. Метка __name__ содержит имя метрики.
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Номера полей сообщений prometheus.WriteRequest, TimeSeries, Label и Sample.
+const (
+	fieldTimeSeries      = 1
+	fieldLabels          = 1
+	fieldSamples         = 2
+	fieldLabelName       = 1
+	fieldLabelValue      = 2
+	fieldSampleValue     = 1
+	fieldSampleTimestamp = 2
+)
+
+// EncodeRequest кодирует WriteRequest в protobuf и сжимает его snappy, как требует remote write.
+func EncodeRequest(series []TimeSeries) []byte {
+	var b []byte
+	for _, ts := range series {
+		var msg []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, fieldLabelName, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, fieldLabelValue, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+			msg = protowire.AppendTag(msg, fieldLabels, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, fieldSampleValue, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, fieldSampleTimestamp, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			msg = protowire.AppendTag(msg, fieldSamples, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, sample)
+		}
+		b = protowire.AppendTag(b, fieldTimeSeries, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+	return snappy.Encode(nil, b)
+}
+
+// DecodeRequest распаковывает и разбирает тело запроса remote write.
+// Нужна приемникам, в том числе тестовым, которые заменяют удаленное хранилище.
+func DecodeRequest(body []byte) ([]TimeSeries, error) {
+	b, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("snappy: %w", err)
+	}
+
+	var series []TimeSeries
+	err = decodeMessage(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		if num != fieldTimeSeries {
+			return nil
+		}
+		var ts TimeSeries
+		err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+			switch num {
+			case fieldLabels:
+				var l Label
+				err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+					switch num {
+					case fieldLabelName:
+						l.Name = string(data)
+					case fieldLabelValue:
+						l.Value = string(data)
+					}
+					return nil
+				})
+				ts.Labels = append(ts.Labels, l)
+				return err
+			case fieldSamples:
+				var s Sample
+				err := decodeMessage(data, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+					switch num {
+					case fieldSampleValue:
+						s.Value = math.Float64frombits(v)
+					case fieldSampleTimestamp:
+						s.Timestamp = int64(v)
+					}
+					return nil
+				})
+				ts.Samples = append(ts.Samples, s)
+				return err
+			}
+			return nil
+		})
+		series = append(series, ts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// decodeMessage перебирает поля сообщения b и вызывает fn с номером, типом
+// и значением поля: числом для varint и fixed64 или содержимым для length-delimited.
+func decodeMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var (
+			v    uint64
+			data []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
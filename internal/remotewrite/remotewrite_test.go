@@ -0,0 +1,245 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func init() {
+	retryBase = time.Millisecond
+	flushInterval = 10 * time.Millisecond
+}
+
+// receiver — заменитель удаленного хранилища: разбирает запросы remote write
+// и отвечает кодами из statuses по очереди, а после них — 204.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	series   []TimeSeries
+	headers  http.Header
+	block    chan struct{} // Если не nil, ответы задерживаются до закрытия канала
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rv.block != nil {
+		<-rv.block
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := DecodeRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.requests++
+	rv.headers = r.Header.Clone()
+	if len(rv.statuses) > 0 {
+		code := rv.statuses[0]
+		rv.statuses = rv.statuses[1:]
+		http.Error(w, "try later", code)
+		return
+	}
+	rv.series = append(rv.series, series...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rv *receiver) received() []TimeSeries {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]TimeSeries(nil), rv.series...)
+}
+
+func testConfig(url string) config.RemoteWriteConfig {
+	return config.RemoteWriteConfig{
+		URL:         url,
+		BearerToken: "token",
+		Mode:        config.RemoteWriteValues,
+		Interval:    config.Duration(time.Hour),
+		Shards:      2,
+		QueueSize:   100,
+		BatchSize:   10,
+		MaxAttempts: 3,
+		Timeout:     config.Duration(time.Second),
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		id   string
+		want []Label
+	}{
+		{id: "cpu", want: []Label{{"__name__", "cpu"}}},
+		{
+			id:   "http.requests;path=/api;Code=200;empty",
+			want: []Label{{"Code", "200"}, {"__name__", "http_requests"}, {"path", "/api"}},
+		},
+		{
+			id:   "5xx:rate;host-name=web1;host.name=web2",
+			want: []Label{{"__name__", "_5xx:rate"}, {"host_name", "web1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			assert.Equal(t, tt.want, labels(tt.id))
+		})
+	}
+}
+
+func TestEncodeDecodeRequest(t *testing.T) {
+	series := []TimeSeries{
+		{Labels: []Label{{"__name__", "a"}, {"host", "h"}}, Samples: []Sample{{Value: 1.5, Timestamp: 1000}, {Value: -2, Timestamp: 2000}}},
+		{Labels: []Label{{"__name__", "b"}}, Samples: []Sample{{Value: 0, Timestamp: 3000}}},
+	}
+	got, err := DecodeRequest(EncodeRequest(series))
+	require.NoError(t, err)
+	assert.Equal(t, series, got)
+
+	_, err = DecodeRequest([]byte("not snappy"))
+	assert.Error(t, err)
+}
+
+func TestExporter_Values(t *testing.T) {
+	rv := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rv)
+	defer srv.Close()
+
+	s := storage.NewMemStorage()
+	gauge, delta := 0.25, int64(7)
+	require.NoError(t, s.Save(models.Metrics{ID: "load;host=web1", MType: models.Gauge, Value: &gauge}))
+	require.NoError(t, s.Save(models.Metrics{ID: "requests", MType: models.Counter, Delta: &delta}))
+
+	e := NewExporter(testConfig(srv.URL), s, zap.NewNop().Sugar())
+	now := time.UnixMilli(1_700_000_000_000)
+	e.snapshot(now)
+	e.Close(context.Background())
+
+	assert.ElementsMatch(t, []TimeSeries{
+		{Labels: []Label{{"__name__", "load"}, {"host", "web1"}}, Samples: []Sample{{Value: 0.25, Timestamp: now.UnixMilli()}}},
+		{Labels: []Label{{"__name__", "requests"}}, Samples: []Sample{{Value: 7, Timestamp: now.UnixMilli()}}},
+	}, rv.received())
+	assert.Equal(t, "snappy", rv.headers.Get("Content-Encoding"))
+	assert.Equal(t, "Bearer token", rv.headers.Get("Authorization"))
+	assert.Equal(t, version, rv.headers.Get(versionHeader))
+
+	status := e.Status()
+	assert.Equal(t, int64(2), status.Sent)
+	assert.Equal(t, int64(1), status.Retries)
+	assert.Zero(t, status.Failed)
+	assert.Len(t, status.Shards, 2)
+}
+
+func TestExporter_Samples(t *testing.T) {
+	rv := &receiver{}
+	srv := httptest.NewServer(rv)
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Mode = config.RemoteWriteSamples
+	e := NewExporter(cfg, storage.NewMemStorage(), zap.NewNop().Sugar())
+
+	for i := range 3 {
+		v := float64(i)
+		e.Observe(models.Metrics{ID: "temp", MType: models.Gauge, Value: &v})
+	}
+	e.Observe(models.Metrics{ID: "broken", MType: models.Gauge})
+
+	require.Eventually(t, func() bool { return e.Status().Sent == 3 }, time.Second, 5*time.Millisecond)
+	e.Close(context.Background())
+
+	var values []float64
+	for _, ts := range rv.received() {
+		assert.Equal(t, []Label{{"__name__", "temp"}}, ts.Labels)
+		for _, sample := range ts.Samples {
+			values = append(values, sample.Value)
+		}
+	}
+	assert.Equal(t, []float64{0, 1, 2}, values)
+}
+
+func TestExporter_Failures(t *testing.T) {
+	t.Run("rejected batch is not retried", func(t *testing.T) {
+		rv := &receiver{statuses: []int{http.StatusBadRequest}}
+		srv := httptest.NewServer(rv)
+		defer srv.Close()
+
+		e := NewExporter(testConfig(srv.URL), storage.NewMemStorage(), zap.NewNop().Sugar())
+		v := 1.0
+		e.Observe(models.Metrics{ID: "x", MType: models.Gauge, Value: &v})
+		e.Close(context.Background())
+
+		status := e.Status()
+		assert.Equal(t, int64(1), status.Failed)
+		assert.Zero(t, status.Retries)
+		assert.Equal(t, 1, rv.requests)
+		assert.Contains(t, status.Shards[0].LastError+status.Shards[1].LastError, "unexpected status 400: try later")
+	})
+
+	t.Run("full queue drops samples", func(t *testing.T) {
+		rv := &receiver{block: make(chan struct{})}
+		srv := httptest.NewServer(rv)
+		defer srv.Close()
+
+		cfg := testConfig(srv.URL)
+		cfg.Shards, cfg.QueueSize, cfg.BatchSize = 1, 2, 1
+		e := NewExporter(cfg, storage.NewMemStorage(), zap.NewNop().Sugar())
+
+		v := 1.0
+		m := models.Metrics{ID: "x", MType: models.Gauge, Value: &v}
+		e.Observe(m) // Отправляется и ждет ответа
+		require.Eventually(t, func() bool { return e.Status().Queued == 0 }, time.Second, time.Millisecond)
+		for range 5 {
+			e.Observe(m)
+		}
+
+		status := e.Status()
+		assert.Equal(t, 2, status.Queued)
+		assert.Equal(t, int64(3), status.Dropped)
+
+		close(rv.block)
+		e.Close(context.Background())
+		assert.Equal(t, int64(3), e.Status().Sent)
+	})
+
+	t.Run("close stops retries", func(t *testing.T) {
+		rv := &receiver{statuses: []int{500, 500, 500}}
+		srv := httptest.NewServer(rv)
+		defer srv.Close()
+
+		retryBase = time.Hour
+		defer func() { retryBase = time.Millisecond }()
+
+		e := NewExporter(testConfig(srv.URL), storage.NewMemStorage(), zap.NewNop().Sugar())
+		v := 1.0
+		e.Observe(models.Metrics{ID: "x", MType: models.Gauge, Value: &v})
+		require.Eventually(t, func() bool {
+			rv.mu.Lock()
+			defer rv.mu.Unlock()
+			return rv.requests == 1
+		}, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		e.Close(ctx)
+
+		assert.Equal(t, int64(1), e.Status().Failed)
+	})
+}
@@ -0,0 +1,56 @@
+package remotewrite
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// nameLabel — метка с именем метрики.
+const nameLabel = "__name__"
+
+// labels переводит ID метрики вида name;key=value в метки Prometheus, отсортированные по имени.
+// Недопустимые в Prometheus символы имени и ключей заменяются на _. Теги без значения пропускаются:
+// в Prometheus метка с пустым значением равнозначна отсутствию метки.
+func labels(id string) []Label {
+	parts := strings.Split(id, models.TagSeparator)
+	result := []Label{{Name: nameLabel, Value: sanitizeName(parts[0], true)}}
+
+	seen := map[string]bool{nameLabel: true}
+	for _, tag := range parts[1:] {
+		key, value, _ := strings.Cut(tag, "=")
+		key = sanitizeName(key, false)
+		if value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, Label{Name: key, Value: value})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// sanitizeName приводит имя метрики или метки к виду [a-zA-Z_][a-zA-Z0-9_]*.
+// В именах метрик допустимо и двоеточие. Имя, начинающееся с цифры, получает префикс _.
+func sanitizeName(s string, metric bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':' && metric:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package scrape
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+)
+
+// defaultPath — путь, по которому агент отдает метрики, если в адресе цели путь не указан.
+const defaultPath = "/metrics"
+
+// targetURL приводит адрес цели к URL: host:port дополняется схемой http и путем /metrics.
+func targetURL(target string) (string, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("scrape target %q: %w", target, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scrape target %q: unsupported scheme %q", target, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("scrape target %q: empty host", target)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultPath
+	}
+	return u.String(), nil
+}
+
+// fileDiscovery читает список целей из файла и перечитывает его, только если файл изменился.
+type fileDiscovery struct {
+	path    string
+	modTime time.Time
+	targets []string
+}
+
+// Targets возвращает список целей из файла. Если файл не изменился с прошлого чтения,
+// возвращается прежний список. При ошибке чтения прежний список сохраняется.
+func (d *fileDiscovery) Targets() ([]string, error) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return d.targets, fmt.Errorf("scrape targets file: %w", err)
+	}
+	if info.ModTime().Equal(d.modTime) {
+		return d.targets, nil
+	}
+
+	var targets []string
+	if err = config.LoadFile(d.path, &targets); err != nil {
+		return d.targets, fmt.Errorf("scrape targets: %w", err)
+	}
+
+	d.modTime = info.ModTime()
+	d.targets = targets
+	return targets, nil
+}
@@ -0,0 +1,306 @@
+// Package scrape реализует сбор метрик с агентов, работающих в режиме pull.
+//
+// Manager с заданным интервалом опрашивает каждую цель по HTTP, получает JSON-массив
+// метрик в формате /updates/ и сохраняет его в хранилище сервера. Агент отдает счетчики
+// как накопленные значения, поэтому Manager помнит последнее значение каждого счетчика
+// по каждой цели и сохраняет только приращение; уменьшение значения считается
+// перезапуском агента, и тогда приращением считается само новое значение.
+// Первое значение счетчика после запуска сервера только задает базу: его история
+// до этого момента уже может быть в восстановленном хранилище, поэтому сохраняется
+// нулевое приращение. Последнее значение запоминается только после успешного сохранения,
+// чтобы при ошибке приращение было сохранено при следующем опросе.
+//
+// Состояние каждой цели доступно через ServeHTTP, а также сохраняется в хранилище
+// как gauge-метрики scrape_up, scrape_duration_seconds и scrape_samples с тегом instance.
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Состояния цели.
+const (
+	HealthUnknown = "unknown" // Цель еще не опрашивалась
+	HealthUp      = "up"      // Последний опрос успешен
+	HealthDown    = "down"    // Последний опрос завершился ошибкой
+)
+
+// maxResponseBytes ограничивает размер ответа агента.
+const maxResponseBytes = 16 << 20
+
+// Status — состояние опроса цели.
+type Status struct {
+	URL               string    `json:"url"`                   // Адрес, по которому опрашивается цель
+	Health            string    `json:"health"`                // unknown, up или down
+	LastScrape        time.Time `json:"last_scrape"`           // Время начала последнего опроса
+	LastDuration      float64   `json:"last_duration_seconds"` // Длительность последнего опроса в секундах
+	LastError         string    `json:"last_error,omitempty"`  // Ошибка последнего опроса
+	Samples           int       `json:"samples"`               // Число метрик в последнем успешном ответе
+	ConsecutiveErrors int       `json:"consecutive_errors"`    // Число ошибок подряд
+}
+
+// target — опрашиваемый агент.
+type target struct {
+	url      string
+	instance string           // host:port цели, значение тега instance
+	counters map[string]int64 // Последние полученные накопленные значения счетчиков
+	status   Status
+}
+
+// Manager опрашивает агентов и сохраняет их метрики в хранилище.
+type Manager struct {
+	cfg       config.ScrapeConfig
+	storage   handler.Storager
+	client    *http.Client
+	logger    *zap.SugaredLogger
+	discovery *fileDiscovery // nil, если файл со списком целей не задан
+
+	mu      sync.Mutex // Защищает targets
+	targets map[string]*target
+}
+
+// NewManager создает Manager для целей из cfg. Некорректные статические адреса считаются ошибкой.
+func NewManager(cfg config.ScrapeConfig, storage handler.Storager, logger *zap.SugaredLogger) (*Manager, error) {
+	m := &Manager{
+		cfg:     cfg,
+		storage: storage,
+		client:  &http.Client{Timeout: cfg.Timeout.Std()},
+		logger:  logger,
+		targets: make(map[string]*target),
+	}
+	if cfg.TargetsFile != "" {
+		m.discovery = &fileDiscovery{path: cfg.TargetsFile}
+	}
+	for _, t := range cfg.Targets {
+		if _, err := targetURL(t); err != nil {
+			return nil, err
+		}
+	}
+	m.refresh()
+	return m, nil
+}
+
+// Run опрашивает цели с интервалом из конфигурации до отмены ctx.
+// Первый опрос выполняется сразу.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval.Std())
+	defer ticker.Stop()
+
+	for {
+		m.ScrapeAll(ctx)
+		select {
+		case <-ticker.C:
+			m.refresh()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh обновляет список целей: статические адреса и адреса из файла.
+// Цели, исчезнувшие из списка, удаляются вместе с их состоянием.
+func (m *Manager) refresh() {
+	addresses := m.cfg.Targets
+	if m.discovery != nil {
+		discovered, err := m.discovery.Targets()
+		if err != nil {
+			m.logger.Errorln(err)
+		}
+		addresses = append(append([]string(nil), addresses...), discovered...)
+	}
+
+	urls := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		u, err := targetURL(address)
+		if err != nil {
+			m.logger.Errorln(err)
+			continue
+		}
+		urls[u] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for u := range m.targets {
+		if !urls[u] {
+			delete(m.targets, u)
+		}
+	}
+	for u := range urls {
+		if _, ok := m.targets[u]; !ok {
+			m.targets[u] = newTarget(u)
+		}
+	}
+}
+
+// newTarget создает цель с адресом rawURL.
+func newTarget(rawURL string) *target {
+	instance := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		instance = u.Host
+	}
+	return &target{
+		url:      rawURL,
+		instance: instance,
+		counters: make(map[string]int64),
+		status:   Status{URL: rawURL, Health: HealthUnknown},
+	}
+}
+
+// ScrapeAll один раз опрашивает все цели параллельно и дожидается завершения опросов.
+func (m *Manager) ScrapeAll(ctx context.Context) {
+	m.mu.Lock()
+	targets := make([]*target, 0, len(m.targets))
+	for _, t := range m.targets {
+		targets = append(targets, t)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			m.scrape(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// scrape опрашивает одну цель, сохраняет ее метрики и обновляет состояние цели.
+func (m *Manager) scrape(ctx context.Context, t *target) {
+	start := time.Now()
+	samples, err := m.scrapeTarget(ctx, t)
+	duration := time.Since(start)
+
+	m.mu.Lock()
+	t.status.LastScrape = start
+	t.status.LastDuration = duration.Seconds()
+	if err != nil {
+		t.status.Health = HealthDown
+		t.status.LastError = err.Error()
+		t.status.ConsecutiveErrors++
+	} else {
+		t.status.Health = HealthUp
+		t.status.LastError = ""
+		t.status.Samples = samples
+		t.status.ConsecutiveErrors = 0
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Warnln("scrape failed", "target", t.url, "error", err)
+	}
+
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	tags := map[string]string{"instance": t.instance}
+	m.saveGauge(models.TaggedID("scrape_up", tags), up)
+	m.saveGauge(models.TaggedID("scrape_duration_seconds", tags), duration.Seconds())
+	if err == nil {
+		m.saveGauge(models.TaggedID("scrape_samples", tags), float64(samples))
+	}
+}
+
+// scrapeTarget получает метрики цели и сохраняет их. Возвращает число полученных метрик.
+func (m *Manager) scrapeTarget(ctx context.Context, t *target) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return 0, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	var metrics []models.Metrics
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxResponseBytes)).Decode(&metrics); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+
+	for _, metric := range metrics {
+		if metric.Validate() != nil {
+			continue // Некорректные метрики цели пропускаются
+		}
+		if metric.MType != models.Counter {
+			if err = m.storage.Save(metric); err != nil {
+				return 0, fmt.Errorf("save %s: %w", metric.ID, err)
+			}
+			continue
+		}
+
+		total := *metric.Delta
+		prev, seen := t.counters[metric.ID]
+		var delta int64
+		switch {
+		case !seen:
+			delta = 0 // Первое значение — база для следующих приращений
+		case total < prev:
+			delta = total // Агент перезапустился, счетчик начался заново
+		default:
+			delta = total - prev
+		}
+		if seen && delta == 0 {
+			continue
+		}
+		metric.Delta = &delta
+		if err = m.storage.Save(metric); err != nil {
+			return 0, fmt.Errorf("save %s: %w", metric.ID, err)
+		}
+		t.counters[metric.ID] = total
+	}
+	return len(metrics), nil
+}
+
+// saveGauge сохраняет служебную gauge-метрику.
+func (m *Manager) saveGauge(id string, value float64) {
+	if err := m.storage.Save(models.Metrics{ID: id, MType: models.Gauge, Value: &value}); err != nil {
+		m.logger.Errorln("failed to save scrape metric", id, err)
+	}
+}
+
+// Statuses возвращает состояние всех целей, отсортированное по адресу.
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.targets))
+	for _, t := range m.targets {
+		statuses = append(statuses, t.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// ServeHTTP отдает состояние целей в формате JSON.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Statuses()); err != nil {
+		m.logger.Errorln("failed to write scrape targets", err)
+	}
+}
@@ -0,0 +1,189 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_targetURL(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{target: "agent:9100", want: "http://agent:9100/metrics"},
+		{target: "https://agent:9100", want: "https://agent:9100/metrics"},
+		{target: "http://agent:9100/custom", want: "http://agent:9100/custom"},
+		{target: "ftp://agent:9100", wantErr: true},
+		{target: "http://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := targetURL(tt.target)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestManager_ScrapeAll(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		total int64
+		alloc = 1.0
+	)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		counter, gauge := total, alloc
+		_ = json.NewEncoder(w).Encode([]models.Metrics{
+			{ID: "Alloc", MType: models.Gauge, Value: &gauge},
+			{ID: "PollCount", MType: models.Counter, Delta: &counter},
+		})
+	}))
+	defer agent.Close()
+
+	address := strings.TrimPrefix(agent.URL, "http://")
+	cfg := config.ScrapeConfig{
+		Targets:  []string{address, "127.0.0.1:1"},
+		Interval: config.Duration(time.Minute),
+		Timeout:  config.Duration(time.Second),
+	}
+	// Итог счетчика, восстановленный из файла после перезапуска сервера.
+	s := storage.NewMemStorage()
+	restored := int64(5)
+	require.NoError(t, s.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &restored}))
+	m, err := NewManager(cfg, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	// Накопленные значения агента и ожидаемое значение счетчика на сервере после каждого опроса.
+	steps := []struct {
+		total int64
+		want  int64
+	}{
+		{total: 5, want: 5}, // Первое значение — база, сохраненный итог не меняется
+		{total: 8, want: 8},
+		{total: 8, want: 8},
+		{total: 2, want: 10}, // Агент перезапустился
+	}
+	for _, step := range steps {
+		mu.Lock()
+		total = step.total
+		mu.Unlock()
+
+		m.ScrapeAll(context.Background())
+
+		got, ok := s.Get(models.Counter, "PollCount")
+		require.True(t, ok)
+		assert.Equal(t, step.want, *got.Delta)
+	}
+
+	got, ok := s.Get(models.Gauge, "Alloc")
+	require.True(t, ok)
+	assert.Equal(t, 1.0, *got.Value)
+
+	statuses := m.Statuses()
+	require.Len(t, statuses, 2)
+	health := map[string]string{}
+	for _, st := range statuses {
+		health[st.URL] = st.Health
+	}
+	assert.Equal(t, HealthUp, health[agent.URL+"/metrics"])
+	assert.Equal(t, HealthDown, health["http://127.0.0.1:1/metrics"])
+
+	up, ok := s.Get(models.Gauge, models.TaggedID("scrape_up", map[string]string{"instance": address}))
+	require.True(t, ok)
+	assert.Equal(t, 1.0, *up.Value)
+	down, ok := s.Get(models.Gauge, models.TaggedID("scrape_up", map[string]string{"instance": "127.0.0.1:1"}))
+	require.True(t, ok)
+	assert.Equal(t, 0.0, *down.Value)
+}
+
+// failingStorage отклоняет сохранение счетчиков, пока fail равен true.
+type failingStorage struct {
+	handler.Storager
+	fail bool
+}
+
+func (s *failingStorage) Save(m models.Metrics) error {
+	if s.fail && m.MType == models.Counter {
+		return errors.New("storage unavailable")
+	}
+	return s.Storager.Save(m)
+}
+
+func TestManager_ScrapeRetriesFailedSave(t *testing.T) {
+	var total int64
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := total
+		_ = json.NewEncoder(w).Encode([]models.Metrics{{ID: "PollCount", MType: models.Counter, Delta: &counter}})
+	}))
+	defer agent.Close()
+
+	cfg := config.ScrapeConfig{
+		Targets:  []string{strings.TrimPrefix(agent.URL, "http://")},
+		Interval: config.Duration(time.Minute),
+		Timeout:  config.Duration(time.Second),
+	}
+	s := &failingStorage{Storager: storage.NewMemStorage()}
+	m, err := NewManager(cfg, s, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	total = 3
+	m.ScrapeAll(context.Background())
+
+	// Приращение, которое не удалось сохранить, сохраняется при следующем опросе.
+	total, s.fail = 7, true
+	m.ScrapeAll(context.Background())
+	assert.Equal(t, HealthDown, m.Statuses()[0].Health)
+
+	s.fail = false
+	m.ScrapeAll(context.Background())
+	got, ok := s.Get(models.Counter, "PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(4), *got.Delta)
+}
+
+func TestManager_FileDiscovery(t *testing.T) {
+	path := t.TempDir() + "/targets.yaml"
+	require.NoError(t, writeTargets(path, "- agent-a:9100\n- agent-b:9100\n", time.Now().Add(-time.Minute)))
+
+	cfg := config.ScrapeConfig{TargetsFile: path, Interval: config.Duration(time.Minute), Timeout: config.Duration(time.Second)}
+	m, err := NewManager(cfg, storage.NewMemStorage(), zap.NewNop().Sugar())
+	require.NoError(t, err)
+	assert.Len(t, m.Statuses(), 2)
+
+	require.NoError(t, writeTargets(path, "- agent-b:9100\n", time.Now()))
+	m.refresh()
+
+	statuses := m.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "http://agent-b:9100/metrics", statuses[0].URL)
+}
+
+func writeTargets(path, content string, modTime time.Time) error {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/alerting"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/graphite"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/influx"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/otlp"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/query"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/remotewrite"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/scrape"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/stream"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/webhook"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/ws"
+	"go.uber.org/zap"
+)
+
+// App — сервер метрик вместе со всеми подсистемами, включенными в конфигурации.
+// NewApp регистрирует их маршруты на одном роутере, поэтому main и тесты
+// работают с одним и тем же набором маршрутов.
+type App struct {
+	server   *Server
+	storage  *storage.Observable
+	graphite *graphite.Server // nil, если прием Graphite выключен
+	logger   *zap.SugaredLogger
+
+	tasks   []func(ctx context.Context) // Фоновые задачи, работающие до отмены ctx
+	closers []func()                    // Вызываются после остановки фоновых задач, до закрытия хранилища
+}
+
+// NewApp создает хранилище, обработчики и подсистемы, включенные в cfg, и регистрирует
+// их маршруты. Фоновые задачи и прием Graphite запускаются только в Run.
+func NewApp(cfg *config.ServerConfig, logger *zap.SugaredLogger) (*App, error) {
+	baseStorage, err := storage.New(cfg.Storage) // Создание хранилища метрик
+	if err != nil {
+		return nil, fmt.Errorf("create storage: %w", err)
+	}
+	metricStorage := storage.NewObservable(baseStorage) // Подписчики узнают о каждом сохранении и удалении метрики
+	h := handler.NewHandler(metricStorage)              // Создание обработчиков с хранилищем
+
+	app := &App{
+		server:  New(cfg, h, logger),
+		storage: metricStorage,
+		logger:  logger,
+	}
+	if err = app.register(cfg, h); err != nil {
+		app.Close()
+		return nil, err
+	}
+	return app, nil
+}
+
+// register подключает к серверу подсистемы, включенные в cfg.
+func (a *App) register(cfg *config.ServerConfig, h *handler.Handler) error {
+	metricStorage, logger := a.storage, a.logger
+
+	// История значений для запросов с функциями над интервалами.
+	// Восстановленные из файла метрики становятся первыми значениями истории.
+	history := storage.NewHistory(cfg.History.Retention.Std(), cfg.History.MaxSamples)
+	for _, m := range metricStorage.GetAll() {
+		history.Observe(m)
+	}
+	metricStorage.Subscribe(history.Observe)
+	metricStorage.OnDelete(history.Delete)
+	a.server.Handle("/query", query.NewEngine(history, logger))
+
+	// Скорость изменения счетчиков в ответах /value и на HTML-странице
+	rateWindows := make([]time.Duration, len(cfg.History.RateWindows))
+	for i, w := range cfg.History.RateWindows {
+		rateWindows[i] = w.Std()
+	}
+	h.SetRates(storage.NewRates(history, rateWindows))
+
+	// Прием метрик в формате InfluxDB line protocol
+	influxHandler, err := influx.NewHandler(cfg.Influx, metricStorage, logger)
+	if err != nil {
+		return fmt.Errorf("create influx handler: %w", err)
+	}
+	a.server.HandleMethod(http.MethodPost, "/write", influxHandler)
+
+	// Прием метрик OpenTelemetry по OTLP/HTTP
+	otlpReceiver, err := otlp.NewReceiver(cfg.OTLP, metricStorage, logger)
+	if err != nil {
+		return fmt.Errorf("create otlp receiver: %w", err)
+	}
+	a.server.HandleMethod(http.MethodPost, "/v1/metrics", otlpReceiver)
+
+	// Поток обновлений метрик для дашбордов
+	broadcaster := stream.NewBroadcaster()
+	metricStorage.Subscribe(broadcaster.Publish)
+	metricStorage.OnDelete(broadcaster.PublishDelete)
+	a.server.Handle("/stream", broadcaster)
+	a.server.OnShutdown(broadcaster.Close)
+
+	// WebSocket API: сохранение пакетов и подписка на изменения через одно соединение
+	wsHandler := ws.NewHandler(metricStorage, broadcaster, logger)
+	a.server.Handle("/ws", wsHandler)
+	a.server.OnShutdown(wsHandler.Close)
+
+	// Сбор метрик с агентов, работающих в режиме pull
+	if cfg.Scrape.Enabled() {
+		manager, err := scrape.NewManager(cfg.Scrape, metricStorage, logger)
+		if err != nil {
+			return fmt.Errorf("create scrape manager: %w", err)
+		}
+		a.server.Handle("/targets", manager)
+		a.tasks = append(a.tasks, manager.Run)
+	}
+
+	// Вычисление правил оповещений
+	if cfg.Alerting.Enabled() {
+		engine, err := newAlertingEngine(cfg.Alerting, metricStorage, logger)
+		if err != nil {
+			return fmt.Errorf("load alerting rules: %w", err)
+		}
+		a.server.Handle("/alerts", engine)
+		interval := cfg.Alerting.Interval.Std()
+		a.tasks = append(a.tasks, func(ctx context.Context) { engine.Run(ctx, interval) })
+	}
+
+	// Исходящие уведомления об изменении метрик
+	if len(cfg.Webhooks.Endpoints) > 0 {
+		dispatcher, err := webhook.NewDispatcher(cfg.Webhooks, logger)
+		if err != nil {
+			return fmt.Errorf("create webhook dispatcher: %w", err)
+		}
+		metricStorage.Subscribe(dispatcher.Observe)
+		metricStorage.OnDelete(dispatcher.ObserveDelete)
+		a.server.Handle("/webhooks/deliveries", dispatcher)
+		a.closers = append(a.closers, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Std())
+			defer cancel()
+			if err := dispatcher.Close(ctx); err != nil {
+				logger.Errorln("failed to close webhook dispatcher", err)
+			}
+		})
+	}
+
+	// Отправка метрик во внешнее хранилище по протоколу Prometheus remote write
+	if cfg.RemoteWrite.Enabled() {
+		exporter := remotewrite.NewExporter(cfg.RemoteWrite, metricStorage, logger)
+		a.server.Handle("/remote-write", exporter)
+		metricStorage.OnDelete(exporter.ObserveDelete)
+		if cfg.RemoteWrite.Mode == config.RemoteWriteSamples {
+			metricStorage.Subscribe(exporter.Observe)
+		} else {
+			a.tasks = append(a.tasks, exporter.Run)
+		}
+		a.closers = append(a.closers, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Std())
+			defer cancel()
+			exporter.Close(ctx)
+		})
+	}
+
+	// Прием метрик по протоколу Graphite plaintext
+	if cfg.Graphite.Enabled() {
+		a.graphite, err = graphite.NewServer(cfg.Graphite, metricStorage, logger)
+		if err != nil {
+			return fmt.Errorf("create graphite listener: %w", err)
+		}
+	}
+	return nil
+}
+
+// Handler возвращает обработчик со всеми зарегистрированными маршрутами и middleware.
+func (a *App) Handler() http.Handler {
+	return a.server.Handler()
+}
+
+// Run запускает прием Graphite, фоновые задачи и HTTP-сервер и блокируется до отмены ctx
+// или ошибки сервера. Затем останавливает фоновые задачи, закрывает подсистемы
+// и хранилище и возвращает ошибку сервера.
+func (a *App) Run(ctx context.Context) error {
+	defer a.Close()
+
+	if a.graphite != nil {
+		if err := a.graphite.Start(); err != nil {
+			return fmt.Errorf("start graphite listener: %w", err)
+		}
+	}
+
+	// Если сервер не смог запуститься (например, порт занят), сигнала не будет:
+	// фоновые задачи останавливаются сразу после выхода из Run.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Фоновые задачи должны завершиться до закрытия хранилища
+	var background sync.WaitGroup
+	for _, task := range a.tasks {
+		background.Add(1)
+		go func(task func(ctx context.Context)) {
+			defer background.Done()
+			task(ctx)
+		}(task)
+	}
+
+	err := a.server.Run(ctx) // Запуск HTTP-сервера до получения сигнала остановки или ошибки
+	cancel()
+	background.Wait()
+	return err
+}
+
+// Close закрывает прием Graphite, подсистемы и хранилище. Run вызывает его сам;
+// отдельно Close нужен, только если Run не вызывался.
+func (a *App) Close() {
+	if a.graphite != nil {
+		if err := a.graphite.Close(); err != nil {
+			a.logger.Errorln("failed to close graphite listener", err)
+		}
+	}
+	for _, closeFn := range a.closers {
+		closeFn()
+	}
+
+	// Observable закрывает обернутое хранилище, если тому нужно сбросить данные
+	if err := a.storage.Close(); err != nil {
+		a.logger.Errorln("failed to close storage", err)
+	}
+}
+
+// newAlertingEngine загружает файл правил и создает Engine с получателями из этого файла.
+// Если получатели не заданы, уведомления записываются в лог.
+func newAlertingEngine(cfg config.AlertingConfig, storage handler.Storager, logger *zap.SugaredLogger) (*alerting.Engine, error) {
+	file, err := alerting.LoadFile(cfg.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	notifierConfigs := file.Notifiers
+	if len(notifierConfigs) == 0 {
+		notifierConfigs = []alerting.NotifierConfig{{Type: alerting.NotifierLog}}
+	}
+
+	notifiers := make([]alerting.Notifier, 0, len(notifierConfigs))
+	for _, nc := range notifierConfigs {
+		n, err := alerting.NewNotifier(nc, logger)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return alerting.NewEngine(file.Rules, storage, notifiers, logger), nil
+}
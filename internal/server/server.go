@@ -4,21 +4,37 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/apidoc"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
 	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/middleware"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
+// apiPrefix — префикс маршрутов версионированного API.
+const apiPrefix = "/api/v1"
+
+// legacyDeprecatedAt — момент, с которого маршруты без префикса apiPrefix считаются устаревшими.
+var legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// idempotencyTTL — время, в течение которого сервер помнит обработанные ключи идемпотентности.
+const idempotencyTTL = 10 * time.Minute
+
 // Server — структура, инкапсулирующая обработчики, роутер, конфиг и логгер.
 type Server struct {
-	handler *handler.Handler     // Обработчик HTTP-запросов
-	router  *chi.Mux             // HTTP-роутер
-	cfg     *config.ServerConfig // Конфигурация сервера
-	logger  *zap.SugaredLogger   // Логгер
+	handler     *handler.Handler             // Обработчик HTTP-запросов
+	router      *chi.Mux                     // HTTP-роутер
+	cfg         *config.ServerConfig         // Конфигурация сервера
+	logger      *zap.SugaredLogger           // Логгер
+	idempotency *middleware.IdempotencyCache // Ответы на уже обработанные пакеты метрик
+	onShutdown  []func()                     // Вызываются в начале остановки сервера
 }
 
 // New создает и настраивает новый экземпляр Server с роутером и обработчиками.
@@ -26,24 +42,127 @@ type Server struct {
 func New(cfg *config.ServerConfig, handler *handler.Handler, logger *zap.SugaredLogger) *Server {
 	router := chi.NewRouter()
 
-	server := &Server{handler: handler, router: router, cfg: cfg, logger: logger}
+	server := &Server{
+		handler:     handler,
+		router:      router,
+		cfg:         cfg,
+		logger:      logger,
+		idempotency: middleware.NewIdempotencyCache(idempotencyTTL),
+	}
+
+	// Ошибки маршрутизации отдаются в том же формате, что и ошибки обработчиков
+	router.NotFound(problem.NotFoundHandler)
+	router.MethodNotAllowed(problem.MethodNotAllowedHandler)
+
+	router.Get("/", server.handler.All) // Получить все метрики: JSON или HTML-страница для браузера
+
+	// Версионированный API
+	router.Route(apiPrefix, func(r chi.Router) {
+		r.Get("/metrics", server.handler.ListMetrics)                 // Получить все метрики
+		r.Post("/metrics", server.handler.UpdatesJSON)                // Обновить пакет метрик
+		r.Get("/metrics/{type}/{id}", server.handler.GetMetric)       // Получить метрику
+		r.Put("/metrics/{type}/{id}", server.handler.PutMetric)       // Обновить метрику
+		r.Delete("/metrics/{type}/{id}", server.handler.DeleteMetric) // Удалить метрику
+	})
 
-	// Регистрируем маршруты для работы с метриками
-	router.Get("/", server.handler.All)                               // Получить все метрики
-	router.Post("/update/{type}/{id}/{value}", server.handler.Update) // Обновить метрику через URL
-	router.Post("/update/", server.handler.UpdateJSON)                // Обновить метрику через JSON
-	router.Post("/value", server.handler.ValueJSON)                   // Получить метрику через JSON
-	router.Post("/value/", server.handler.ValueJSON)                  // Получить метрику через JSON (альтернативный путь)
-	router.Get("/value/{type}/{id}", server.handler.Value)            // Получить метрику по типу и id
+	// Устаревшие маршруты: работают как раньше для уже развернутых агентов,
+	// но отвечают с заголовком Deprecation и ссылкой на версионированный API
+	router.Group(func(r chi.Router) {
+		r.Use(func(h http.Handler) http.Handler {
+			return middleware.Deprecated(h, apiPrefix+"/metrics", legacyDeprecatedAt)
+		})
+
+		r.Post("/update/{type}/{id}/{value}", server.handler.Update) // Обновить метрику через URL
+		r.Post("/update/", server.handler.UpdateJSON)                // Обновить метрику через JSON
+		r.Post("/updates/", server.handler.UpdatesJSON)              // Обновить пакет метрик через JSON
+		r.Post("/value", server.handler.ValueJSON)                   // Получить метрику через JSON
+		r.Post("/value/", server.handler.ValueJSON)                  // Получить метрику через JSON (альтернативный путь)
+		r.Get("/value/{type}/{id}", server.handler.Value)            // Получить метрику по типу и id
+	})
+
+	// Спецификация OpenAPI этих маршрутов и ее HTML-представление
+	router.Get("/openapi.json", apidoc.Spec)
+	router.Get("/docs", apidoc.Viewer)
 
 	return server
 }
 
-// Run запускает HTTP-сервер на указанном в конфиге адресе.
-// Использует middleware для логирования запросов.
-func (s *Server) Run() {
-	err := http.ListenAndServe(s.cfg.Address, middleware.Logging(s.router, s.logger))
+// Handle регистрирует дополнительный обработчик h для GET-запросов по пути pattern.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.HandleMethod(http.MethodGet, pattern, h)
+}
+
+// HandleMethod регистрирует дополнительный обработчик h для запросов method по пути pattern.
+func (s *Server) HandleMethod(method, pattern string, h http.Handler) {
+	s.router.Method(method, pattern, h)
+}
+
+// OnShutdown регистрирует функцию, которая вызывается в начале остановки сервера.
+// Нужна обработчикам с долгоживущими соединениями, чтобы они завершились, не дожидаясь таймаута.
+func (s *Server) OnShutdown(fn func()) {
+	s.onShutdown = append(s.onShutdown, fn)
+}
+
+// Handler возвращает роутер, обернутый в middleware: логирование запросов, ограничение
+// размера тела, дедупликацию запросов по ключу идемпотентности, распаковку gzip-тел
+// и проверку подписи. Размер тела ограничивается и до, и после распаковки, чтобы
+// небольшой сжатый запрос не распаковался в тело больше лимита.
+func (s *Server) Handler() http.Handler {
+	var h http.Handler = s.router
+	h = middleware.Signature(h, s.cfg.Key)
+	if s.cfg.Limits.MaxBodyBytes > 0 {
+		h = middleware.BodyLimit(h, s.cfg.Limits.MaxBodyBytes)
+	}
+	h = middleware.Gzip(h)
+	h = middleware.Idempotency(h, s.idempotency)
+	if s.cfg.Limits.MaxBodyBytes > 0 {
+		h = middleware.BodyLimit(h, s.cfg.Limits.MaxBodyBytes)
+	}
+	return middleware.Logging(h, s.logger)
+}
+
+// Run запускает HTTP-сервер (или HTTPS, если в конфиге задан сертификат) на указанном
+// в конфиге адресе и блокируется до отмены ctx.
+// После отмены ctx сервер перестает принимать соединения и ждет завершения обрабатываемых
+// запросов не дольше ShutdownTimeout.
+func (s *Server) Run(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:         s.cfg.Address,
+		Handler:      s.Handler(),
+		ReadTimeout:  s.cfg.Limits.ReadTimeout.Std(),
+		WriteTimeout: s.cfg.Limits.WriteTimeout.Std(),
+		IdleTimeout:  s.cfg.Limits.IdleTimeout.Std(),
+	}
+
+	for _, fn := range s.onShutdown {
+		httpServer.RegisterOnShutdown(fn)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if s.cfg.TLS.Enabled() {
+			errCh <- httpServer.ListenAndServeTLS(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+			return
+		}
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Infoln("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout.Std())
+	defer cancel()
+
+	err := httpServer.Shutdown(shutdownCtx)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err = <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
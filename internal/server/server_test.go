@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/apidoc"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testConfig включает все подсистемы, которые регистрируют маршруты. Адреса целей
+// и получателей недоступны: фоновые задачи в тестах не запускаются.
+const testConfig = `
+storage:
+  backend: memory
+limits:
+  max_body_bytes: 1024
+history:
+  rate_windows: [1m]
+scrape:
+  targets: ["127.0.0.1:1"]
+alerting:
+  rules_file: %s
+webhooks:
+  endpoints:
+    - url: http://127.0.0.1:1/hook
+      metrics: [none]
+remote_write:
+  url: http://127.0.0.1:1/api/v1/write
+graphite:
+  address: 127.0.0.1:0
+`
+
+// newTestApp создает приложение так же, как main, из конфигурации со всеми подсистемами,
+// и сохраняет метрики Alloc (gauge) и PollCount (counter).
+func newTestApp(t *testing.T) *App {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	rules := "rules:\n  - name: high_alloc\n    metric: Alloc\n    op: \">\"\n    threshold: 100\n"
+	require.NoError(t, os.WriteFile(rulesFile, []byte(rules), 0o600))
+	configFile := filepath.Join(dir, "server.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(testConfig, rulesFile)), 0o600))
+
+	cfg, err := config.LoadServerConfig([]string{"-c", configFile}, map[string]string{})
+	require.NoError(t, err)
+	app, err := NewApp(&cfg, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	t.Cleanup(app.Close)
+
+	alloc := 1.5
+	for _, delta := range []int64{3, 4} {
+		require.NoError(t, app.storage.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}))
+	}
+	require.NoError(t, app.storage.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &alloc}))
+	return app
+}
+
+// TestRoutesMatchSpec проверяет, что спецификация описывает ровно те маршруты,
+// которые регистрирует NewApp при всех включенных подсистемах.
+func TestRoutesMatchSpec(t *testing.T) {
+	spec, err := apidoc.Load()
+	require.NoError(t, err)
+
+	var routes []string
+	err = chi.Walk(newTestApp(t).server.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, spec.Operations(), routes)
+}
+
+// TestResponsesMatchSpec проверяет статусы, типы содержимого и тела ответов по спецификации.
+// Каждая операция спецификации должна быть покрыта хотя бы одним запросом.
+func TestResponsesMatchSpec(t *testing.T) {
+	spec, err := apidoc.Load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		method  string
+		pattern string // Маршрут, по которому операция описана в спецификации
+		target  string
+		body    string
+		accept  string
+		ctype   string
+		status  int
+		early   bool // Запрос отклоняется middleware до маршрутизации, без заголовков устаревшего маршрута
+		done    bool // Контекст запроса отменен заранее, чтобы поток завершился сразу
+	}{
+		{method: http.MethodGet, pattern: "/", target: "/", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/", target: "/", accept: "text/html", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/", target: "/?sort=value&limit=1", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/", target: "/?sort=size", status: http.StatusBadRequest},
+		{method: http.MethodGet, pattern: "/api/v1/metrics", target: "/api/v1/metrics", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/api/v1/metrics", target: "/api/v1/metrics?type=counter&prefix=Poll&regex=Count$&limit=5", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/api/v1/metrics", target: "/api/v1/metrics?limit=-1", status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/api/v1/metrics", target: "/api/v1/metrics", body: `[{"id":"a","type":"gauge","value":1}]`, status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/api/v1/metrics", target: "/api/v1/metrics", body: `[{"id":"a","type":"gauge"}]`, status: http.StatusBadRequest},
+		{method: http.MethodGet, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/counter/PollCount", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/gauge/PollCount", status: http.StatusNotFound},
+		{method: http.MethodPut, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/gauge/cpu", body: `{"value":0.5}`, status: http.StatusOK},
+		{method: http.MethodPut, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/counter/PollCount", body: `{"id":"PollCount","type":"counter","delta":2}`, status: http.StatusOK},
+		{method: http.MethodPut, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/gauge/cpu", body: `{"type":"counter","value":1}`, status: http.StatusBadRequest},
+		{method: http.MethodPut, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/timer/cpu", body: `{"value":1}`, status: http.StatusBadRequest},
+		{method: http.MethodPut, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/counter/Alloc", body: `{"delta":1}`, status: http.StatusConflict},
+		{method: http.MethodDelete, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/gauge/Alloc", status: http.StatusNoContent},
+		{method: http.MethodDelete, pattern: "/api/v1/metrics/{type}/{id}", target: "/api/v1/metrics/counter/Alloc", status: http.StatusNotFound},
+		{method: http.MethodPost, pattern: "/update/{type}/{id}/{value}", target: "/update/gauge/cpu/0.5", status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/update/{type}/{id}/{value}", target: "/update/timer/cpu/1", status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/update/{type}/{id}/{value}", target: "/update/counter/Alloc/1", status: http.StatusConflict},
+		{method: http.MethodPost, pattern: "/update/", target: "/update/", body: `{"id":"PollCount","type":"counter","delta":1}`, status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/update/", target: "/update/", body: `{"id":"cpu","type":"gauge"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/update/", target: "/update/", body: `{"id":"` + strings.Repeat("x", 2048) + `"}`, status: http.StatusRequestEntityTooLarge, early: true},
+		{method: http.MethodPost, pattern: "/updates/", target: "/updates/", body: `[{"id":"a","type":"gauge","value":1},{"id":"b","type":"counter","delta":2}]`, status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/updates/", target: "/updates/", body: `[{"id":"a","type":"gauge"},{"type":"counter","delta":2}]`, status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/updates/", target: "/updates/", body: `[{"id":"Alloc","type":"counter","delta":2}]`, status: http.StatusConflict},
+		{method: http.MethodPost, pattern: "/value", target: "/value", body: `{"id":"PollCount","type":"counter"}`, status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/value", target: "/value", body: `{"id":`, status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/value/", target: "/value/", body: `{"id":"Alloc","type":"gauge"}`, status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/value/", target: "/value/", body: `{"id":"missing","type":"gauge"}`, status: http.StatusNotFound},
+		{method: http.MethodGet, pattern: "/value/{type}/{id}", target: "/value/gauge/Alloc", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/value/{type}/{id}", target: "/value/counter/missing", status: http.StatusNotFound},
+		{method: http.MethodGet, pattern: "/openapi.json", target: "/openapi.json", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/docs", target: "/docs", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/query", target: "/query?expr=PollCount", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/query", target: "/query?expr=rate(", status: http.StatusBadRequest},
+		{method: http.MethodGet, pattern: "/stream", target: "/stream?type=counter", status: http.StatusOK, done: true},
+		{method: http.MethodGet, pattern: "/stream", target: "/stream?regex=(", status: http.StatusBadRequest},
+		{method: http.MethodGet, pattern: "/ws", target: "/ws", status: http.StatusBadRequest},
+		{method: http.MethodGet, pattern: "/targets", target: "/targets", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/alerts", target: "/alerts?state=firing", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/webhooks/deliveries", target: "/webhooks/deliveries", status: http.StatusOK},
+		{method: http.MethodGet, pattern: "/remote-write", target: "/remote-write", status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/write", target: "/write?precision=s", body: "cpu,host=a usage=0.5 1700000000", status: http.StatusNoContent},
+		{method: http.MethodPost, pattern: "/write", target: "/write", body: "cpu usage=", status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/v1/metrics", target: "/v1/metrics", body: `{"resourceMetrics":[]}`, ctype: "application/json", status: http.StatusOK},
+		{method: http.MethodPost, pattern: "/v1/metrics", target: "/v1/metrics", body: `{"resourceMetrics":`, ctype: "application/json", status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/v1/metrics", target: "/v1/metrics", body: "", ctype: "application/x-protobuf", status: http.StatusBadRequest},
+		{method: http.MethodPost, pattern: "/v1/metrics", target: "/v1/metrics", body: `{}`, ctype: "text/plain", status: http.StatusUnsupportedMediaType},
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target+" "+http.StatusText(tt.status), func(t *testing.T) {
+			h := newTestApp(t).Handler()
+
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			if tt.ctype != "" {
+				request.Header.Set("Content-Type", tt.ctype)
+			}
+			if tt.done {
+				ctx, cancel := context.WithCancel(request.Context())
+				cancel()
+				request = request.WithContext(ctx)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.status, res.StatusCode, string(body))
+			assert.NoError(t, spec.CheckResponse(tt.method, tt.pattern, res.StatusCode, res.Header.Get("Content-Type"), body))
+
+			op, ok := spec.Operation(tt.method, tt.pattern)
+			require.True(t, ok)
+			if op.Deprecated && !tt.early {
+				assert.Equal(t, "@1792368000", res.Header.Get("Deprecation"))
+				assert.Equal(t, `</api/v1/metrics>; rel="successor-version"`, res.Header.Get("Link"))
+			} else if !op.Deprecated {
+				assert.Empty(t, res.Header.Get("Deprecation"))
+			}
+		})
+		covered[tt.method+" "+tt.pattern] = true
+	}
+
+	for _, op := range spec.Operations() {
+		assert.True(t, covered[op], "operation %s is not covered by the contract test", op)
+	}
+}
+
+// TestCheckResponse проверяет, что расхождения с описанием ответа обнаруживаются.
+func TestCheckResponse(t *testing.T) {
+	spec, err := apidoc.Load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		pattern     string
+		status      int
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{name: "undocumented route", pattern: "/metrics", status: 200, contentType: "application/json", body: `[]`, wantErr: "is not documented"},
+		{name: "undocumented status", pattern: "/update/", status: 418, contentType: "application/json", body: `{}`, wantErr: "status 418 is not documented"},
+		{name: "undocumented content type", pattern: "/update/", status: 200, contentType: "text/plain", body: ``, wantErr: "Content-Type text/plain is not documented"},
+		{name: "missing property", pattern: "/update/", status: 200, contentType: "application/json", body: `{"id":"a"}`, wantErr: `required property "type" is missing`},
+		{name: "unexpected property", pattern: "/update/", status: 200, contentType: "application/json", body: `{"id":"a","type":"gauge","unit":"s"}`, wantErr: `unexpected property "unit"`},
+		{name: "wrong enum value", pattern: "/update/", status: 200, contentType: "application/json", body: `{"id":"a","type":"timer"}`, wantErr: `body.type: "timer" is not one of`},
+		{name: "fractional integer", pattern: "/update/", status: 200, contentType: "application/json", body: `{"id":"a","type":"counter","delta":1.5}`, wantErr: "body.delta: 1.5 is not an integer"},
+		{name: "unknown problem code", pattern: "/update/", status: 400, contentType: "application/problem+json", body: `{"type":"about:blank","title":"Bad Request","status":400,"code":"oops"}`, wantErr: `body.code: "oops"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := spec.CheckResponse(http.MethodPost, tt.pattern, tt.status, tt.contentType, []byte(tt.body))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -1,166 +1,336 @@
 // Package services содержит реализацию агента для сбора и отправки метрик на сервер.
-// Agent собирает метрики из runtime, добавляет случайную метрику и счетчик PollCount,
+// Agent собирает метрики из runtime через пакет collector, добавляет случайную метрику и счетчик PollCount,
 // и отправляет их на сервер через HTTP.
 
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
 	"math/rand"
 	"net/http"
-	"runtime"
+	"sync"
 	"time"
 
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/collector"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/statsd"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"go.uber.org/zap"
 )
 
 // Agent — структура агента, который собирает и отправляет метрики.
+//
+// Счетчики внутри агента хранятся как накопленные значения (Delta содержит итог с момента запуска).
+// При отправке агент передает только разницу с последним значением, которое подтвердил сервер.
 type Agent struct {
 	cfg       config.AgentConfig        // Конфигурация агента
+	collector collector.Collector       // Источник runtime-метрик
+	local     handler.Storager          // Метрики, принятые от приложений через локальный приемник
+	statsd    *statsd.Aggregator        // Значения StatsD за текущий интервал отправки, nil — прием выключен
+	client    *http.Client              // HTTP-клиент для отправки метрик
+	mu        sync.Mutex                // Защищает metrics и pollCount
 	metrics   map[string]models.Metrics // Собранные метрики
 	pollCount int64                     // Счетчик циклов сбора метрик
+	acked     map[string]int64          // Накопленные значения счетчиков, подтвержденные сервером
+	pending   *batch                    // Отправленный, но еще не подтвержденный пакет
+	logger    *zap.SugaredLogger        // Логгер
+	level     zap.AtomicLevel           // Уровень логирования, изменяемый при перечитывании конфигурации
+	reload    chan config.AgentConfig   // Новые конфигурации для применения в цикле Run
 }
 
 // NewAgentMetricService создает новый экземпляр агента с заданной конфигурацией.
+// При неизвестном режиме сбора runtime-метрик используется режим совместимости.
 func NewAgentMetricService(cfg config.AgentConfig) *Agent {
-	return &Agent{cfg: cfg, metrics: make(map[string]models.Metrics), pollCount: 0}
-}
-
-// GetMetric собирает метрики из runtime и формирует map метрик.
-// Добавляет случайную метрику RandomValue и счетчик PollCount.
-func (s *Agent) GetMetric() map[string]models.Metrics {
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-
-	// Преобразование различных метрик из runtime.MemStats в формат models.Metrics
-	alloc := float64(memStats.Alloc)
-	s.metrics["Alloc"] = models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &alloc}
-
-	buckHashSys := float64(memStats.Frees)
-	s.metrics["BuckHashSys"] = models.Metrics{ID: "BuckHashSys", MType: models.Gauge, Value: &buckHashSys}
-
-	frees := float64(memStats.Frees)
-	s.metrics["Frees"] = models.Metrics{ID: "Frees", MType: models.Gauge, Value: &frees}
-
-	gCCPUFraction := memStats.GCCPUFraction
-	s.metrics["GCCPUFraction"] = models.Metrics{ID: "GCCPUFraction", MType: models.Gauge, Value: &gCCPUFraction}
-
-	gCSys := float64(memStats.GCSys)
-	s.metrics["GCSys"] = models.Metrics{ID: "GCSys", MType: models.Gauge, Value: &gCSys}
-
-	heapAlloc := float64(memStats.HeapAlloc)
-	s.metrics["HeapAlloc"] = models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &heapAlloc}
-
-	heapIdle := float64(memStats.HeapIdle)
-	s.metrics["HeapIdle"] = models.Metrics{ID: "HeapIdle", MType: models.Gauge, Value: &heapIdle}
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		level.SetLevel(zap.InfoLevel)
+	}
+	logger := newLogger(level)
 
-	heapInuse := float64(memStats.HeapInuse)
-	s.metrics["HeapInuse"] = models.Metrics{ID: "HeapInuse", MType: models.Gauge, Value: &heapInuse}
+	c, err := collector.New(cfg.RuntimeMode)
+	if err != nil {
+		logger.Warnln(err)
+		c = collector.NewRuntime(true)
+	}
+	return &Agent{
+		cfg:       cfg,
+		collector: c,
+		local:     storage.NewMemStorage(),
+		client:    &http.Client{Timeout: requestTimeout},
+		metrics:   make(map[string]models.Metrics),
+		pollCount: 0,
+		acked:     make(map[string]int64),
+		logger:    logger,
+		level:     level,
+		reload:    make(chan config.AgentConfig),
+	}
+}
 
-	heapObjects := float64(memStats.HeapObjects)
-	s.metrics["HeapObjects"] = models.Metrics{ID: "HeapObjects", MType: models.Gauge, Value: &heapObjects}
+// newLogger создает логгер с изменяемым уровнем логирования.
+func newLogger(level zap.AtomicLevel) *zap.SugaredLogger {
+	zapCfg := zap.NewDevelopmentConfig()
+	zapCfg.Level = level
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return zap.NewNop().Sugar()
+	}
+	return logger.Sugar()
+}
 
-	heapReleased := float64(memStats.HeapReleased)
-	s.metrics["HeapReleased"] = models.Metrics{ID: "HeapReleased", MType: models.Gauge, Value: &heapReleased}
+// GetMetric собирает runtime-метрики через настроенный сборщик и возвращает копию map метрик.
+// Добавляет случайную метрику RandomValue и счетчик PollCount с числом выполненных циклов сбора.
+func (s *Agent) GetMetric() map[string]models.Metrics {
+	collected := s.collector.Collect()
 
-	heapSys := float64(memStats.HeapSys)
-	s.metrics["HeapSys"] = models.Metrics{ID: "HeapSys", MType: models.Gauge, Value: &heapSys}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	lastGC := float64(memStats.LastGC)
-	s.metrics["LastGC"] = models.Metrics{ID: "LastGC", MType: models.Gauge, Value: &lastGC}
+	for _, m := range collected {
+		s.metrics[m.ID] = m
+	}
 
-	lookups := float64(memStats.Lookups)
-	s.metrics["Lookups"] = models.Metrics{ID: "Lookups", MType: models.Gauge, Value: &lookups}
+	// Добавление случайной метрики
+	randomValue := rand.Float64()
+	s.metrics["RandomValue"] = models.Metrics{ID: "RandomValue", MType: models.Gauge, Value: &randomValue}
 
-	mCacheInuse := float64(memStats.MCacheInuse)
-	s.metrics["MCacheInuse"] = models.Metrics{ID: "MCacheInuse", MType: models.Gauge, Value: &mCacheInuse}
+	// Добавление счетчика PollCount
+	s.pollCount++
+	pollCount := s.pollCount
+	s.metrics["PollCount"] = models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &pollCount}
 
-	mCacheSys := float64(memStats.MCacheSys)
-	s.metrics["MCacheSys"] = models.Metrics{ID: "MCacheSys", MType: models.Gauge, Value: &mCacheSys}
+	return s.snapshot()
+}
 
-	mSpanInuse := float64(memStats.MSpanInuse)
-	s.metrics["MSpanInuse"] = models.Metrics{ID: "MSpanInuse", MType: models.Gauge, Value: &mSpanInuse}
+// snapshot возвращает копию собранных метрик. Вызывается под s.mu.
+func (s *Agent) snapshot() map[string]models.Metrics {
+	result := make(map[string]models.Metrics, len(s.metrics))
+	for id, m := range s.metrics {
+		result[id] = m
+	}
+	return result
+}
 
-	mSpanSys := float64(memStats.MSpanSys)
-	s.metrics["MSpanSys"] = models.Metrics{ID: "MSpanSys", MType: models.Gauge, Value: &mSpanSys}
+// current возвращает метрики для отправки: принятые от приложений и собственные метрики агента.
+// При совпадении идентификаторов приоритет у метрик агента.
+func (s *Agent) current() map[string]models.Metrics {
+	result := make(map[string]models.Metrics)
+	for _, m := range s.local.GetAll() {
+		result[m.ID] = m
+	}
 
-	mallocs := float64(memStats.Mallocs)
-	s.metrics["Mallocs"] = models.Metrics{ID: "Mallocs", MType: models.Gauge, Value: &mallocs}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, m := range s.metrics {
+		result[id] = m
+	}
+	return result
+}
 
-	nextGC := float64(memStats.NextGC)
-	s.metrics["NextGC"] = models.Metrics{ID: "NextGC", MType: models.Gauge, Value: &nextGC}
+// Report отправляет на сервер накопленные с последнего подтверждения изменения.
+// Сначала повторно отправляется неподтвержденный пакет с прежним ключом идемпотентности,
+// чтобы сервер мог отбросить дубль, и только после его подтверждения формируется новый пакет.
+// Значения StatsD, накопленные за интервал, перед этим переносятся в локальное хранилище.
+func (s *Agent) Report(ctx context.Context) error {
+	if s.pending != nil {
+		if err := s.deliver(ctx, s.pending); err != nil {
+			return err
+		}
+	}
 
-	numForcedGC := float64(memStats.NumForcedGC)
-	s.metrics["NumForcedGC"] = models.Metrics{ID: "NumForcedGC", MType: models.Gauge, Value: &numForcedGC}
+	s.flushStatsd()
 
-	numGC := float64(memStats.NumGC)
-	s.metrics["NumGC"] = models.Metrics{ID: "NumGC", MType: models.Gauge, Value: &numGC}
+	b, err := newBatch(s.current(), s.acked)
+	if err != nil {
+		return err
+	}
+	if len(b.Metrics) == 0 {
+		return nil
+	}
 
-	otherSys := float64(memStats.OtherSys)
-	s.metrics["OtherSys"] = models.Metrics{ID: "OtherSys", MType: models.Gauge, Value: &otherSys}
+	s.pending = b
+	return s.deliver(ctx, b)
+}
 
-	pauseTotalNs := float64(memStats.PauseTotalNs)
-	s.metrics["PauseTotalNs"] = models.Metrics{ID: "PauseTotalNs", MType: models.Gauge, Value: &pauseTotalNs}
+// flushStatsd переносит значения StatsD, накопленные за интервал, в локальное хранилище.
+func (s *Agent) flushStatsd() {
+	if s.statsd != nil {
+		s.statsd.Flush(s.local)
+	}
+}
 
-	stackInuse := float64(memStats.StackInuse)
-	s.metrics["StackInuse"] = models.Metrics{ID: "StackInuse", MType: models.Gauge, Value: &stackInuse}
+// deliver отправляет пакет и при успехе фиксирует подтвержденные значения счетчиков.
+// Если сервер отклонил пакет как некорректный, пакет отбрасывается, чтобы не блокировать отправку.
+func (s *Agent) deliver(ctx context.Context, b *batch) error {
+	err := s.send(ctx, b)
+	if err != nil && !isRejected(err) {
+		return err
+	}
 
-	stackSys := float64(memStats.StackSys)
-	s.metrics["StackSys"] = models.Metrics{ID: "StackSys", MType: models.Gauge, Value: &stackSys}
+	for id, total := range b.totals {
+		s.acked[id] = total
+	}
+	s.pending = nil
+	return err
+}
 
-	sys := float64(memStats.Sys)
-	s.metrics["Sys"] = models.Metrics{ID: "Sys", MType: models.Gauge, Value: &sys}
+// Run запускает два таймера и работает до отмены ctx:
+// - первый собирает метрики с заданным интервалом PollInterval,
+// - второй отправляет собранные изменения на сервер с интервалом ReportInterval.
+//
+// Если задан IngestAddress, агент принимает метрики приложений на локальном адресе,
+// а если задан StatsdAddress — метрики по протоколу StatsD, и отправляет их вместе со своими.
+//
+// В режиме pull агент ничего не отправляет сам, а отдает метрики на PullAddress;
+// по второму таймеру в этом режиме только переносятся значения StatsD.
+//
+// После отмены ctx агент в режиме push в последний раз собирает и отправляет метрики,
+// ограничивая финальную отправку таймаутом ShutdownTimeout.
+func (s *Agent) Run(ctx context.Context) error {
+	var ingest *Ingest
+	if s.cfg.IngestAddress != "" {
+		var err error
+		ingest, err = NewIngest(s.cfg.IngestAddress, s.local, s.logger)
+		if err != nil {
+			return err
+		}
+		if err = ingest.Start(); err != nil {
+			return err
+		}
+	}
 
-	totalAlloc := float64(memStats.TotalAlloc)
-	s.metrics["TotalAlloc"] = models.Metrics{ID: "TotalAlloc", MType: models.Gauge, Value: &totalAlloc}
+	var statsdServer *statsd.Server
+	if s.cfg.StatsdAddress != "" {
+		s.statsd = statsd.NewAggregator(s.logger)
+		statsdServer = statsd.NewServer(s.cfg.StatsdAddress, s.cfg.StatsdTCP, s.statsd, s.logger)
+		if err := statsdServer.Start(); err != nil {
+			return err
+		}
+	}
 
-	// Добавление случайной метрики
-	randomValue := rand.Float64()
-	s.metrics["RandomValue"] = models.Metrics{ID: "RandomValue", MType: models.Gauge, Value: &randomValue}
+	var exporter *Exporter
+	if s.cfg.Mode == config.ModePull {
+		exporter = NewExporter(s.cfg.PullAddress, s)
+		if err := exporter.Start(); err != nil {
+			return err
+		}
+	}
 
-	// Добавление счетчика PollCount
-	pollCount := s.pollCount
-	s.metrics["PollCount"] = models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &pollCount}
+	pollInterval := make(chan time.Duration)
+	go func(interval time.Duration) {
+		pollTicker := time.NewTicker(interval)
+		defer pollTicker.Stop()
+
+		for {
+			select {
+			case <-pollTicker.C:
+				s.GetMetric()
+			case interval = <-pollInterval:
+				pollTicker.Reset(interval)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(seconds(s.cfg.PollInterval))
+
+	reportTicker := time.NewTicker(seconds(s.cfg.ReportInterval))
+	defer reportTicker.Stop()
+
+	for {
+		select {
+		case <-reportTicker.C:
+			if exporter != nil {
+				s.flushStatsd()
+				continue
+			}
+			if err := s.Report(ctx); err != nil {
+				s.logger.Errorln("report failed", err)
+			}
+		case cfg := <-s.reload:
+			if cfg.PollInterval != s.cfg.PollInterval {
+				select {
+				case pollInterval <- seconds(cfg.PollInterval):
+				case <-ctx.Done():
+				}
+			}
+			if cfg.ReportInterval != s.cfg.ReportInterval {
+				reportTicker.Reset(seconds(cfg.ReportInterval))
+			}
+			s.applyConfig(cfg)
+		case <-ctx.Done():
+			if ingest != nil {
+				if err := ingest.Shutdown(seconds(s.cfg.ShutdownTimeout)); err != nil {
+					s.logger.Errorln(err)
+				}
+			}
+			if statsdServer != nil {
+				if err := statsdServer.Close(); err != nil {
+					s.logger.Errorln(err)
+				}
+			}
+			if exporter != nil {
+				if err := exporter.Shutdown(seconds(s.cfg.ShutdownTimeout)); err != nil {
+					s.logger.Errorln(err)
+				}
+				return nil
+			}
+			s.flush()
+			return nil
+		}
+	}
+}
 
-	s.pollCount++
-	return s.metrics
+// Reload передает агенту новую конфигурацию. Без перезапуска применяются интервалы
+// сбора и отправки, адрес сервера и уровень логирования; изменения остальных
+// параметров игнорируются с предупреждением.
+func (s *Agent) Reload(ctx context.Context, cfg config.AgentConfig) error {
+	select {
+	case s.reload <- cfg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// SendMetricByHTTP отправляет одну метрику на сервер через HTTP POST-запрос в формате JSON.
-func (s *Agent) SendMetricByHTTP(metric models.Metrics) {
-	uri := fmt.Sprintf("http://%s/update/", s.cfg.ServerAddress)
-	body, err := json.Marshal(metric)
-	if err != nil {
-		fmt.Println(err)
-		return
+// applyConfig сохраняет параметры, которые можно изменить без перезапуска. Вызывается из цикла Run.
+func (s *Agent) applyConfig(cfg config.AgentConfig) {
+	if cfg.RuntimeMode != s.cfg.RuntimeMode || cfg.IngestAddress != s.cfg.IngestAddress ||
+		cfg.StatsdAddress != s.cfg.StatsdAddress || cfg.StatsdTCP != s.cfg.StatsdTCP ||
+		cfg.ShutdownTimeout != s.cfg.ShutdownTimeout || cfg.Mode != s.cfg.Mode || cfg.PullAddress != s.cfg.PullAddress {
+		s.logger.Warnln("mode, runtime mode, listener addresses and shutdown timeout require restart, keeping previous values")
 	}
-	res, err := http.Post(uri, "Content-Type: application/json", bytes.NewBuffer(body))
-	if err != nil {
-		fmt.Println(err)
-		return
+
+	if err := s.level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		s.logger.Warnln("invalid log level", cfg.LogLevel)
 	}
-	defer res.Body.Close()
+	s.cfg.PollInterval = cfg.PollInterval
+	s.cfg.ReportInterval = cfg.ReportInterval
+	s.cfg.ServerAddress = cfg.ServerAddress
+	s.cfg.LogLevel = cfg.LogLevel
+	s.cfg.ConfigFile = cfg.ConfigFile
+
+	s.logger.Infoln(
+		"config reloaded",
+		"address", s.cfg.ServerAddress,
+		"poll_interval", s.cfg.PollInterval,
+		"report_interval", s.cfg.ReportInterval,
+		"log_level", s.cfg.LogLevel,
+	)
 }
 
-// Run запускает два таймера:
-// - первый собирает метрики с заданным интервалом PollInterval,
-// - второй отправляет все собранные метрики на сервер с интервалом ReportInterval.
-func (s *Agent) Run() {
-	var metrics map[string]models.Metrics
+// seconds переводит интервал из конфигурации в time.Duration.
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
 
-	go func() {
-		for range time.Tick(time.Duration(s.cfg.PollInterval) * time.Second) {
-			metrics = s.GetMetric()
-		}
-	}()
+// flush выполняет финальный сбор и отправку метрик при остановке агента.
+func (s *Agent) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(s.cfg.ShutdownTimeout))
+	defer cancel()
 
-	for range time.Tick(time.Duration(s.cfg.ReportInterval) * time.Second) {
-		for _, m := range metrics {
-			s.SendMetricByHTTP(m)
-			metrics = nil
-		}
+	s.GetMetric()
+	if err := s.Report(ctx); err != nil {
+		s.logger.Errorln("final report failed", err)
 	}
 }
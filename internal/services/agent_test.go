@@ -1,10 +1,18 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_GetMetrics(t *testing.T) {
@@ -34,3 +42,81 @@ func Test_GetMetrics(t *testing.T) {
 		}
 	})
 }
+
+func Test_ReportSendsDeltas(t *testing.T) {
+	old := retryDelays
+	retryDelays = nil
+	t.Cleanup(func() { retryDelays = old })
+
+	var (
+		mu       sync.Mutex
+		keys     []string
+		received []map[string]models.Metrics
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		byID := make(map[string]models.Metrics, len(batch))
+		for _, m := range batch {
+			byID[m.ID] = m
+		}
+		received = append(received, byID)
+	}))
+	defer srv.Close()
+
+	agent := NewAgentMetricService(config.AgentConfig{ServerAddress: strings.TrimPrefix(srv.URL, "http://")})
+
+	agent.GetMetric()
+	agent.GetMetric()
+	require.NoError(t, agent.Report(context.Background()))
+	assert.Equal(t, int64(2), *received[0]["PollCount"].Delta)
+
+	agent.GetMetric()
+	fail = true
+	require.Error(t, agent.Report(context.Background()))
+	fail = false
+
+	agent.GetMetric()
+	require.NoError(t, agent.Report(context.Background()))
+
+	// Неподтвержденный пакет повторяется с прежним ключом, затем отправляется новый.
+	require.Len(t, keys, 4)
+	assert.Equal(t, keys[1], keys[2])
+	assert.NotEqual(t, keys[2], keys[3])
+	require.Len(t, received, 3)
+	assert.Equal(t, int64(1), *received[1]["PollCount"].Delta)
+	assert.Equal(t, int64(1), *received[2]["PollCount"].Delta)
+}
+
+func Test_ServeMetrics(t *testing.T) {
+	agent := NewAgentMetricService(config.AgentConfig{Mode: config.ModePull, RuntimeMode: "memstats"})
+	agent.GetMetric()
+	agent.GetMetric()
+
+	srv := httptest.NewServer(http.HandlerFunc(agent.ServeMetrics))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var metrics []models.Metrics
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&metrics))
+
+	byID := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		byID[m.ID] = m
+	}
+	require.Contains(t, byID, "PollCount")
+	assert.Equal(t, int64(2), *byID["PollCount"].Delta, "counters are exposed as totals")
+	assert.Contains(t, byID, "Alloc")
+}
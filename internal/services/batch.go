@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/middleware"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// requestTimeout — таймаут одного HTTP-запроса к серверу.
+const requestTimeout = 5 * time.Second
+
+// retryDelays — паузы между повторными попытками отправки пакета.
+var retryDelays = []time.Duration{time.Second, 3 * time.Second, 5 * time.Second}
+
+// batch — пакет метрик для отправки на сервер.
+type batch struct {
+	Key     string           // Ключ идемпотентности, неизменный для всех повторов пакета
+	Metrics []models.Metrics // Gauge-значения и приращения счетчиков
+	totals  map[string]int64 // Накопленные значения счетчиков, которые станут подтвержденными после отправки
+}
+
+// rejectedError — ошибка, означающая, что сервер отклонил пакет и повторять его бессмысленно.
+type rejectedError struct {
+	status int
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("server rejected metrics batch with status %d", e.status)
+}
+
+// isRejected сообщает, что пакет был отклонен сервером как некорректный.
+func isRejected(err error) bool {
+	var rejected *rejectedError
+	return errors.As(err, &rejected)
+}
+
+// newBatch формирует пакет из текущих метрик.
+// Для счетчиков передается разница между накопленным значением и последним подтвержденным.
+// Если накопленное значение меньше подтвержденного, счетчик считается сброшенным
+// и передается целиком. Счетчики без изменений не отправляются.
+func newBatch(current map[string]models.Metrics, acked map[string]int64) (*batch, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &batch{Key: key, totals: make(map[string]int64)}
+	for id, m := range current {
+		if m.MType != models.Counter {
+			b.Metrics = append(b.Metrics, m)
+			continue
+		}
+		if m.Delta == nil {
+			continue
+		}
+
+		total := *m.Delta
+		prev, seen := acked[id]
+		delta := total - prev
+		if total < prev {
+			delta = total
+		}
+		if seen && delta == 0 {
+			continue
+		}
+
+		b.Metrics = append(b.Metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+		b.totals[id] = total
+	}
+	return b, nil
+}
+
+// newIdempotencyKey генерирует случайный ключ идемпотентности.
+func newIdempotencyKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// send отправляет пакет на сервер через POST /updates/.
+// Сетевые ошибки и ответы 5xx повторяются с паузами из retryDelays,
+// ответы 4xx возвращаются сразу как rejectedError.
+func (s *Agent) send(ctx context.Context, b *batch) error {
+	body, err := json.Marshal(b.Metrics)
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf("http://%s/updates/", s.cfg.ServerAddress)
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, uri, b.Key, body)
+		if err == nil || isRejected(err) || attempt >= len(retryDelays) {
+			return err
+		}
+		select {
+		case <-time.After(retryDelays[attempt]):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post выполняет один HTTP-запрос с пакетом метрик.
+func (s *Agent) post(ctx context.Context, uri, key string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyHeader, key)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 500:
+		return fmt.Errorf("server responded with status %d", res.StatusCode)
+	case res.StatusCode >= 400:
+		return &rejectedError{status: res.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// unixPrefix — префикс адреса приема, означающий Unix-сокет.
+const unixPrefix = "unix:"
+
+// Ingest — локальный HTTP-приемник метрик приложений.
+// Принимает тот же JSON, что и сервер на /update/ и /updates/, и агрегирует значения
+// в хранилище агента: счетчики суммируются, для gauge сохраняется последнее значение.
+type Ingest struct {
+	server  *http.Server
+	network string // tcp или unix
+	address string // host:port или путь к сокету
+	logger  *zap.SugaredLogger
+}
+
+// NewIngest создает приемник, который сохраняет метрики в storage.
+// Адрес задается как host:port с loopback-хостом или как unix:/path/to.sock.
+func NewIngest(address string, storage handler.Storager, logger *zap.SugaredLogger) (*Ingest, error) {
+	network, addr, err := parseIngestAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	h := handler.NewHandler(storage)
+	router := chi.NewRouter()
+	router.Post("/update/{type}/{id}/{value}", h.Update) // Обновить метрику через URL
+	router.Post("/update/", h.UpdateJSON)                // Обновить метрику через JSON
+	router.Post("/updates/", h.UpdatesJSON)              // Обновить пакет метрик через JSON
+
+	return &Ingest{
+		server:  &http.Server{Handler: router, ReadHeaderTimeout: requestTimeout},
+		network: network,
+		address: addr,
+		logger:  logger,
+	}, nil
+}
+
+// parseIngestAddress разбирает адрес приема и проверяет, что TCP-адрес доступен только локально.
+func parseIngestAddress(address string) (string, string, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		if path == "" {
+			return "", "", errors.New("ingest: empty unix socket path")
+		}
+		return "unix", path, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", fmt.Errorf("ingest: %w", err)
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("ingest: address %q is not a loopback address", address)
+		}
+	}
+	return "tcp", address, nil
+}
+
+// Start начинает прием соединений в отдельной горутине.
+// Оставшийся от предыдущего запуска файл Unix-сокета удаляется.
+func (i *Ingest) Start() error {
+	if i.network == "unix" {
+		if err := os.Remove(i.address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("ingest: %w", err)
+		}
+	}
+
+	listener, err := net.Listen(i.network, i.address)
+	if err != nil {
+		return fmt.Errorf("ingest: %w", err)
+	}
+
+	go func() {
+		if err := i.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			i.logger.Errorln("ingest server stopped", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown прекращает прием и дожидается завершения обрабатываемых запросов,
+// чтобы принятые значения попали в финальную отправку.
+func (i *Ingest) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return i.server.Shutdown(ctx)
+}
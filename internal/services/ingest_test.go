@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseIngestAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		wantErr bool
+	}{
+		{address: "localhost:8081", network: "tcp"},
+		{address: "127.0.0.1:8081", network: "tcp"},
+		{address: "[::1]:8081", network: "tcp"},
+		{address: "unix:/tmp/agent.sock", network: "unix"},
+		{address: "0.0.0.0:8081", wantErr: true},
+		{address: ":8081", wantErr: true},
+		{address: "unix:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			network, _, err := parseIngestAddress(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.network, network)
+		})
+	}
+}
+
+func Test_IngestForwardsAggregatedMetrics(t *testing.T) {
+	old := retryDelays
+	retryDelays = nil
+	t.Cleanup(func() { retryDelays = old })
+
+	received := make(map[string]models.Metrics)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		for _, m := range batch {
+			received[m.ID] = m
+		}
+	}))
+	defer srv.Close()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	agent := NewAgentMetricService(config.AgentConfig{ServerAddress: strings.TrimPrefix(srv.URL, "http://")})
+	ingest, err := NewIngest("unix:"+socket, agent.local, agent.logger)
+	require.NoError(t, err)
+	require.NoError(t, ingest.Start())
+	defer ingest.Shutdown(time.Second)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	for _, body := range []string{
+		`{"id":"orders","type":"counter","delta":2}`,
+		`{"id":"orders","type":"counter","delta":3}`,
+		`{"id":"queue","type":"gauge","value":1.5}`,
+		`{"id":"queue","type":"gauge","value":4}`,
+	} {
+		res, err := client.Post("http://agent/update/", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	require.NoError(t, agent.Report(context.Background()))
+	assert.Equal(t, int64(5), *received["orders"].Delta)
+	assert.Equal(t, 4.0, *received["queue"].Value)
+}
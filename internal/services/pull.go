@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// MetricsPath — путь, по которому агент в режиме pull отдает метрики.
+const MetricsPath = "/metrics"
+
+// Exporter отдает последние собранные агентом метрики по HTTP для сервера в режиме pull.
+// Ответ — JSON-массив в формате /updates/, счетчики содержат накопленные значения
+// с момента запуска агента, а приращения вычисляет сервер.
+type Exporter struct {
+	server  *http.Server
+	address string
+	logger  *zap.SugaredLogger
+}
+
+// NewExporter создает HTTP-сервер, который отдает метрики агента на GET /metrics.
+// Ошибки сервера записываются в лог агента.
+func NewExporter(address string, agent *Agent) *Exporter {
+	router := chi.NewRouter()
+	router.Get(MetricsPath, agent.ServeMetrics)
+
+	return &Exporter{
+		server:  &http.Server{Handler: router, ReadHeaderTimeout: requestTimeout},
+		address: address,
+		logger:  agent.logger,
+	}
+}
+
+// Start начинает прием соединений в отдельной горутине.
+func (e *Exporter) Start() error {
+	listener, err := net.Listen("tcp", e.address)
+	if err != nil {
+		return fmt.Errorf("exporter: %w", err)
+	}
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.Errorln("exporter server stopped", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown прекращает прием и дожидается завершения обрабатываемых запросов.
+func (e *Exporter) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
+
+// ServeMetrics — HTTP-обработчик, который отдает текущие метрики агента, отсортированные по ID.
+func (s *Agent) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	current := s.current()
+	metrics := make([]models.Metrics, 0, len(current))
+	for _, m := range current {
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].ID < metrics[j].ID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(metrics); err != nil {
+		s.logger.Errorln("failed to write metrics", err)
+	}
+}
@@ -0,0 +1,175 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Saver — приемник агрегированных метрик, например локальное хранилище агента.
+type Saver interface {
+	Save(metric models.Metrics) error
+}
+
+// timerQuantiles — квантили, которые публикуются для таймеров, гистограмм и распределений.
+var timerQuantiles = []struct {
+	suffix string
+	q      float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// timer — значения таймера за интервал и их число с учетом частоты семплирования.
+type timer struct {
+	name   string
+	tags   map[string]string
+	values []float64
+	count  float64
+}
+
+// Aggregator накапливает значения StatsD за интервал отправки.
+//
+// Правила преобразования при сбросе:
+//   - counter — counter с суммой значений, деленных на частоту семплирования;
+//   - gauge — gauge с последним значением (значения со знаком изменяют текущее);
+//   - ms, h, d — counter name_count и gauge name_min, name_max, name_mean, name_p50, name_p90, name_p99;
+//   - set — gauge с числом уникальных элементов за интервал.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	dirty    map[string]bool // gauge, изменившиеся за интервал
+	timers   map[string]*timer
+	sets     map[string]map[string]struct{}
+	logger   *zap.SugaredLogger
+}
+
+// NewAggregator создает пустой агрегатор. Ошибки сохранения при сбросе пишутся в logger.
+func NewAggregator(logger *zap.SugaredLogger) *Aggregator {
+	a := &Aggregator{gauges: make(map[string]float64), logger: logger}
+	a.reset()
+	return a
+}
+
+// reset очищает значения, накопленные за интервал. Gauge сохраняются между интервалами,
+// чтобы относительные изменения применялись к последнему известному значению.
+func (a *Aggregator) reset() {
+	a.counters = make(map[string]float64)
+	a.dirty = make(map[string]bool)
+	a.timers = make(map[string]*timer)
+	a.sets = make(map[string]map[string]struct{})
+}
+
+// Add учитывает значение в текущем интервале.
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		id := models.TaggedID(s.Name, s.Tags)
+		a.counters[id] += s.Value / s.SampleRate
+	case TypeGauge:
+		id := models.TaggedID(s.Name, s.Tags)
+		if s.Relative {
+			a.gauges[id] += s.Value
+		} else {
+			a.gauges[id] = s.Value
+		}
+		a.dirty[id] = true
+	case TypeTimer, TypeHistogram, TypeDistrib:
+		id := models.TaggedID(s.Name, s.Tags)
+		t, ok := a.timers[id]
+		if !ok {
+			t = &timer{name: s.Name, tags: s.Tags}
+			a.timers[id] = t
+		}
+		t.values = append(t.values, s.Value)
+		t.count += 1 / s.SampleRate
+	case TypeSet:
+		id := models.TaggedID(s.Name, s.Tags)
+		if a.sets[id] == nil {
+			a.sets[id] = make(map[string]struct{})
+		}
+		a.sets[id][s.Raw] = struct{}{}
+	}
+}
+
+// Flush передает в dst метрики, накопленные за интервал, и начинает новый интервал.
+// Дробная часть счетчиков, возникшая из-за семплирования, переносится в следующий интервал.
+// Метрика, которую dst отклонил (например, из-за конфликта типов), пропускается с записью
+// в лог, остальные метрики интервала сохраняются.
+func (a *Aggregator) Flush(dst Saver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var metrics []models.Metrics
+	carry := make(map[string]float64)
+	for id, sum := range a.counters {
+		delta := math.Trunc(sum)
+		if rest := sum - delta; rest != 0 {
+			carry[id] = rest
+		}
+		if delta != 0 {
+			metrics = append(metrics, counter(id, int64(delta)))
+		}
+	}
+	for id := range a.dirty {
+		metrics = append(metrics, gauge(id, a.gauges[id]))
+	}
+	for _, t := range a.timers {
+		metrics = append(metrics, t.metrics()...)
+	}
+	for id, set := range a.sets {
+		metrics = append(metrics, gauge(id, float64(len(set))))
+	}
+
+	a.reset()
+	a.counters = carry
+
+	for _, m := range metrics {
+		if err := dst.Save(m); err != nil {
+			a.logger.Warnln("statsd: metric dropped", m.ID, err)
+		}
+	}
+}
+
+// metrics вычисляет статистики таймера за интервал.
+func (t *timer) metrics() []models.Metrics {
+	sort.Float64s(t.values)
+
+	var sum float64
+	for _, v := range t.values {
+		sum += v
+	}
+
+	id := func(suffix string) string {
+		return models.TaggedID(t.name+suffix, t.tags)
+	}
+	result := []models.Metrics{
+		counter(id("_count"), int64(math.Round(t.count))),
+		gauge(id("_min"), t.values[0]),
+		gauge(id("_max"), t.values[len(t.values)-1]),
+		gauge(id("_mean"), sum/float64(len(t.values))),
+	}
+	for _, q := range timerQuantiles {
+		idx := int(math.Ceil(q.q*float64(len(t.values)))) - 1
+		result = append(result, gauge(id(q.suffix), t.values[max(idx, 0)]))
+	}
+	return result
+}
+
+// gauge создает метрику типа gauge.
+func gauge(id string, value float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &value}
+}
+
+// counter создает метрику типа counter.
+func counter(id string, delta int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &delta}
+}
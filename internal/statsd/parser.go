@@ -0,0 +1,118 @@
+// Package statsd реализует прием метрик по протоколу StatsD (с тегами в стиле DogStatsD),
+// их агрегацию за интервал отправки и преобразование в формат models.Metrics.
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Типы метрик StatsD.
+const (
+	TypeCounter   = "c"
+	TypeGauge     = "g"
+	TypeTimer     = "ms"
+	TypeHistogram = "h"
+	TypeDistrib   = "d"
+	TypeSet       = "s"
+)
+
+// Sample — одно значение, разобранное из строки протокола StatsD.
+type Sample struct {
+	Name       string            // Имя метрики
+	Type       string            // Тип метрики: c, g, ms, h, d или s
+	Value      float64           // Числовое значение (для set не используется)
+	Raw        string            // Исходное значение (для set — элемент множества)
+	Relative   bool              // Для gauge: значение со знаком изменяет текущее, а не заменяет его
+	SampleRate float64           // Частота семплирования из секции @rate, по умолчанию 1
+	Tags       map[string]string // Теги из секции #tag:value,...
+}
+
+// ParseLine разбирает строку формата name:value|type[|@rate][|#tag:value,...].
+// Неизвестные секции (например, |c:container или |T timestamp) игнорируются.
+func ParseLine(line string) (Sample, error) {
+	nameValue, rest, ok := strings.Cut(line, "|")
+	if !ok {
+		return Sample{}, fmt.Errorf("statsd: missing type in %q", line)
+	}
+	name, value, ok := strings.Cut(nameValue, ":")
+	if !ok {
+		return Sample{}, fmt.Errorf("statsd: missing value in %q", line)
+	}
+
+	name = sanitize(name)
+	if name == "" {
+		return Sample{}, fmt.Errorf("statsd: empty metric name in %q", line)
+	}
+
+	sections := strings.Split(rest, "|")
+	s := Sample{Name: name, Type: sections[0], Raw: value, SampleRate: 1}
+
+	for _, section := range sections[1:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("statsd: invalid sample rate %q", section)
+			}
+			s.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			s.Tags = parseTags(section[1:])
+		}
+	}
+
+	switch s.Type {
+	case TypeSet:
+		if value == "" {
+			return Sample{}, errors.New("statsd: empty set value")
+		}
+		return s, nil
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistrib:
+	default:
+		return Sample{}, fmt.Errorf("statsd: unknown metric type %q", s.Type)
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf("statsd: invalid value %q", value)
+	}
+	s.Value = v
+	s.Relative = s.Type == TypeGauge && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-"))
+	return s, nil
+}
+
+// parseTags разбирает теги DogStatsD вида key:value,key2:value2,flag.
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw, ",") {
+		k, v, _ := strings.Cut(tag, ":")
+		k = sanitize(k)
+		if k == "" {
+			continue
+		}
+		tags[k] = sanitize(v)
+	}
+	return tags
+}
+
+// sanitize приводит имя к допустимому набору символов так же, как это делает
+// эталонный сервер StatsD: пробелы заменяются на _, слеши на -,
+// остальные символы кроме букв, цифр, _, - и . удаляются.
+func sanitize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == ' ':
+			b.WriteByte('_')
+		case r == '/':
+			b.WriteByte('-')
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
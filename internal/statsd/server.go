@@ -0,0 +1,164 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// maxPacketSize — максимальный размер UDP-пакета StatsD.
+const maxPacketSize = 65535
+
+// Server принимает строки протокола StatsD по UDP и, опционально, по TCP
+// и передает разобранные значения в Aggregator.
+type Server struct {
+	address    string
+	tcp        bool
+	aggregator *Aggregator
+	packetConn net.PacketConn
+	listener   net.Listener
+	logger     *zap.SugaredLogger
+	wg         sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Открытые TCP-соединения, закрываются при остановке
+	closed bool
+}
+
+// NewServer создает сервер StatsD на адресе address. Если tcp равен true,
+// на том же адресе дополнительно принимаются TCP-соединения.
+func NewServer(address string, tcp bool, aggregator *Aggregator, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		address:    address,
+		tcp:        tcp,
+		aggregator: aggregator,
+		logger:     logger,
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+// Start открывает сокеты и начинает прием в отдельных горутинах.
+func (s *Server) Start() error {
+	packetConn, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	s.packetConn = packetConn
+
+	s.wg.Add(1)
+	go s.serveUDP()
+
+	if s.tcp {
+		listener, err := net.Listen("tcp", s.address)
+		if err != nil {
+			_ = packetConn.Close()
+			return fmt.Errorf("statsd: %w", err)
+		}
+		s.listener = listener
+
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+	return nil
+}
+
+// Close закрывает сокеты и соединения и дожидается завершения горутин приема.
+func (s *Server) Close() error {
+	var errs []error
+	if s.packetConn != nil {
+		errs = append(errs, s.packetConn.Close())
+	}
+	if s.listener != nil {
+		errs = append(errs, s.listener.Close())
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// serveUDP читает пакеты, каждый из которых может содержать несколько строк.
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Errorln("statsd udp", err)
+			}
+			return
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			s.handleLine(string(line))
+		}
+	}
+}
+
+// serveTCP принимает соединения, в которых строки разделены переводом строки.
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Errorln("statsd tcp", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				s.handleLine(scanner.Text())
+			}
+		}()
+	}
+}
+
+// handleLine разбирает строку и добавляет значение в агрегатор. Некорректные строки пропускаются.
+func (s *Server) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	sample, err := ParseLine(line)
+	if err != nil {
+		s.logger.Warnw("invalid statsd line", "error", err)
+		return
+	}
+	s.aggregator.Add(sample)
+}
@@ -0,0 +1,149 @@
+package statsd
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testSaver map[string]models.Metrics
+
+func (s testSaver) Save(m models.Metrics) error {
+	if stored, ok := s[m.ID]; ok && stored.MType != m.MType {
+		return errors.New("type conflict")
+	}
+	s[m.ID] = m
+	return nil
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "page.views:1|c",
+			want: Sample{Name: "page.views", Type: TypeCounter, Value: 1, Raw: "1", SampleRate: 1},
+		},
+		{
+			name: "sampled counter with tags",
+			line: "requests:3|c|@0.5|#env:prod,canary",
+			want: Sample{Name: "requests", Type: TypeCounter, Value: 3, Raw: "3", SampleRate: 0.5,
+				Tags: map[string]string{"env": "prod", "canary": ""}},
+		},
+		{
+			name: "relative gauge",
+			line: "queue.size:-2|g",
+			want: Sample{Name: "queue.size", Type: TypeGauge, Value: -2, Raw: "-2", Relative: true, SampleRate: 1},
+		},
+		{
+			name: "timer with unknown section",
+			line: "db query:120|ms|T1656581400",
+			want: Sample{Name: "db_query", Type: TypeTimer, Value: 120, Raw: "120", SampleRate: 1},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: Sample{Name: "users", Type: TypeSet, Raw: "alice", SampleRate: 1},
+		},
+		{name: "no type", line: "requests:3", wantErr: true},
+		{name: "no value", line: "requests|c", wantErr: true},
+		{name: "bad value", line: "requests:x|c", wantErr: true},
+		{name: "bad rate", line: "requests:1|c|@2", wantErr: true},
+		{name: "unknown type", line: "requests:1|x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	a := NewAggregator(zap.NewNop().Sugar())
+	for _, line := range []string{
+		"requests:1|c|@0.4",
+		"requests:1|c|#env:prod",
+		"queue:10|g",
+		"queue:+5|g",
+		"latency:10|ms",
+		"latency:30|ms|@0.5",
+		"latency:20|ms",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	} {
+		s, err := ParseLine(line)
+		require.NoError(t, err)
+		a.Add(s)
+	}
+
+	got := testSaver{}
+	a.Flush(got)
+
+	assert.Equal(t, int64(2), *got["requests"].Delta)
+	assert.Equal(t, int64(1), *got["requests;env=prod"].Delta)
+	assert.Equal(t, 15.0, *got["queue"].Value)
+	assert.Equal(t, int64(4), *got["latency_count"].Delta)
+	assert.Equal(t, 10.0, *got["latency_min"].Value)
+	assert.Equal(t, 30.0, *got["latency_max"].Value)
+	assert.Equal(t, 20.0, *got["latency_mean"].Value)
+	assert.Equal(t, 20.0, *got["latency_p50"].Value)
+	assert.Equal(t, 2.0, *got["users"].Value)
+
+	// Дробная часть счетчика переносится, неизменившиеся gauge не отправляются повторно.
+	s, _ := ParseLine("requests:1|c|@0.2")
+	a.Add(s)
+	got = testSaver{}
+	a.Flush(got)
+	assert.Equal(t, int64(5), *got["requests"].Delta)
+	assert.NotContains(t, got, "queue")
+
+	// Метрика с конфликтом типов пропускается, остальные сохраняются.
+	for _, line := range []string{"queue:1|c", "users:carol|s", "errors:2|c"} {
+		s, _ = ParseLine(line)
+		a.Add(s)
+	}
+	got = testSaver{"queue": gauge("queue", 15)}
+	a.Flush(got)
+	assert.Equal(t, 1.0, *got["users"].Value)
+	assert.Equal(t, int64(2), *got["errors"].Delta)
+	assert.Equal(t, models.Gauge, got["queue"].MType)
+}
+
+func TestServer_CloseWithOpenConnection(t *testing.T) {
+	a := NewAggregator(zap.NewNop().Sugar())
+	srv := NewServer("127.0.0.1:0", true, a, zap.NewNop().Sugar())
+	require.NoError(t, srv.Start())
+
+	conn, err := net.Dial("tcp", srv.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("requests:3|c\nbad line\n"))
+	require.NoError(t, err)
+
+	got := testSaver{}
+	assert.Eventually(t, func() bool {
+		a.Flush(got)
+		return len(got) > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), *got["requests"].Delta)
+
+	// Close не ждет, пока клиент закроет соединение
+	require.NoError(t, srv.Close())
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// FileStorage хранит метрики в памяти и сохраняет их в JSON-файл:
+// периодически с интервалом interval или, если интервал нулевой, после каждого изменения.
+// При закрытии метрики сохраняются в последний раз.
+type FileStorage struct {
+	*MemStorage
+	path     string
+	interval time.Duration
+
+	saveMu sync.Mutex // Не дает двум сохранениям писать файл одновременно
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewFileStorage создает хранилище с файлом path. Если restore — true, метрики загружаются
+// из файла; отсутствие файла не считается ошибкой.
+func NewFileStorage(path string, interval time.Duration, restore bool) (*FileStorage, error) {
+	s := &FileStorage{
+		MemStorage: &MemStorage{metrics: make(map[string]models.Metrics)},
+		path:       path,
+		interval:   interval,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if restore {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	go s.loop()
+	return s, nil
+}
+
+// Save сохраняет метрику и, если интервал сохранения нулевой, сразу записывает файл.
+// Ошибка записи файла не возвращается: метрика уже сохранена в памяти, и повтор запроса
+// учел бы счетчик дважды. Файл будет перезаписан при следующем изменении или при Close.
+func (s *FileStorage) Save(metric models.Metrics) error {
+	if err := s.MemStorage.Save(metric); err != nil {
+		return err
+	}
+	s.dumpNow()
+	return nil
+}
+
+// SaveBatch сохраняет пакет метрик и, если интервал сохранения нулевой, сразу записывает файл.
+// Как и в Save, ошибка записи файла не возвращается.
+func (s *FileStorage) SaveBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	stored, err := s.MemStorage.SaveBatch(metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.dumpNow()
+	return stored, nil
+}
+
+// Delete удаляет метрику и, если интервал сохранения нулевой, сразу записывает файл.
+func (s *FileStorage) Delete(mType, id string) (bool, error) {
+	deleted, err := s.MemStorage.Delete(mType, id)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	s.dumpNow()
+	return true, nil
+}
+
+// dumpNow записывает файл после изменения, если интервал сохранения нулевой.
+func (s *FileStorage) dumpNow() {
+	if s.interval == 0 {
+		_ = s.dump() // Ошибка повторится при следующем изменении или при Close
+	}
+}
+
+// Close останавливает периодическое сохранение и записывает метрики в файл.
+func (s *FileStorage) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.dump()
+}
+
+// loop периодически записывает метрики в файл до вызова Close.
+func (s *FileStorage) loop() {
+	defer close(s.done)
+	if s.interval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.dump() // Ошибка повторится при следующем сохранении или при Close
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// load загружает метрики из файла. Каждая метрика проверяется models.Metrics.Validate:
+// поврежденный или отредактированный вручную файл не должен привести к панике при следующем
+// сохранении, поэтому некорректная запись прерывает запуск с указанием файла и записи.
+func (s *FileStorage) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var metrics []models.Metrics
+	if err = json.Unmarshal(data, &metrics); err != nil {
+		return fmt.Errorf("restore %s: %w", s.path, err)
+	}
+	for i, m := range metrics {
+		if err = m.Validate(); err != nil {
+			return fmt.Errorf("restore %s: entry %d (id %q): %w", s.path, i, m.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		s.metrics[m.ID] = m
+	}
+	return nil
+}
+
+// dump записывает метрики во временный файл и переименовывает его,
+// чтобы при сбое не оставить файл записанным наполовину.
+func (s *FileStorage) dump() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	data, err := json.Marshal(s.GetAll())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Restore(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{name: "sync store", interval: 0},
+		{name: "periodic store", interval: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			value, delta := 1.5, int64(3)
+
+			s, err := NewFileStorage(path, tt.interval, true)
+			require.NoError(t, err)
+			require.NoError(t, s.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+			require.NoError(t, s.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}))
+			require.NoError(t, s.Close())
+
+			restored, err := NewFileStorage(path, 0, true)
+			require.NoError(t, err)
+			defer restored.Close()
+
+			assert.ElementsMatch(t, s.GetAll(), restored.GetAll())
+
+			require.NoError(t, restored.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}))
+			m, ok := restored.Get(models.Counter, "PollCount")
+			require.True(t, ok)
+			assert.Equal(t, int64(6), *m.Delta)
+		})
+	}
+}
+
+func TestFileStorage_Delete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	value := 1.5
+
+	s, err := NewFileStorage(path, 0, true)
+	require.NoError(t, err)
+	require.NoError(t, s.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+
+	deleted, err := s.Delete(models.Counter, "Alloc")
+	require.NoError(t, err)
+	assert.False(t, deleted, "type must match")
+
+	deleted, err = s.Delete(models.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	restored, err := NewFileStorage(path, 0, true)
+	require.NoError(t, err)
+	defer restored.Close()
+	assert.Empty(t, restored.GetAll(), "file is written after delete")
+	require.NoError(t, s.Close())
+}
+
+func TestFileStorage_RestoreRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "counter without delta", data: `[{"id":"PollCount","type":"counter"}]`, wantErr: `entry 0 (id "PollCount")`},
+		{name: "unknown type", data: `[{"id":"a","type":"gauge","value":1},{"id":"b","type":"timer"}]`, wantErr: `entry 1 (id "b")`},
+		{name: "malformed json", data: `[{"id":`, wantErr: "metrics.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+
+			_, err := NewFileStorage(path, 0, true)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), path)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Sample — значение метрики в момент времени. Для counter хранится итоговое значение счетчика.
+type Sample struct {
+	T time.Time
+	V float64
+}
+
+// Series — значения одной метрики, упорядоченные по времени.
+type Series struct {
+	ID      string
+	MType   string
+	Samples []Sample
+}
+
+// History хранит в памяти значения метрик с метками времени.
+// Значения старше retention и сверх maxSamples на метрику отбрасываются.
+type History struct {
+	retention  time.Duration
+	maxSamples int
+	now        func() time.Time
+
+	mu     sync.RWMutex
+	series map[string]*Series
+}
+
+// NewHistory создает историю с заданным сроком хранения и числом значений на метрику.
+func NewHistory(retention time.Duration, maxSamples int) *History {
+	return &History{
+		retention:  retention,
+		maxSamples: maxSamples,
+		now:        time.Now,
+		series:     make(map[string]*Series),
+	}
+}
+
+// Observe записывает значение метрики с текущим временем. Подходит как Observer для Observable.
+func (h *History) Observe(metric models.Metrics) {
+	h.Record(metric, h.now())
+}
+
+// Record записывает значение метрики в момент t. Значения, которые старше последнего
+// записанного, игнорируются. При смене типа метрики прежняя история удаляется.
+func (h *History) Record(metric models.Metrics, t time.Time) {
+	v, ok := sampleValue(metric)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[metric.ID]
+	if !ok || s.MType != metric.MType {
+		s = &Series{ID: metric.ID, MType: metric.MType}
+		h.series[metric.ID] = s
+	}
+	if n := len(s.Samples); n > 0 && t.Before(s.Samples[n-1].T) {
+		return
+	}
+	s.Samples = append(s.Samples, Sample{T: t, V: v})
+
+	// Удаляем устаревшие значения и значения сверх лимита
+	cutoff := t.Add(-h.retention)
+	drop := sort.Search(len(s.Samples), func(i int) bool { return !s.Samples[i].T.Before(cutoff) })
+	if extra := len(s.Samples) - drop - h.maxSamples; extra > 0 {
+		drop += extra
+	}
+	if drop > 0 {
+		s.Samples = append(s.Samples[:0], s.Samples[drop:]...)
+	}
+}
+
+// Delete удаляет историю метрики. Подходит как DeleteObserver для Observable:
+// значения удаленной метрики больше не попадают в запросы, а сохранение метрики
+// с тем же ID начинает историю заново.
+func (h *History) Delete(mType, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.series[id]; ok && s.MType == mType {
+		delete(h.series, id)
+	}
+}
+
+// Select возвращает значения метрик, для которых match возвращает true,
+// в интервале (from, to]. Метрики без значений в интервале не возвращаются.
+// Результат отсортирован по ID.
+func (h *History) Select(match func(id, mType string) bool, from, to time.Time) []Series {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var result []Series
+	for _, s := range h.series {
+		if !match(s.ID, s.MType) {
+			continue
+		}
+		lo := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].T.After(from) })
+		hi := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].T.After(to) })
+		if lo >= hi {
+			continue
+		}
+		samples := make([]Sample, hi-lo)
+		copy(samples, s.Samples[lo:hi])
+		result = append(result, Series{ID: s.ID, MType: s.MType, Samples: samples})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Last возвращает не больше n последних значений метрики.
+func (h *History) Last(id, mType string, n int) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	s, ok := h.series[id]
+	if !ok || s.MType != mType {
+		return nil
+	}
+	samples := s.Samples[max(0, len(s.Samples)-n):]
+	return append([]Sample(nil), samples...)
+}
+
+// Increase возвращает прирост счетчика по значениям samples. Как и в Prometheus, уменьшение
+// значения считается сбросом счетчика: после сброса прирост отсчитывается от нуля.
+// Для вычисления нужно хотя бы два значения; экстраполяция на границы интервала не выполняется.
+func Increase(samples []Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	var result float64
+	for i := 1; i < len(samples); i++ {
+		d := samples[i].V - samples[i-1].V
+		if d < 0 {
+			d = samples[i].V
+		}
+		result += d
+	}
+	return result, true
+}
+
+// Rate возвращает средний прирост счетчика в секунду между первым и последним значением samples.
+func Rate(samples []Sample) (float64, bool) {
+	inc, ok := Increase(samples)
+	if !ok {
+		return 0, false
+	}
+	seconds := samples[len(samples)-1].T.Sub(samples[0].T).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	return inc / seconds, true
+}
+
+// sampleValue возвращает значение метрики как число.
+func sampleValue(metric models.Metrics) (float64, bool) {
+	switch {
+	case metric.MType == models.Gauge && metric.Value != nil:
+		return *metric.Value, true
+	case metric.MType == models.Counter && metric.Delta != nil:
+		return float64(*metric.Delta), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	gauge := func(v float64) models.Metrics { return models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &v} }
+	all := func(string, string) bool { return true }
+
+	tests := []struct {
+		name       string
+		retention  time.Duration
+		maxSamples int
+		want       []float64
+	}{
+		{name: "keeps samples within retention", retention: time.Hour, maxSamples: 100, want: []float64{0, 1, 2, 3, 4}},
+		{name: "drops samples older than retention", retention: 25 * time.Second, maxSamples: 100, want: []float64{2, 3, 4}},
+		{name: "drops samples over limit", retention: time.Hour, maxSamples: 2, want: []float64{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistory(tt.retention, tt.maxSamples)
+			for i := 0; i < 5; i++ {
+				h.Record(gauge(float64(i)), start.Add(time.Duration(i)*10*time.Second))
+			}
+			h.Record(gauge(100), start) // Значение из прошлого игнорируется
+
+			series := h.Select(all, start.Add(-time.Second), start.Add(time.Minute))
+			require.Len(t, series, 1)
+			var got []float64
+			for _, s := range series[0].Samples {
+				got = append(got, s.V)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHistory_Select(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	h := NewHistory(time.Hour, 100)
+	for i := int64(1); i <= 3; i++ {
+		v, d := float64(i), i
+		ts := start.Add(time.Duration(i) * time.Minute)
+		h.Record(models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Value: &v}, ts)
+		h.Record(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &d}, ts)
+	}
+
+	counters := func(_, mType string) bool { return mType == models.Counter }
+	series := h.Select(counters, start.Add(time.Minute), start.Add(3*time.Minute))
+	require.Len(t, series, 1)
+	assert.Equal(t, "PollCount", series[0].ID)
+	assert.Equal(t, []Sample{{T: start.Add(2 * time.Minute), V: 2}, {T: start.Add(3 * time.Minute), V: 3}}, series[0].Samples,
+		"interval excludes its start")
+
+	all := func(string, string) bool { return true }
+	assert.Empty(t, h.Select(all, start.Add(3*time.Minute), start.Add(time.Hour)))
+	assert.Len(t, h.Select(all, start, start.Add(time.Hour)), 2)
+}
+
+func TestRates_CounterRates(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	h := NewHistory(time.Hour, 100)
+	// Счетчик сбрасывается между 3-й и 4-й минутой
+	for i, total := range []int64{0, 60, 120, 30, 90} {
+		h.Record(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &total}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	r := NewRates(h, []time.Duration{90 * time.Second, 10 * time.Minute, time.Second})
+	r.now = func() time.Time { return start.Add(4 * time.Minute) }
+
+	rates, ok := r.CounterRates("PollCount")
+	require.True(t, ok)
+	require.NotNil(t, rates.Rate)
+	assert.Equal(t, 1.0, *rates.Rate)
+	assert.Equal(t, []models.WindowRate{
+		{Window: "1m30s", Rate: 1, Increase: 60},
+		{Window: "10m0s", Rate: 210.0 / 240, Increase: 60 + 60 + 30 + 60},
+	}, rates.Windows, "window without two samples is skipped")
+
+	_, ok = r.CounterRates("Missing")
+	assert.False(t, ok)
+}
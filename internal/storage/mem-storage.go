@@ -1,15 +1,20 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 
 	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
 	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
 )
 
 // MemStorage реализует интерфейс хранилища метрик в оперативной памяти.
-// Метрики сохраняются в map по их ID.
+// Метрики сохраняются в map по их ID. Доступ к map защищен мьютексом,
+// так как обработчики HTTP-запросов вызывают методы хранилища конкурентно.
 type MemStorage struct {
+	mu      sync.RWMutex
 	metrics map[string]models.Metrics
 }
 
@@ -21,35 +26,78 @@ func NewMemStorage() handler.Storager {
 // Save сохраняет метрику в хранилище.
 // Для gauge просто перезаписывает значение.
 // Для counter увеличивает значение счетчика, если метрика уже существует.
+// Метрика, не прошедшая models.Metrics.Validate, не сохраняется: Save возвращает
+// models.ValidationError. Если ID занят метрикой другого типа, возвращает handler.ErrTypeConflict.
 func (r *MemStorage) Save(metric models.Metrics) error {
-	mType, ID, value, delta := metric.MType, metric.ID, metric.Value, metric.Delta
+	_, err := r.SaveBatch([]models.Metrics{metric})
+	var batchErr *handler.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Err
+	}
+	return err
+}
 
-	var defaultDelta int64 = 0
-	if delta == nil {
-		delta = &defaultDelta
+// SaveBatch сохраняет пакет метрик под одной блокировкой. Сначала проверяются все метрики,
+// и только если ни одна не вызывает ошибки, пакет применяется целиком.
+func (r *MemStorage) SaveBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	for i, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return nil, &handler.BatchError{Index: i, Err: fmt.Errorf("metric %q: %w", m.ID, err)}
+		}
 	}
-	existMetric, ok := r.Get(mType, ID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	types := make(map[string]string, len(metrics)) // Типы ID с учетом предыдущих метрик пакета
+	for i, m := range metrics {
+		mType, ok := types[m.ID]
+		if !ok {
+			if stored, exists := r.metrics[m.ID]; exists {
+				mType, ok = stored.MType, true
+			}
+		}
+		if ok && mType != m.MType {
+			return nil, &handler.BatchError{Index: i, Err: fmt.Errorf("%w: %s is a %s", handler.ErrTypeConflict, m.ID, mType)}
+		}
+		types[m.ID] = m.MType
+	}
+
+	stored := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		stored[i] = r.apply(m)
+	}
+	return stored, nil
+}
+
+// apply сохраняет проверенную метрику и возвращает ее новое значение. Вызывается под r.mu.
+func (r *MemStorage) apply(metric models.Metrics) models.Metrics {
+	mType, ID, value, delta := metric.MType, metric.ID, metric.Value, metric.Delta
 
 	if mType == models.Gauge {
 		r.metrics[ID] = models.Metrics{ID: ID, MType: mType, Value: value}
-		return nil
+		return r.metrics[ID]
 	}
-	if mType == models.Counter {
-		if !ok {
-			r.metrics[ID] = models.Metrics{ID: ID, MType: mType, Delta: delta}
-			return nil
-		} else {
-			delta := *existMetric.Delta + *delta
-			existMetric.Delta = &delta
-			r.metrics[ID] = existMetric
-		}
+
+	total := *delta
+	if existMetric, ok := r.get(mType, ID); ok {
+		total += *existMetric.Delta
 	}
-	return nil
+	r.metrics[ID] = models.Metrics{ID: ID, MType: mType, Delta: &total}
+	return r.metrics[ID]
 }
 
 // Get возвращает метрику по типу и ID.
 // Если метрика не найдена или тип не совпадает — возвращает false.
 func (r *MemStorage) Get(mType string, ID string) (models.Metrics, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.get(mType, ID)
+}
+
+// get возвращает метрику по типу и ID без блокировки. Вызывается под r.mu.
+func (r *MemStorage) get(mType string, ID string) (models.Metrics, bool) {
 	m, ok := r.metrics[ID]
 	if !ok {
 		return models.Metrics{}, false
@@ -61,11 +109,45 @@ func (r *MemStorage) Get(mType string, ID string) (models.Metrics, bool) {
 	return m, true
 }
 
+// List возвращает метрики, подходящие под opts, в порядке opts.Sort.
+// Выборка и сортировка выполняются под блокировкой чтения по снимку метрик.
+func (r *MemStorage) List(opts handler.ListOptions) ([]models.Metrics, error) {
+	r.mu.RLock()
+	metrics := make([]models.Metrics, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		if opts.Match(m) {
+			metrics = append(metrics, m)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return opts.Less(metrics[i], metrics[j]) })
+	if opts.Limit > 0 && len(metrics) > opts.Limit {
+		metrics = metrics[:opts.Limit]
+	}
+	return metrics, nil
+}
+
+// Delete удаляет метрику по типу и ID. Возвращает false, если метрика не найдена
+// или тип не совпадает.
+func (r *MemStorage) Delete(mType string, ID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.get(mType, ID); !ok {
+		return false, nil
+	}
+	delete(r.metrics, ID)
+	return true, nil
+}
+
 // GetAll возвращает срез всех метрик, хранящихся в памяти.
 func (r *MemStorage) GetAll() []models.Metrics {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	all := make([]models.Metrics, 0, len(r.metrics))
 	for _, m := range r.metrics {
-		fmt.Println(m)
 		all = append(all, m)
 	}
 	return all
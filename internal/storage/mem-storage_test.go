@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorage_SaveRejects(t *testing.T) {
+	value, nan, delta := 1.0, math.NaN(), int64(1)
+
+	tests := []struct {
+		name   string
+		metric models.Metrics
+		want   error
+	}{
+		{name: "gauge without value", metric: models.Metrics{ID: "g", MType: models.Gauge}, want: models.ErrInvalidValue},
+		{name: "NaN gauge", metric: models.Metrics{ID: "g", MType: models.Gauge, Value: &nan}, want: models.ErrInvalidValue},
+		{name: "counter with value", metric: models.Metrics{ID: "c", MType: models.Counter, Value: &value}, want: models.ErrInvalidValue},
+		{name: "empty id", metric: models.Metrics{MType: models.Gauge, Value: &value}, want: models.ErrMissingID},
+		{name: "unknown type", metric: models.Metrics{ID: "h", MType: "histogram", Value: &value}, want: models.ErrUnknownType},
+		{name: "type conflict", metric: models.Metrics{ID: "Alloc", MType: models.Counter, Delta: &delta}, want: handler.ErrTypeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemStorage()
+			require.NoError(t, s.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+
+			err := s.Save(tt.metric)
+			assert.True(t, errors.Is(err, tt.want), "got %v", err)
+			assert.Len(t, s.GetAll(), 1)
+		})
+	}
+}
+
+func TestMemStorage_SaveBatch(t *testing.T) {
+	value, one, two := 1.0, int64(1), int64(2)
+
+	tests := []struct {
+		name      string
+		batch     []models.Metrics
+		wantIndex int
+		wantErr   error
+	}{
+		{
+			name:      "conflict with stored metric",
+			batch:     []models.Metrics{{ID: "PollCount", MType: models.Counter, Delta: &two}, {ID: "Alloc", MType: models.Counter, Delta: &one}},
+			wantIndex: 1,
+			wantErr:   handler.ErrTypeConflict,
+		},
+		{
+			name:      "conflict inside batch",
+			batch:     []models.Metrics{{ID: "cpu", MType: models.Gauge, Value: &value}, {ID: "cpu", MType: models.Counter, Delta: &one}},
+			wantIndex: 1,
+			wantErr:   handler.ErrTypeConflict,
+		},
+		{
+			name:      "invalid metric",
+			batch:     []models.Metrics{{ID: "PollCount", MType: models.Counter, Delta: &two}, {ID: "cpu", MType: models.Gauge}},
+			wantIndex: 1,
+			wantErr:   models.ErrInvalidValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemStorage()
+			require.NoError(t, s.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+			require.NoError(t, s.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &one}))
+
+			_, err := s.SaveBatch(tt.batch)
+			var batchErr *handler.BatchError
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, tt.wantIndex, batchErr.Index)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			// Пакет не применен даже частично.
+			pollCount, _ := s.Get(models.Counter, "PollCount")
+			assert.Equal(t, int64(1), *pollCount.Delta)
+			assert.Len(t, s.GetAll(), 2)
+		})
+	}
+
+	s := NewMemStorage()
+	stored, err := s.SaveBatch([]models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: &one},
+		{ID: "PollCount", MType: models.Counter, Delta: &two},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *stored[0].Delta)
+	assert.Equal(t, int64(3), *stored[1].Delta)
+}
+
+func TestMemStorage_List(t *testing.T) {
+	s := NewMemStorage()
+	for i, id := range []string{"b", "c", "a", "d"} {
+		v := float64(10 - i)
+		require.NoError(t, s.Save(models.Metrics{ID: id, MType: models.Gauge, Value: &v}))
+	}
+	delta := int64(8)
+	require.NoError(t, s.Save(models.Metrics{ID: "e", MType: models.Counter, Delta: &delta}))
+
+	tests := []struct {
+		name string
+		opts handler.ListOptions
+		want []string
+	}{
+		{name: "by name", opts: handler.ListOptions{Sort: handler.SortName}, want: []string{"a", "b", "c", "d", "e"}},
+		{name: "by value", opts: handler.ListOptions{Sort: handler.SortValue}, want: []string{"d", "a", "e", "c", "b"}},
+		{name: "type and limit", opts: handler.ListOptions{Type: models.Gauge, Limit: 2}, want: []string{"a", "b"}},
+		{name: "after cursor", opts: handler.ListOptions{Sort: handler.SortValue, After: &handler.ListCursor{ID: "a", Value: 8}}, want: []string{"e", "c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := s.List(tt.opts)
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(metrics))
+			for _, m := range metrics {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Observer получает метрику после каждого успешного сохранения.
+// Для counter передается итоговое значение счетчика, а не приращение.
+// Observer вызывается синхронно внутри Save и не должен блокироваться.
+// Уведомления приходят в том же порядке, в котором применялись сохранения,
+// поэтому итог счетчика в последовательных уведомлениях не убывает.
+type Observer func(metric models.Metrics)
+
+// DeleteObserver получает тип и ID метрики после ее удаления.
+// Уведомления об удалении приходят в общем порядке с уведомлениями о сохранении:
+// сохранение после удаления снова передается Observer, начиная новый ряд значений.
+type DeleteObserver func(mType, id string)
+
+// Observable оборачивает хранилище и уведомляет подписчиков о каждом сохранении и удалении.
+type Observable struct {
+	handler.Storager
+
+	saveMu          sync.Mutex // Объединяет изменение и уведомление, чтобы подписчики видели изменения по порядку
+	mu              sync.RWMutex
+	observers       []Observer
+	deleteObservers []DeleteObserver
+}
+
+// NewObservable создает обертку над хранилищем s.
+func NewObservable(s handler.Storager) *Observable {
+	return &Observable{Storager: s}
+}
+
+// Subscribe добавляет подписчика.
+func (o *Observable) Subscribe(fn Observer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.observers = append(o.observers, fn)
+}
+
+// OnDelete добавляет подписчика на удаление метрик.
+func (o *Observable) OnDelete(fn DeleteObserver) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.deleteObservers = append(o.deleteObservers, fn)
+}
+
+// Save сохраняет метрику и передает подписчикам ее новое значение.
+func (o *Observable) Save(metric models.Metrics) error {
+	_, err := o.SaveBatch([]models.Metrics{metric})
+	var batchErr *handler.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Err
+	}
+	return err
+}
+
+// SaveBatch сохраняет пакет метрик и передает подписчикам новые значения всех метрик пакета.
+func (o *Observable) SaveBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	o.saveMu.Lock()
+	defer o.saveMu.Unlock()
+
+	stored, err := o.Storager.SaveBatch(metrics)
+	if err != nil {
+		return nil, err
+	}
+	o.notify(stored)
+	return stored, nil
+}
+
+// Delete удаляет метрику и, если она была в хранилище, сообщает об этом подписчикам OnDelete.
+func (o *Observable) Delete(mType, id string) (bool, error) {
+	o.saveMu.Lock()
+	defer o.saveMu.Unlock()
+
+	deleted, err := o.Storager.Delete(mType, id)
+	if !deleted {
+		return deleted, err
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, fn := range o.deleteObservers {
+		fn(mType, id)
+	}
+	return deleted, err
+}
+
+// notify передает подписчикам метрики. Вызывается под o.saveMu.
+func (o *Observable) notify(metrics []models.Metrics) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, m := range metrics {
+		for _, fn := range o.observers {
+			fn(m)
+		}
+	}
+}
+
+// Close закрывает обернутое хранилище, если оно реализует io.Closer.
+func (o *Observable) Close() error {
+	if closer, ok := o.Storager.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservable_NotifiesInOrder(t *testing.T) {
+	o := NewObservable(NewMemStorage())
+
+	var totals []int64 // Вызовы подписчика упорядочены Observable, мьютекс не нужен
+	o.Subscribe(func(m models.Metrics) {
+		totals = append(totals, *m.Delta)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				delta := int64(1)
+				assert.NoError(t, o.Save(models.Metrics{ID: "requests", MType: models.Counter, Delta: &delta}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, totals, 800)
+	for i, total := range totals {
+		assert.Equal(t, int64(i+1), total)
+	}
+}
+
+func TestObservable_Delete(t *testing.T) {
+	o := NewObservable(NewMemStorage())
+	history := NewHistory(time.Hour, 10)
+	o.Subscribe(history.Observe)
+	o.OnDelete(history.Delete)
+
+	var deleted []string
+	o.OnDelete(func(mType, id string) {
+		deleted = append(deleted, mType+"/"+id)
+	})
+
+	value := 1.5
+	require.NoError(t, o.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+	require.Len(t, history.Last("Alloc", models.Gauge, 10), 1)
+
+	ok, err := o.Delete(models.Counter, "Alloc")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, deleted, "observers are not notified if nothing was deleted")
+
+	ok, err = o.Delete(models.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"gauge/Alloc"}, deleted)
+	assert.Empty(t, history.Last("Alloc", models.Gauge, 10), "history of a deleted metric is dropped")
+
+	require.NoError(t, o.Save(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &value}))
+	assert.Len(t, history.Last("Alloc", models.Gauge, 10), 1, "a saved metric starts a new history")
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Rates вычисляет скорость изменения счетчиков по истории значений.
+type Rates struct {
+	history *History
+	windows []time.Duration
+	now     func() time.Time
+}
+
+// NewRates создает Rates, считающий скорость и прирост счетчиков за интервалы windows.
+func NewRates(history *History, windows []time.Duration) *Rates {
+	return &Rates{history: history, windows: windows, now: time.Now}
+}
+
+// CounterRates возвращает скорость изменения счетчика id между двумя последними значениями
+// и за каждый интервал, в котором есть хотя бы два значения. Если данных недостаточно
+// ни для одного расчета, возвращает false.
+func (r *Rates) CounterRates(id string) (models.CounterRates, bool) {
+	var result models.CounterRates
+	if v, ok := Rate(r.history.Last(id, models.Counter, 2)); ok {
+		result.Rate = &v
+	}
+
+	now := r.now()
+	match := func(sid, mType string) bool { return sid == id && mType == models.Counter }
+	for _, w := range r.windows {
+		series := r.history.Select(match, now.Add(-w), now)
+		if len(series) == 0 {
+			continue
+		}
+		rate, ok := Rate(series[0].Samples)
+		if !ok {
+			continue
+		}
+		increase, _ := Increase(series[0].Samples)
+		result.Windows = append(result.Windows, models.WindowRate{Window: w.String(), Rate: rate, Increase: increase})
+	}
+
+	return result, result.Rate != nil || len(result.Windows) > 0
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+)
+
+// New создает хранилище метрик по конфигурации. Хранилища, которым нужно сохранить данные
+// при остановке сервера, реализуют io.Closer.
+func New(cfg config.StorageConfig) (handler.Storager, error) {
+	switch cfg.Backend {
+	case config.StorageMemory:
+		return NewMemStorage(), nil
+	case config.StorageFile:
+		return NewFileStorage(cfg.DSN, cfg.StoreInterval.Std(), cfg.Restore)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
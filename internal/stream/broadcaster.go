@@ -0,0 +1,170 @@
+// Package stream рассылает обновления метрик подписчикам, например клиентам GET /stream
+// по протоколу Server-Sent Events.
+//
+// Broadcaster получает каждую сохраненную метрику и раскладывает ее по буферам подписчиков,
+// не блокируясь: если буфер подписчика заполнен, подписчик отключается, чтобы медленный
+// клиент не задерживал обработчики, сохраняющие метрики.
+package stream
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// DefaultBufferSize — размер буфера подписчика по умолчанию.
+const DefaultBufferSize = 256
+
+// Event — обновление или удаление метрики с порядковым номером.
+type Event struct {
+	Seq     uint64         // Порядковый номер события, возрастает на каждое сохранение и удаление
+	Metric  models.Metrics // Метрика после сохранения; для удаления заданы только ID и тип
+	Deleted bool           // Метрика удалена
+}
+
+// Filter отбирает метрики для подписчика. Пустые поля не ограничивают выборку.
+type Filter struct {
+	Type   string          // Тип метрики: gauge или counter
+	Prefix string          // Префикс ID
+	Regex  *regexp.Regexp  // Регулярное выражение для ID
+	IDs    map[string]bool // Точные ID
+}
+
+// ParseFilter разбирает фильтр из параметров запроса type, prefix, regex и id
+// (параметр id можно повторять).
+func ParseFilter(q url.Values) (Filter, error) {
+	return NewFilter(q.Get("type"), q.Get("prefix"), q.Get("regex"), q["id"])
+}
+
+// NewFilter создает фильтр и проверяет тип метрики и регулярное выражение.
+func NewFilter(mType, prefix, expr string, ids []string) (Filter, error) {
+	f := Filter{Type: mType, Prefix: prefix}
+	if f.Type != "" && f.Type != models.Gauge && f.Type != models.Counter {
+		return Filter{}, fmt.Errorf("unknown metric type %q", f.Type)
+	}
+	if expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid regex: %w", err)
+		}
+		f.Regex = re
+	}
+	if len(ids) > 0 {
+		f.IDs = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			f.IDs[id] = true
+		}
+	}
+	return f, nil
+}
+
+// Match сообщает, подходит ли метрика под фильтр.
+func (f Filter) Match(m models.Metrics) bool {
+	if f.Type != "" && f.Type != m.MType {
+		return false
+	}
+	if !strings.HasPrefix(m.ID, f.Prefix) {
+		return false
+	}
+	if len(f.IDs) > 0 && !f.IDs[m.ID] {
+		return false
+	}
+	return f.Regex == nil || f.Regex.MatchString(m.ID)
+}
+
+// Subscriber — подписка на обновления метрик.
+type Subscriber struct {
+	C       <-chan Event  // Обновления, подходящие под фильтр
+	Dropped chan struct{} // Закрывается, если подписчик отключен из-за переполнения буфера
+
+	events chan Event
+	filter Filter
+}
+
+// Broadcaster рассылает обновления метрик подписчикам.
+type Broadcaster struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*Subscriber]struct{}
+
+	done      chan struct{} // Закрывается при остановке, чтобы завершить открытые потоки
+	closeOnce sync.Once
+}
+
+// NewBroadcaster создает Broadcaster без подписчиков.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[*Subscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Close завершает все открытые потоки ServeHTTP. Вызывается при остановке сервера,
+// иначе долгоживущие соединения задержат ее до таймаута.
+func (b *Broadcaster) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// Subscribe создает подписку с фильтром f и буфером на bufferSize событий.
+// Подписку нужно завершить вызовом Unsubscribe.
+func (b *Broadcaster) Subscribe(f Filter, bufferSize int) *Subscriber {
+	events := make(chan Event, bufferSize)
+	s := &Subscriber{C: events, Dropped: make(chan struct{}), events: events, filter: f}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe завершает подписку. Повторный вызов и вызов для отключенного подписчика безопасны.
+func (b *Broadcaster) Unsubscribe(s *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, s)
+}
+
+// Publish передает метрику подписчикам, не блокируясь.
+// Подписчик с заполненным буфером отключается: его канал Dropped закрывается.
+// Подходит для storage.Observable.Subscribe.
+func (b *Broadcaster) Publish(m models.Metrics) {
+	b.publish(Event{Metric: m})
+}
+
+// PublishDelete передает подписчикам удаление метрики. Подходит для storage.Observable.OnDelete.
+func (b *Broadcaster) PublishDelete(mType, id string) {
+	b.publish(Event{Metric: models.Metrics{ID: id, MType: mType}, Deleted: true})
+}
+
+// publish присваивает событию порядковый номер и раскладывает его по буферам подписчиков.
+func (b *Broadcaster) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	ev.Seq = b.seq
+	for s := range b.subscribers {
+		if !s.filter.Match(ev.Metric) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			delete(b.subscribers, s)
+			close(s.Dropped)
+		}
+	}
+}
+
+// Len возвращает число подписчиков.
+func (b *Broadcaster) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filter", query: "", want: []string{"HeapAlloc", "HeapSys", "PollCount", "Alloc"}},
+		{name: "type", query: "type=counter", want: []string{"PollCount"}},
+		{name: "prefix", query: "prefix=Heap", want: []string{"HeapAlloc", "HeapSys"}},
+		{name: "regex", query: "regex=Alloc$", want: []string{"HeapAlloc", "Alloc"}},
+		{name: "ids", query: "id=Alloc&id=PollCount", want: []string{"PollCount", "Alloc"}},
+		{name: "combined", query: "type=gauge&prefix=Heap&regex=Sys", want: []string{"HeapSys"}},
+		{name: "unknown type", query: "type=histogram", wantErr: true},
+		{name: "bad regex", query: "regex=(", wantErr: true},
+	}
+	metrics := []models.Metrics{gauge("HeapAlloc", 1), gauge("HeapSys", 2), counter("PollCount", 3), gauge("Alloc", 4)}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			f, err := ParseFilter(q)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var got []string
+			for _, m := range metrics {
+				if f.Match(m) {
+					got = append(got, m.ID)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBroadcaster_DropsSlowSubscriber(t *testing.T) {
+	b := NewBroadcaster()
+	slow := b.Subscribe(Filter{}, 2)
+	fast := b.Subscribe(Filter{}, 10)
+
+	for i := 0; i < 3; i++ {
+		b.Publish(gauge("Alloc", float64(i)))
+	}
+
+	select {
+	case <-slow.Dropped:
+	default:
+		t.Fatal("slow subscriber was not dropped")
+	}
+	assert.Equal(t, 1, b.Len())
+	assert.Len(t, fast.C, 3)
+
+	b.Unsubscribe(slow)
+	b.Unsubscribe(fast)
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestBroadcaster_ServeHTTP(t *testing.T) {
+	b := NewBroadcaster()
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?type=counter")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	require.Eventually(t, func() bool { return b.Len() == 1 }, time.Second, time.Millisecond)
+	b.Publish(gauge("Alloc", 1))
+	b.Publish(counter("PollCount", 5))
+	b.PublishDelete(models.Gauge, "Alloc")
+	b.PublishDelete(models.Counter, "PollCount")
+
+	reader := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 7 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	assert.Equal(t, []string{
+		"id: 2", "event: metric", `data: {"id":"PollCount","type":"counter","delta":5}`, "",
+		"id: 4", "event: deleted", `data: {"id":"PollCount","type":"counter"}`,
+	}, lines)
+
+	b.Close()
+	_, err = reader.ReadString('\n') // Пустая строка после события
+	require.NoError(t, err)
+	_, err = reader.ReadString('\n')
+	assert.Error(t, err, "stream must end after Close")
+}
+
+func TestBroadcaster_ServeHTTPBadFilter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewBroadcaster().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?regex=(", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
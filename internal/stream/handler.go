@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+)
+
+// heartbeatInterval — интервал комментариев-пингов, которые не дают прокси закрыть соединение.
+const heartbeatInterval = 15 * time.Second
+
+// ServeHTTP отдает поток обновлений метрик в формате Server-Sent Events.
+// Каждое обновление — событие metric с JSON метрики в data и порядковым номером в id,
+// удаление — событие deleted с ID и типом метрики в data.
+// Фильтр задается параметрами запроса type, prefix, regex и id. Если клиент не успевает
+// читать поток, сервер отправляет событие dropped и закрывает соединение.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseFilter(r.URL.Query())
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток живет дольше WriteTimeout сервера; ошибка означает, что таймаут изменить нельзя.
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	sub := b.Subscribe(filter, DefaultBufferSize)
+	defer b.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev := <-sub.C:
+			data, err := json.Marshal(ev.Metric)
+			if err != nil {
+				return
+			}
+			event := "metric"
+			if ev.Deleted {
+				event = "deleted"
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, event, data); err != nil {
+				return
+			}
+		case <-sub.Dropped:
+			_, _ = fmt.Fprint(w, "event: dropped\ndata: subscriber buffer overflow\n\n")
+			_ = rc.Flush()
+			return
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package webhook отправляет исходящие уведомления об изменении метрик.
+//
+// Dispatcher подписывается на сохранение метрик и для каждого получателя из конфигурации
+// решает, нужно ли уведомление: при каждом обновлении выбранных метрик или, если задан порог,
+// только при его пересечении. Об удалении выбранной метрики получатель узнает в любом случае. Уведомления ставятся в ограниченную очередь получателя
+// и доставляются отдельной горутиной с повторами и экспоненциальной задержкой.
+// Уведомления, которые не удалось доставить или поставить в очередь, записываются
+// в журнал недоставленных (dead-letter).
+//
+// Тело уведомления подписывается HMAC-SHA256 ключом получателя в заголовке HashSHA256,
+// а идентификатор уведомления передается в заголовке Idempotency-Key и не меняется
+// между повторами, чтобы получатель мог отбросить дубли.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/alerting"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Типы событий.
+const (
+	EventUpdated   = "metric.updated"    // Метрика обновлена
+	EventThreshold = "threshold.crossed" // Значение метрики пересекло порог
+	EventDeleted   = "metric.deleted"    // Метрика удалена
+)
+
+// Значения по умолчанию для получателя.
+const (
+	defaultQueueSize   = 100
+	defaultMaxAttempts = 5
+	defaultTimeout     = 5 * time.Second
+)
+
+// Event — тело уведомления.
+type Event struct {
+	ID        string         `json:"id"`                  // Уникальный идентификатор уведомления
+	Type      string         `json:"event"`               // metric.updated, threshold.crossed или metric.deleted
+	Timestamp time.Time      `json:"timestamp"`           // Время события
+	Metric    models.Metrics `json:"metric"`              // Метрика после обновления (для counter — итоговое значение); для удаления — только ID и тип
+	Threshold *Crossing      `json:"threshold,omitempty"` // Пересечение порога для threshold.crossed
+}
+
+// Crossing описывает пересечение порога.
+type Crossing struct {
+	Op     string  `json:"op"`     // Сравнение из конфигурации
+	Value  float64 `json:"value"`  // Порог
+	Active bool    `json:"active"` // true — условие стало выполняться, false — перестало
+}
+
+// Dispatcher распределяет события по получателям.
+type Dispatcher struct {
+	endpoints []*endpoint
+	logger    *zap.SugaredLogger
+
+	deadFile    *os.File        // Журнал недоставленных уведомлений, nil — только лог
+	letters     chan deadLetter // Очередь записей журнала, ее разбирает writeDeadLetters
+	lettersDone chan struct{}   // Закрывается, когда writeDeadLetters записал очередь
+	lettersMu   sync.Mutex      // Защищает lettersShut от гонки с закрытием letters
+	lettersShut bool            // letters закрыт, новые записи только учитываются в lostLetters
+	lostLetters atomic.Int64    // Записи, не поместившиеся в очередь журнала или пришедшие после Close
+}
+
+// deadLetterQueueSize — размер очереди записей журнала недоставленных.
+const deadLetterQueueSize = 1024
+
+// NewDispatcher создает Dispatcher и запускает доставку для каждого получателя из cfg.
+func NewDispatcher(cfg config.WebhooksConfig, logger *zap.SugaredLogger) (*Dispatcher, error) {
+	d := &Dispatcher{
+		logger:      logger,
+		letters:     make(chan deadLetter, deadLetterQueueSize),
+		lettersDone: make(chan struct{}),
+	}
+
+	for i, ep := range cfg.Endpoints {
+		if ep.Threshold != nil && !alerting.ValidOp(ep.Threshold.Op) {
+			return nil, fmt.Errorf("webhooks.endpoints[%d]: unknown comparison %q", i, ep.Threshold.Op)
+		}
+		for _, selector := range ep.Metrics {
+			if _, err := path.Match(selector, ""); err != nil {
+				return nil, fmt.Errorf("webhooks.endpoints[%d]: invalid selector %q", i, selector)
+			}
+		}
+	}
+
+	if cfg.DeadLetterFile != "" {
+		f, err := os.OpenFile(cfg.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks dead letter file: %w", err)
+		}
+		d.deadFile = f
+	}
+	go d.writeDeadLetters()
+
+	for _, ep := range cfg.Endpoints {
+		e := newEndpoint(ep, d)
+		d.endpoints = append(d.endpoints, e)
+		go e.run()
+	}
+	return d, nil
+}
+
+// Observe обрабатывает сохранение метрики. Подходит для storage.Observable.Subscribe:
+// не блокируется, а при переполненной очереди получателя уведомление уходит в журнал недоставленных.
+func (d *Dispatcher) Observe(metric models.Metrics) {
+	now := time.Now()
+	d.dispatch(func(e *endpoint) (Event, bool) { return e.event(metric, now) })
+}
+
+// ObserveDelete обрабатывает удаление метрики. Подходит для storage.Observable.OnDelete:
+// получатели, выбравшие метрику, получают metric.deleted, а состояние порога метрики сбрасывается.
+func (d *Dispatcher) ObserveDelete(mType, id string) {
+	now := time.Now()
+	d.dispatch(func(e *endpoint) (Event, bool) { return e.deleteEvent(mType, id, now) })
+}
+
+// dispatch ставит в очереди получателей уведомления, которые для них возвращает event.
+func (d *Dispatcher) dispatch(event func(e *endpoint) (Event, bool)) {
+	for _, e := range d.endpoints {
+		ev, ok := event(e)
+		if !ok {
+			continue
+		}
+		id, err := newEventID()
+		if err != nil {
+			d.logger.Errorln("webhook event id", err)
+			continue
+		}
+		ev.ID = id
+		e.enqueue(ev)
+	}
+}
+
+// Close прекращает прием событий и ждет, пока получатели доставят очереди.
+// Если ctx отменяется раньше, оставшиеся уведомления записываются в журнал недоставленных.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	for _, e := range d.endpoints {
+		e.close(ctx)
+	}
+
+	d.lettersMu.Lock()
+	if !d.lettersShut {
+		d.lettersShut = true
+		close(d.letters)
+	}
+	d.lettersMu.Unlock()
+	<-d.lettersDone
+
+	if lost := d.lostLetters.Load(); lost > 0 {
+		d.logger.Warnw("webhook dead letters lost", "count", lost)
+	}
+	if d.deadFile != nil {
+		return d.deadFile.Close()
+	}
+	return nil
+}
+
+// deadLetter — запись журнала недоставленных уведомлений.
+type deadLetter struct {
+	Endpoint string    `json:"endpoint"`
+	Reason   string    `json:"reason"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+	Event    Event     `json:"event"`
+}
+
+// deadLetter передает недоставленное уведомление в журнал, дожидаясь места в очереди.
+// Вызывается из горутин доставки, до того как Close закроет очередь журнала.
+func (d *Dispatcher) deadLetter(url string, ev Event, attempts int, reason string) {
+	d.letters <- deadLetter{Endpoint: url, Reason: reason, Attempts: attempts, Time: time.Now(), Event: ev}
+}
+
+// dropLetter передает в журнал уведомление, не попавшее в очередь получателя.
+// Вызывается при сохранении метрики, поэтому не ждет: если очередь журнала заполнена
+// или уже закрыта, запись только учитывается в lostLetters.
+func (d *Dispatcher) dropLetter(url string, ev Event, reason string) {
+	d.lettersMu.Lock()
+	defer d.lettersMu.Unlock()
+	if !d.lettersShut {
+		select {
+		case d.letters <- deadLetter{Endpoint: url, Reason: reason, Time: time.Now(), Event: ev}:
+			return
+		default:
+		}
+	}
+	d.lostLetters.Add(1)
+}
+
+// writeDeadLetters записывает недоставленные уведомления в лог и в журнал до закрытия очереди.
+func (d *Dispatcher) writeDeadLetters() {
+	defer close(d.lettersDone)
+	for dl := range d.letters {
+		d.logger.Warnw("webhook dead letter", "endpoint", dl.Endpoint, "event", dl.Event.ID, "attempts", dl.Attempts, "reason", dl.Reason)
+		if d.deadFile == nil {
+			continue
+		}
+
+		line, err := json.Marshal(dl)
+		if err != nil {
+			continue
+		}
+		if _, err = d.deadFile.Write(append(line, '\n')); err != nil {
+			d.logger.Errorln("webhook dead letter file", err)
+		}
+	}
+}
+
+// Statuses возвращает состояние доставки по всем получателям.
+func (d *Dispatcher) Statuses() []Status {
+	statuses := make([]Status, 0, len(d.endpoints))
+	for _, e := range d.endpoints {
+		statuses = append(statuses, e.status())
+	}
+	return statuses
+}
+
+// ServeHTTP отдает состояние доставки в формате JSON.
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.Statuses()); err != nil {
+		d.logger.Errorln("failed to write webhook deliveries", err)
+	}
+}
+
+// newEventID возвращает случайный идентификатор уведомления.
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/middleware"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// receiver — получатель уведомлений, который отвечает статусами из statuses по очереди,
+// а после их окончания — 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var ev Event
+		_ = json.Unmarshal(body, &ev)
+		rc.events = append(rc.events, ev)
+		rc.bodies = append(rc.bodies, body)
+		rc.headers = append(rc.headers, r.Header.Clone())
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event(nil), rc.events...)
+}
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func TestDispatcher(t *testing.T) {
+	retryBase = time.Millisecond
+
+	tests := []struct {
+		name       string
+		endpoint   config.WebhookEndpoint
+		statuses   []int
+		values     []float64
+		deleteAt   int // Перед каким значением удалить Alloc и HeapAlloc, 0 — не удалять
+		wantEvents []string
+		wantActive []bool
+		wantStatus Status
+	}{
+		{
+			name:       "every update of selected metric",
+			endpoint:   config.WebhookEndpoint{Metrics: []string{"Heap*"}, Secret: "s3cret"},
+			values:     []float64{1, 2},
+			wantEvents: []string{EventUpdated, EventUpdated},
+			wantStatus: Status{Delivered: 2},
+		},
+		{
+			name:       "threshold crossings only",
+			endpoint:   config.WebhookEndpoint{Threshold: &config.WebhookThreshold{Op: ">", Value: 10}},
+			values:     []float64{5, 20, 30, 5, 7},
+			wantEvents: []string{EventThreshold, EventThreshold},
+			wantActive: []bool{true, false},
+			wantStatus: Status{Delivered: 2},
+		},
+		{
+			name:       "delete resets threshold state",
+			endpoint:   config.WebhookEndpoint{Threshold: &config.WebhookThreshold{Op: ">", Value: 10}},
+			values:     []float64{20, 20},
+			deleteAt:   1,
+			wantEvents: []string{EventThreshold, EventDeleted, EventThreshold},
+			wantActive: []bool{true, true},
+			wantStatus: Status{Delivered: 3},
+		},
+		{
+			name:       "retries server errors",
+			endpoint:   config.WebhookEndpoint{MaxAttempts: 3},
+			statuses:   []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			values:     []float64{1},
+			wantEvents: []string{EventUpdated},
+			wantStatus: Status{Delivered: 1},
+		},
+		{
+			name:       "gives up after max attempts",
+			endpoint:   config.WebhookEndpoint{MaxAttempts: 2},
+			statuses:   []int{http.StatusBadGateway, http.StatusBadGateway},
+			values:     []float64{1},
+			wantStatus: Status{Failed: 1},
+		},
+		{
+			name:       "does not retry client errors",
+			endpoint:   config.WebhookEndpoint{MaxAttempts: 5},
+			statuses:   []int{http.StatusBadRequest},
+			values:     []float64{1, 2},
+			wantEvents: []string{EventUpdated},
+			wantStatus: Status{Delivered: 1, Failed: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+
+			deadLetters := filepath.Join(t.TempDir(), "dead.jsonl")
+			tt.endpoint.URL = srv.URL
+			if tt.endpoint.Metrics == nil {
+				tt.endpoint.Metrics = []string{"HeapAlloc"} // Alloc не выбрана ни одним получателем
+			}
+			d, err := NewDispatcher(config.WebhooksConfig{
+				Endpoints:      []config.WebhookEndpoint{tt.endpoint},
+				DeadLetterFile: deadLetters,
+			}, zap.NewNop().Sugar())
+			require.NoError(t, err)
+
+			s := storage.NewObservable(storage.NewMemStorage())
+			s.Subscribe(d.Observe)
+			s.OnDelete(d.ObserveDelete)
+			require.NoError(t, s.Save(gauge("Alloc", 100)))
+			for i, v := range tt.values {
+				if tt.deleteAt > 0 && i == tt.deleteAt {
+					for _, id := range []string{"Alloc", "HeapAlloc"} {
+						_, err = s.Delete(models.Gauge, id)
+						require.NoError(t, err)
+					}
+				}
+				require.NoError(t, s.Save(gauge("HeapAlloc", v)))
+			}
+			require.NoError(t, d.Close(context.Background()))
+
+			events := rc.received()
+			var types []string
+			var active []bool
+			for _, ev := range events {
+				types = append(types, ev.Type)
+				assert.Equal(t, "HeapAlloc", ev.Metric.ID)
+				if ev.Threshold != nil {
+					active = append(active, ev.Threshold.Active)
+				}
+			}
+			assert.Equal(t, tt.wantEvents, types)
+			assert.Equal(t, tt.wantActive, active)
+
+			if tt.endpoint.Secret != "" {
+				for i, h := range rc.headers {
+					assert.Equal(t, middleware.Sign(tt.endpoint.Secret, rc.bodies[i]), h.Get(middleware.SignatureHeader))
+					assert.Equal(t, events[i].ID, h.Get(middleware.IdempotencyHeader))
+				}
+			}
+
+			status := d.Statuses()[0]
+			assert.Equal(t, tt.wantStatus.Delivered, status.Delivered)
+			assert.Equal(t, tt.wantStatus.Failed, status.Failed)
+			assert.Len(t, status.Deliveries, int(status.Delivered+status.Failed))
+
+			assert.Equal(t, int(tt.wantStatus.Failed), countLines(t, deadLetters))
+		})
+	}
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(config.WebhooksConfig{
+		Endpoints: []config.WebhookEndpoint{{URL: srv.URL, QueueSize: 1}},
+	}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	// Первое уведомление доставляется и блокирует получателя, второе ждет в очереди,
+	// остальные отбрасываются.
+	d.Observe(gauge("Alloc", 1))
+	require.Eventually(t, func() bool { return d.Statuses()[0].Queued == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		d.Observe(gauge("Alloc", float64(i)))
+	}
+	assert.Equal(t, int64(2), d.Statuses()[0].Dropped)
+
+	close(release)
+	require.NoError(t, d.Close(context.Background()))
+	assert.Equal(t, int64(2), d.Statuses()[0].Delivered)
+}
+
+func countLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	n := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		n++
+	}
+	return n
+}
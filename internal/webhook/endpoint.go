@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/alerting"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/middleware"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// EventHeader — заголовок с типом события.
+const EventHeader = "X-Webhook-Event"
+
+// recentDeliveries — число последних доставок, которые хранятся для /webhooks/deliveries.
+const recentDeliveries = 20
+
+// Задержки между попытками доставки: retryBase, затем вдвое больше, но не более retryMax.
+var (
+	retryBase = 500 * time.Millisecond
+	retryMax  = 30 * time.Second
+)
+
+// Status — состояние доставки уведомлений получателю.
+type Status struct {
+	URL        string     `json:"url"`        // Адрес получателя
+	Queued     int        `json:"queued"`     // Уведомлений в очереди
+	QueueSize  int        `json:"queue_size"` // Размер очереди
+	Delivered  int64      `json:"delivered"`  // Доставлено
+	Failed     int64      `json:"failed"`     // Не доставлено за все попытки
+	Dropped    int64      `json:"dropped"`    // Отброшено из-за переполнения очереди или остановки
+	Deliveries []Delivery `json:"recent"`     // Последние доставки, новые первыми
+}
+
+// Delivery — результат доставки одного уведомления.
+type Delivery struct {
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Metric     string    `json:"metric"`
+	Delivered  bool      `json:"delivered"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// endpoint — получатель уведомлений с собственной очередью и горутиной доставки.
+type endpoint struct {
+	cfg         config.WebhookEndpoint
+	dispatcher  *Dispatcher
+	client      *http.Client
+	maxAttempts int
+	queue       chan Event
+
+	ctx    context.Context // Отменяется, если очередь не успела доставиться при остановке
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu         sync.Mutex
+	closed     bool
+	active     map[string]bool // Выполнялось ли условие порога при последнем обновлении метрики
+	delivered  int64
+	failed     int64
+	dropped    int64
+	deliveries []Delivery
+}
+
+// newEndpoint создает получателя с настройками cfg, заполняя значения по умолчанию.
+func newEndpoint(cfg config.WebhookEndpoint, d *Dispatcher) *endpoint {
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultQueueSize
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	timeout := cfg.Timeout.Std()
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &endpoint{
+		cfg:         cfg,
+		dispatcher:  d,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		queue:       make(chan Event, queueSize),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		active:      make(map[string]bool),
+	}
+}
+
+// selects сообщает, подходит ли метрика под селекторы получателя.
+func (e *endpoint) selects(id string) bool {
+	if len(e.cfg.Metrics) == 0 {
+		return true
+	}
+	for _, selector := range e.cfg.Metrics {
+		if ok, _ := path.Match(selector, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// event возвращает уведомление для сохраненной метрики, если оно нужно этому получателю.
+func (e *endpoint) event(m models.Metrics, now time.Time) (Event, bool) {
+	if !e.selects(m.ID) {
+		return Event{}, false
+	}
+	if e.cfg.Threshold == nil {
+		return Event{Type: EventUpdated, Timestamp: now, Metric: m}, true
+	}
+
+	var value float64
+	switch {
+	case m.MType == models.Gauge && m.Value != nil:
+		value = *m.Value
+	case m.MType == models.Counter && m.Delta != nil:
+		value = float64(*m.Delta)
+	default:
+		return Event{}, false
+	}
+
+	active := alerting.Compare(e.cfg.Threshold.Op, value, e.cfg.Threshold.Value)
+	e.mu.Lock()
+	prev := e.active[m.ID]
+	e.active[m.ID] = active
+	e.mu.Unlock()
+	if active == prev {
+		return Event{}, false
+	}
+
+	return Event{
+		Type:      EventThreshold,
+		Timestamp: now,
+		Metric:    m,
+		Threshold: &Crossing{Op: e.cfg.Threshold.Op, Value: e.cfg.Threshold.Value, Active: active},
+	}, true
+}
+
+// deleteEvent возвращает уведомление об удалении метрики, если она выбрана получателем.
+// Сохранение метрики после удаления сравнивается с порогом как первое.
+func (e *endpoint) deleteEvent(mType, id string, now time.Time) (Event, bool) {
+	if !e.selects(id) {
+		return Event{}, false
+	}
+	e.mu.Lock()
+	delete(e.active, id)
+	e.mu.Unlock()
+	return Event{Type: EventDeleted, Timestamp: now, Metric: models.Metrics{ID: id, MType: mType}}, true
+}
+
+// enqueue ставит уведомление в очередь без блокировки. Уведомление, не попавшее
+// в очередь, передается в журнал недоставленных уже после освобождения e.mu.
+func (e *endpoint) enqueue(ev Event) {
+	e.mu.Lock()
+	reason := "queue full"
+	if !e.closed {
+		select {
+		case e.queue <- ev:
+			e.mu.Unlock()
+			return
+		default:
+		}
+	} else {
+		reason = "dispatcher closed"
+	}
+	e.dropped++
+	e.mu.Unlock()
+
+	e.dispatcher.dropLetter(e.cfg.URL, ev, reason)
+}
+
+// run доставляет уведомления из очереди до ее закрытия.
+func (e *endpoint) run() {
+	defer close(e.done)
+	for ev := range e.queue {
+		e.deliver(ev)
+	}
+}
+
+// close закрывает очередь и ждет ее доставки. Если ctx отменяется раньше,
+// повторы прекращаются, а оставшиеся уведомления уходят в журнал недоставленных.
+func (e *endpoint) close(ctx context.Context) {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		e.cancel()
+		<-e.done
+	}
+	e.cancel()
+}
+
+// deliver отправляет уведомление с повторами и записывает результат.
+func (e *endpoint) deliver(ev Event) {
+	d := Delivery{EventID: ev.ID, Event: ev.Type, Metric: ev.Metric.ID}
+
+	body, err := json.Marshal(ev)
+	if err == nil {
+		delay := retryBase
+		for d.Attempts < e.maxAttempts {
+			if d.Attempts > 0 {
+				select {
+				case <-time.After(delay):
+				case <-e.ctx.Done():
+				}
+				delay = min(delay*2, retryMax)
+			}
+			if e.ctx.Err() != nil {
+				err = fmt.Errorf("shutdown: %w", e.ctx.Err())
+				break
+			}
+
+			d.Attempts++
+			var retry bool
+			d.StatusCode, retry, err = e.post(ev, body)
+			if err == nil || !retry {
+				break
+			}
+		}
+	}
+
+	d.Time = time.Now()
+	d.Delivered = err == nil
+	if err != nil {
+		d.Error = err.Error()
+		e.dispatcher.deadLetter(e.cfg.URL, ev, d.Attempts, d.Error)
+	}
+	e.record(d)
+}
+
+// post выполняет одну попытку доставки. Возвращает статус ответа и признак того,
+// что попытку стоит повторить: при сетевой ошибке, 5xx, 408 и 429.
+func (e *endpoint) post(ev Event, body []byte) (int, bool, error) {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, ev.Type)
+	req.Header.Set(middleware.IdempotencyHeader, ev.ID)
+	if e.cfg.Secret != "" {
+		req.Header.Set(middleware.SignatureHeader, middleware.Sign(e.cfg.Secret, body))
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, false, nil
+	}
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests
+	return res.StatusCode, retry, fmt.Errorf("unexpected status %d", res.StatusCode)
+}
+
+// record сохраняет результат доставки в статистику получателя.
+func (e *endpoint) record(d Delivery) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if d.Delivered {
+		e.delivered++
+	} else {
+		e.failed++
+	}
+	e.deliveries = append([]Delivery{d}, e.deliveries...)
+	if len(e.deliveries) > recentDeliveries {
+		e.deliveries = e.deliveries[:recentDeliveries]
+	}
+}
+
+// status возвращает состояние доставки получателю.
+func (e *endpoint) status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return Status{
+		URL:        e.cfg.URL,
+		Queued:     len(e.queue),
+		QueueSize:  cap(e.queue),
+		Delivered:  e.delivered,
+		Failed:     e.failed,
+		Dropped:    e.dropped,
+		Deliveries: append(make([]Delivery, 0, len(e.deliveries)), e.deliveries...), // Пустой список отдается как [], а не null
+	}
+}
@@ -0,0 +1,280 @@
+// Package ws реализует WebSocket API сервера метрик: одно постоянное соединение,
+// через которое клиент сохраняет пакеты метрик и получает изменения выбранных метрик.
+//
+// Клиент и сервер обмениваются JSON-сообщениями Request и Response. На каждое сообщение
+// клиента сервер отвечает ack с тем же id (для update — с сохраненными значениями)
+// или error. Изменения по подписке приходят сообщениями metric, удаления — сообщениями deleted.
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/problem"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/stream"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Параметры соединения.
+const (
+	writeTimeout   = 10 * time.Second // Таймаут записи одного сообщения
+	pongTimeout    = 60 * time.Second // Соединение закрывается, если клиент молчит дольше
+	pingInterval   = 30 * time.Second // Интервал ping-сообщений сервера
+	maxMessageSize = 4 << 20          // Максимальный размер сообщения клиента
+	outgoingBuffer = 64               // Ответов в очереди на запись
+)
+
+// Handler принимает WebSocket-соединения.
+type Handler struct {
+	storage     handler.Storager
+	broadcaster *stream.Broadcaster
+	logger      *zap.SugaredLogger
+	upgrader    websocket.Upgrader
+
+	done      chan struct{} // Закрывается при остановке сервера
+	closeOnce sync.Once
+}
+
+// NewHandler создает обработчик, который сохраняет метрики в storage
+// и берет изменения для подписок из broadcaster.
+// Подключения из браузера разрешены только с того же origin, что и сервер.
+func NewHandler(storage handler.Storager, broadcaster *stream.Broadcaster, logger *zap.SugaredLogger) *Handler {
+	return &Handler{
+		storage:     storage,
+		broadcaster: broadcaster,
+		logger:      logger,
+		upgrader:    websocket.Upgrader{Error: upgradeError},
+		done:        make(chan struct{}),
+	}
+}
+
+// upgradeError отвечает на запрос, который нельзя перевести на протокол WebSocket.
+func upgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	code := problem.InvalidParameter
+	switch status {
+	case http.StatusForbidden:
+		code = problem.Forbidden
+	case http.StatusMethodNotAllowed:
+		code = problem.MethodNotAllowed
+	}
+	problem.Error(w, r, status, code, reason.Error())
+}
+
+// Close закрывает все открытые соединения с кодом 1001 (going away).
+func (h *Handler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// ServeHTTP переводит соединение на протокол WebSocket и обслуживает его до закрытия.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade уже ответил клиенту ошибкой
+	}
+
+	c := &conn{
+		h:         h,
+		ws:        ws,
+		out:       make(chan outgoing, outgoingBuffer),
+		readDone:  make(chan struct{}),
+		writeDone: make(chan struct{}),
+	}
+	go c.readLoop()
+	c.writeLoop()
+}
+
+// outgoing — сообщение для записи и, при смене подписки, новая подписка.
+type outgoing struct {
+	resp      Response
+	changeSub bool
+	sub       *stream.Subscriber // nil вместе с changeSub — отмена подписки
+}
+
+// conn — одно WebSocket-соединение. Запись выполняет только writeLoop.
+type conn struct {
+	h         *Handler
+	ws        *websocket.Conn
+	out       chan outgoing
+	readDone  chan struct{} // Закрывается, когда readLoop завершился
+	writeDone chan struct{} // Закрывается, когда writeLoop завершился
+}
+
+// readLoop читает сообщения клиента и передает ответы в writeLoop.
+func (c *conn) readLoop() {
+	defer close(c.readDone)
+
+	c.ws.SetReadLimit(maxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+
+		var req Request
+		if err = decodeRequest(data, &req); err != nil {
+			c.send(outgoing{resp: Response{Type: TypeError, Error: "invalid message: " + err.Error()}})
+			continue
+		}
+		c.send(c.handle(req))
+	}
+}
+
+// send передает сообщение в writeLoop, если соединение еще открыто.
+// Если соединение уже закрыто, новая подписка из сообщения отменяется.
+func (c *conn) send(o outgoing) {
+	select {
+	case c.out <- o:
+	case <-c.writeDone:
+		if o.sub != nil {
+			c.h.broadcaster.Unsubscribe(o.sub)
+		}
+	}
+}
+
+// handle обрабатывает сообщение клиента.
+func (c *conn) handle(req Request) outgoing {
+	fail := func(err error) outgoing {
+		return outgoing{resp: Response{Type: TypeError, ID: req.ID, Error: err.Error()}}
+	}
+
+	switch req.Type {
+	case TypeUpdate:
+		stored, err := c.update(req.Metrics)
+		if err != nil {
+			return fail(err)
+		}
+		return outgoing{resp: Response{Type: TypeAck, ID: req.ID, Metrics: stored}}
+	case TypeSubscribe:
+		var f Filter
+		if req.Filter != nil {
+			f = *req.Filter
+		}
+		filter, err := stream.NewFilter(f.Type, f.Prefix, f.Regex, f.IDs)
+		if err != nil {
+			return fail(err)
+		}
+		sub := c.h.broadcaster.Subscribe(filter, stream.DefaultBufferSize)
+		return outgoing{resp: Response{Type: TypeAck, ID: req.ID}, changeSub: true, sub: sub}
+	case TypeUnsubscribe:
+		return outgoing{resp: Response{Type: TypeAck, ID: req.ID}, changeSub: true}
+	default:
+		return fail(fmt.Errorf("unknown message type %q", req.Type))
+	}
+}
+
+// update проверяет и сохраняет пакет метрик. Если хотя бы одна метрика некорректна
+// или конфликтует по типу, пакет не сохраняется. Возвращает сохраненные значения
+// в порядке запроса.
+func (c *conn) update(metrics []models.Metrics) ([]models.Metrics, error) {
+	for i, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("metrics[%d]: %w", i, err)
+		}
+	}
+
+	stored, err := c.h.storage.SaveBatch(metrics)
+	var batchErr *handler.BatchError
+	if errors.As(err, &batchErr) {
+		return nil, fmt.Errorf("metrics[%d]: %w", batchErr.Index, batchErr.Err)
+	}
+	return stored, err
+}
+
+// writeLoop пишет ответы, изменения по подписке и ping-сообщения до закрытия соединения.
+func (c *conn) writeLoop() {
+	var sub *stream.Subscriber
+	defer func() {
+		if sub != nil {
+			c.h.broadcaster.Unsubscribe(sub)
+		}
+		_ = c.ws.Close()
+		close(c.writeDone)
+
+		// Подписки из необработанных сообщений тоже нужно отменить
+		for {
+			select {
+			case o := <-c.out:
+				if o.sub != nil {
+					c.h.broadcaster.Unsubscribe(o.sub)
+				}
+			default:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		// Каналы nil-подписки никогда не готовы, поэтому без подписки select их пропускает.
+		var events <-chan stream.Event
+		var dropped chan struct{}
+		if sub != nil {
+			events, dropped = sub.C, sub.Dropped
+		}
+
+		var err error
+		select {
+		case o := <-c.out:
+			if o.changeSub {
+				if sub != nil {
+					c.h.broadcaster.Unsubscribe(sub)
+				}
+				sub = o.sub
+			}
+			err = c.write(o.resp)
+		case ev := <-events:
+			metric, typ := ev.Metric, TypeMetric
+			if ev.Deleted {
+				typ = TypeDeleted
+			}
+			err = c.write(Response{Type: typ, Metric: &metric, Seq: ev.Seq})
+		case <-dropped:
+			sub = nil
+			err = c.write(Response{Type: TypeDropped})
+		case <-ping.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err = c.ws.WriteMessage(websocket.PingMessage, nil)
+		case <-c.readDone:
+			return
+		case <-c.h.done:
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+			_ = c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// write отправляет сообщение клиенту.
+func (c *conn) write(resp Response) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteJSON(resp)
+}
+
+// decodeRequest разбирает сообщение клиента. Неизвестные поля считаются ошибкой,
+// как и в HTTP-обработчиках обновления метрик.
+func decodeRequest(data []byte, req *Request) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(req)
+}
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/middleware"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/stream"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestConn(t *testing.T) (*websocket.Conn, *storage.Observable, *Handler) {
+	s := storage.NewObservable(storage.NewMemStorage())
+	b := stream.NewBroadcaster()
+	s.Subscribe(b.Publish)
+
+	h := NewHandler(s, b, zap.NewNop().Sugar())
+	srv := httptest.NewServer(middleware.Logging(h, zap.NewNop().Sugar()))
+	t.Cleanup(srv.Close)
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c, s, h
+}
+
+func roundTrip(t *testing.T, c *websocket.Conn, req Request) Response {
+	require.NoError(t, c.WriteJSON(req))
+	return read(t, c)
+}
+
+func read(t *testing.T, c *websocket.Conn) Response {
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	var resp Response
+	require.NoError(t, c.ReadJSON(&resp))
+	return resp
+}
+
+func TestHandler_UpdateAndSubscribe(t *testing.T) {
+	c, s, _ := newTestConn(t)
+	heap, delta := 42.0, int64(2)
+
+	resp := roundTrip(t, c, Request{ID: "1", Type: TypeSubscribe, Filter: &Filter{IDs: []string{"HeapAlloc"}}})
+	assert.Equal(t, Response{Type: TypeAck, ID: "1"}, resp)
+
+	require.NoError(t, s.Save(models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}))
+	require.NoError(t, c.WriteJSON(Request{ID: "2", Type: TypeUpdate, Metrics: []models.Metrics{
+		{ID: "HeapAlloc", MType: models.Gauge, Value: &heap},
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+	}}))
+
+	// Изменение по подписке и ack могут прийти в любом порядке.
+	var ack, event Response
+	for i := 0; i < 2; i++ {
+		r := read(t, c)
+		switch r.Type {
+		case TypeAck:
+			ack = r
+		case TypeMetric:
+			event = r
+		default:
+			t.Fatalf("unexpected message %+v", r)
+		}
+	}
+
+	assert.Equal(t, "2", ack.ID)
+	require.Len(t, ack.Metrics, 2)
+	assert.Equal(t, heap, *ack.Metrics[0].Value)
+	assert.Equal(t, int64(4), *ack.Metrics[1].Delta, "ack carries the stored counter total")
+
+	require.NotNil(t, event.Metric)
+	assert.Equal(t, "HeapAlloc", event.Metric.ID)
+	assert.NotZero(t, event.Seq)
+
+	resp = roundTrip(t, c, Request{ID: "3", Type: TypeUnsubscribe})
+	assert.Equal(t, Response{Type: TypeAck, ID: "3"}, resp)
+	resp = roundTrip(t, c, Request{ID: "4", Type: TypeUpdate, Metrics: []models.Metrics{{ID: "HeapAlloc", MType: models.Gauge, Value: &heap}}})
+	assert.Equal(t, TypeAck, resp.Type, "no metric events after unsubscribe")
+}
+
+func TestHandler_Errors(t *testing.T) {
+	c, s, _ := newTestConn(t)
+	value, delta := 1.0, int64(1)
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr string
+	}{
+		{
+			name:    "batch with invalid metric is not saved",
+			req:     Request{ID: "1", Type: TypeUpdate, Metrics: []models.Metrics{{ID: "Alloc", MType: models.Gauge, Value: &value}, {ID: "Bad", MType: models.Gauge}}},
+			wantErr: "metrics[1]: value: gauge requires a value",
+		},
+		{
+			name: "batch with type conflict is not saved",
+			req: Request{ID: "4", Type: TypeUpdate, Metrics: []models.Metrics{
+				{ID: "Alloc", MType: models.Gauge, Value: &value},
+				{ID: "Alloc", MType: models.Counter, Delta: &delta},
+			}},
+			wantErr: "metrics[1]:",
+		},
+		{
+			name:    "unknown type",
+			req:     Request{ID: "2", Type: "delete"},
+			wantErr: "unknown message type",
+		},
+		{
+			name:    "bad filter",
+			req:     Request{ID: "3", Type: TypeSubscribe, Filter: &Filter{Regex: "("}},
+			wantErr: "invalid regex",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := roundTrip(t, c, tt.req)
+			assert.Equal(t, TypeError, resp.Type)
+			assert.Equal(t, tt.req.ID, resp.ID)
+			assert.Contains(t, resp.Error, tt.wantErr)
+		})
+	}
+
+	_, ok := s.Get(models.Gauge, "Alloc")
+	assert.False(t, ok)
+}
+
+func TestHandler_Close(t *testing.T) {
+	c, _, h := newTestConn(t)
+	h.Close()
+
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err := c.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+}
@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// Типы сообщений клиента.
+const (
+	TypeUpdate      = "update"      // Сохранить пакет метрик
+	TypeSubscribe   = "subscribe"   // Подписаться на изменения метрик, заменяя прежнюю подписку
+	TypeUnsubscribe = "unsubscribe" // Отменить подписку
+)
+
+// Типы сообщений сервера.
+const (
+	TypeAck     = "ack"     // Сообщение клиента обработано; для update содержит сохраненные значения
+	TypeError   = "error"   // Сообщение клиента отклонено
+	TypeMetric  = "metric"  // Изменение метрики по подписке
+	TypeDeleted = "deleted" // Удаление метрики по подписке
+	TypeDropped = "dropped" // Подписка отменена, так как клиент не успевал читать изменения
+)
+
+// Request — сообщение клиента.
+type Request struct {
+	ID      string           `json:"id"`                // Идентификатор сообщения, возвращается в ack или error
+	Type    string           `json:"type"`              // update, subscribe или unsubscribe
+	Metrics []models.Metrics `json:"metrics,omitempty"` // Метрики для update
+	Filter  *Filter          `json:"filter,omitempty"`  // Фильтр для subscribe, пустой — все метрики
+}
+
+// Filter — фильтр подписки. Пустые поля не ограничивают выборку.
+type Filter struct {
+	Type   string   `json:"type,omitempty"`   // Тип метрики: gauge или counter
+	Prefix string   `json:"prefix,omitempty"` // Префикс ID
+	Regex  string   `json:"regex,omitempty"`  // Регулярное выражение для ID
+	IDs    []string `json:"ids,omitempty"`    // Точные ID
+}
+
+// Response — сообщение сервера.
+type Response struct {
+	Type    string           `json:"type"`              // ack, error, metric, deleted или dropped
+	ID      string           `json:"id,omitempty"`      // Идентификатор сообщения клиента для ack и error
+	Metrics []models.Metrics `json:"metrics,omitempty"` // Сохраненные значения для ack на update, в порядке запроса
+	Metric  *models.Metrics  `json:"metric,omitempty"`  // Новое значение метрики для metric, ID и тип для deleted
+	Seq     uint64           `json:"seq,omitempty"`     // Порядковый номер изменения для metric и deleted
+	Error   string           `json:"error,omitempty"`   // Причина отказа для error
+}
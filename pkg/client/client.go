@@ -0,0 +1,208 @@
+// Package client позволяет приложениям на Go отправлять собственные метрики на сервер метрик
+// без запуска отдельного агента.
+//
+// Значения накапливаются в памяти и периодически отправляются пакетом на POST /updates/:
+//
+//	c := client.New("localhost:8080", client.WithGzip())
+//	defer c.Close(context.Background())
+//
+//	c.Counter("orders_created").Add(1)
+//	c.Gauge("queue_size").Set(42)
+//
+// Счетчики передаются как приращения с момента последней успешной отправки.
+// Неподтвержденный пакет повторяется с тем же ключом идемпотентности,
+// поэтому сервер не учтет его дважды.
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval — интервал фоновой отправки по умолчанию.
+const DefaultFlushInterval = 10 * time.Second
+
+// Client накапливает значения метрик и отправляет их на сервер.
+type Client struct {
+	url        string
+	httpClient *http.Client
+	gzip       bool
+	interval   time.Duration
+	onError    func(error)
+
+	mu       sync.Mutex
+	gauges   map[string]*Gauge
+	counters map[string]*Counter
+
+	flushMu sync.Mutex // Гарантирует, что одновременно выполняется только одна отправка
+	pending *batch     // Отправленный, но еще не подтвержденный пакет
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Option настраивает Client.
+type Option func(*Client)
+
+// WithGzip включает сжатие тела запросов gzip.
+func WithGzip() Option {
+	return func(c *Client) {
+		c.gzip = true
+	}
+}
+
+// WithFlushInterval задает интервал фоновой отправки. Нулевое значение отключает
+// фоновую отправку — тогда метрики отправляются только вызовом Flush.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.interval = interval
+	}
+}
+
+// WithHTTPClient задает HTTP-клиент для отправки запросов.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithErrorHandler задает функцию, которая получает ошибки фоновой отправки.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// New создает клиент для сервера по адресу address (host:port или URL с http:// или https://)
+// и запускает фоновую отправку.
+func New(address string, opts ...Option) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	c := &Client{
+		url:      strings.TrimSuffix(address, "/") + "/updates/",
+		interval: DefaultFlushInterval,
+		onError:  func(error) {},
+		gauges:   make(map[string]*Gauge),
+		counters: make(map[string]*Counter),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = defaultHTTPClient()
+	}
+
+	go c.loop()
+	return c
+}
+
+// Gauge возвращает gauge-метрику с идентификатором name. Повторные вызовы
+// с тем же именем возвращают тот же объект.
+func (c *Client) Gauge(name string) *Gauge {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.gauges[name]
+	if !ok {
+		g = &Gauge{client: c, name: name}
+		c.gauges[name] = g
+	}
+	return g
+}
+
+// Counter возвращает counter-метрику с идентификатором name. Повторные вызовы
+// с тем же именем возвращают тот же объект.
+func (c *Client) Counter(name string) *Counter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counter, ok := c.counters[name]
+	if !ok {
+		counter = &Counter{client: c, name: name}
+		c.counters[name] = counter
+	}
+	return counter
+}
+
+// loop периодически отправляет накопленные значения до вызова Close.
+func (c *Client) loop() {
+	defer close(c.done)
+	if c.interval <= 0 {
+		<-c.stop
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+			if err := c.Flush(ctx); err != nil {
+				c.onError(err)
+			}
+			cancel()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Close останавливает фоновую отправку и отправляет оставшиеся значения.
+// Повторные вызовы ничего не делают и возвращают nil.
+func (c *Client) Close(ctx context.Context) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		err = c.Flush(ctx)
+	})
+	return err
+}
+
+// Gauge — метрика, хранящая последнее установленное значение.
+type Gauge struct {
+	client *Client
+	name   string
+	value  float64
+	dirty  bool // Значение изменилось с последней отправки
+}
+
+// Set устанавливает значение метрики. NaN и бесконечность не отправляются:
+// Flush отбрасывает такое значение и возвращает ошибку.
+func (g *Gauge) Set(value float64) {
+	g.client.mu.Lock()
+	defer g.client.mu.Unlock()
+
+	g.value = value
+	g.dirty = true
+}
+
+// Counter — метрика, накапливающая приращения между отправками.
+type Counter struct {
+	client *Client
+	name   string
+	delta  int64
+}
+
+// Add увеличивает счетчик на delta.
+func (c *Counter) Add(delta int64) {
+	c.client.mu.Lock()
+	defer c.client.mu.Unlock()
+
+	c.delta += delta
+}
+
+// Inc увеличивает счетчик на единицу.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
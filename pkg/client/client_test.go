@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/config"
+	handler "github.com/alexkozopolianski/go-metrics-tpl/internal/handlers"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/server"
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// lostResponseTransport выполняет запрос, но первые lose ответов теряет,
+// имитируя обрыв соединения после обработки запроса сервером.
+type lostResponseTransport struct {
+	lose int
+}
+
+func (t *lostResponseTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil || t.lose == 0 {
+		return res, err
+	}
+	t.lose--
+	res.Body.Close()
+	return nil, errors.New("connection reset")
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, handler.Storager) {
+	memStorage := storage.NewMemStorage()
+	srv := server.New(&config.ServerConfig{}, handler.NewHandler(memStorage), zap.NewNop().Sugar())
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts, memStorage
+}
+
+func TestClient_Flush(t *testing.T) {
+	ts, memStorage := newTestServer(t)
+	transport := &lostResponseTransport{lose: 1}
+	c := New(ts.URL, WithGzip(), WithFlushInterval(0), WithHTTPClient(&http.Client{Transport: transport}))
+
+	c.Counter("orders").Add(2)
+	c.Counter("orders").Inc()
+	c.Gauge("queue").Set(1)
+	c.Gauge("queue").Set(7.5)
+
+	// Ответ на первый пакет потерян: сервер его обработал, клиент об этом не знает.
+	require.Error(t, c.Flush(context.Background()))
+
+	c.Counter("orders").Add(10)
+	require.NoError(t, c.Flush(context.Background()))
+
+	orders, ok := memStorage.Get(models.Counter, "orders")
+	require.True(t, ok)
+	assert.Equal(t, int64(13), *orders.Delta)
+
+	queue, ok := memStorage.Get(models.Gauge, "queue")
+	require.True(t, ok)
+	assert.Equal(t, 7.5, *queue.Value)
+
+	c.Counter("orders").Add(1)
+	require.NoError(t, c.Close(context.Background()))
+	orders, _ = memStorage.Get(models.Counter, "orders")
+	assert.Equal(t, int64(14), *orders.Delta)
+
+	// Повторный Close ничего не отправляет и не паникует
+	require.NoError(t, c.Close(context.Background()))
+}
+
+func TestClient_FlushDropsInvalidValues(t *testing.T) {
+	ts, memStorage := newTestServer(t)
+	c := New(ts.URL, WithFlushInterval(0))
+
+	c.Gauge("ratio").Set(math.NaN())
+	c.Gauge("load").Set(math.Inf(1))
+	c.Counter("orders").Inc()
+
+	err := c.Flush(context.Background())
+	require.ErrorIs(t, err, models.ErrInvalidValue)
+	orders, ok := memStorage.Get(models.Counter, "orders")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), *orders.Delta)
+
+	// Некорректное значение не блокирует следующие отправки.
+	c.Gauge("ratio").Set(0.5)
+	require.NoError(t, c.Flush(context.Background()))
+	ratio, ok := memStorage.Get(models.Gauge, "ratio")
+	require.True(t, ok)
+	assert.Equal(t, 0.5, *ratio.Value)
+	_, ok = memStorage.Get(models.Gauge, "load")
+	assert.False(t, ok)
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alexkozopolianski/go-metrics-tpl/internal/models"
+)
+
+// idempotencyHeader — заголовок с ключом идемпотентности пакета. Совпадает с заголовком,
+// который сервер проверяет в middleware идемпотентности.
+const idempotencyHeader = "Idempotency-Key"
+
+// defaultHTTPClient возвращает HTTP-клиент с таймаутом запроса.
+func defaultHTTPClient() *http.Client {
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+// StatusError — ошибка, возвращаемая, когда сервер ответил статусом, отличным от 2xx.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("metrics server responded with status %d", e.StatusCode)
+}
+
+// batch — пакет метрик в JSON с ключом идемпотентности.
+type batch struct {
+	key  string
+	body []byte
+}
+
+// Flush отправляет значения, накопленные с последней успешной отправки.
+// Если предыдущий пакет не был подтвержден, он сначала отправляется повторно с тем же ключом.
+// Ответ сервера 4xx означает, что пакет некорректен: он отбрасывается, а ошибка возвращается.
+// Некорректные значения (например, NaN в gauge) не попадают в пакет: они отбрасываются
+// и возвращаются в ошибке вместе с результатом отправки остальных.
+func (c *Client) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	if c.pending != nil {
+		if err := c.deliver(ctx, c.pending); err != nil {
+			return err
+		}
+	}
+
+	b, err := c.take()
+	if b == nil {
+		return err
+	}
+
+	c.pending = b
+	return errors.Join(err, c.deliver(ctx, b))
+}
+
+// deliver отправляет пакет и снимает его с повтора, если сервер его принял или отклонил.
+func (c *Client) deliver(ctx context.Context, b *batch) error {
+	err := c.post(ctx, b)
+
+	var statusErr *StatusError
+	if err == nil || errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		c.pending = nil
+	}
+	return err
+}
+
+// take забирает накопленные значения в новый пакет. Возвращает nil, если отправлять нечего.
+// Метрики, не прошедшие models.Metrics.Validate, отбрасываются, а причины возвращаются в ошибке.
+// Пакет кодируется в JSON сразу, чтобы повтор неподтвержденного пакета не мог завершиться
+// ошибкой кодирования.
+func (c *Client) take() (*batch, error) {
+	metrics, invalid := c.collect()
+	if len(metrics) == 0 {
+		return nil, invalid
+	}
+
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, errors.Join(invalid, err)
+	}
+	key := make([]byte, 16)
+	if _, err = rand.Read(key); err != nil {
+		return nil, errors.Join(invalid, err)
+	}
+	return &batch{key: hex.EncodeToString(key), body: body}, invalid
+}
+
+// collect забирает изменившиеся значения и отбрасывает некорректные.
+func (c *Client) collect() ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var metrics []models.Metrics
+	for name, g := range c.gauges {
+		if !g.dirty {
+			continue
+		}
+		value := g.value
+		metrics = append(metrics, models.Metrics{ID: name, MType: models.Gauge, Value: &value})
+		g.dirty = false
+	}
+	for name, counter := range c.counters {
+		if counter.delta == 0 {
+			continue
+		}
+		delta := counter.delta
+		metrics = append(metrics, models.Metrics{ID: name, MType: models.Counter, Delta: &delta})
+		counter.delta = 0
+	}
+
+	var errs []error
+	valid := metrics[:0]
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("metric %s dropped: %w", m.ID, err))
+			continue
+		}
+		valid = append(valid, m)
+	}
+	return valid, errors.Join(errs...)
+}
+
+// post выполняет HTTP-запрос с пакетом метрик.
+func (c *Client) post(ctx context.Context, b *batch) error {
+	body := b.body
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyHeader, b.key)
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return &StatusError{StatusCode: res.StatusCode}
+	}
+	return nil
+}